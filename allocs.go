@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/metrics"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// allocTracker reports what the generator itself allocates, so that client
+// efficiency can be compared across releases of this tool and of franz-go.
+// Reports cover one interval within one run phase (startup, running, paused);
+// changing phase ends the current report early so no report mixes phases.
+type allocTracker struct {
+	mu    sync.Mutex
+	phase string
+	base  allocSample
+}
+
+type allocSample struct {
+	at    time.Time
+	recs  int64
+	mem   runtime.MemStats
+	gcCPU float64              // seconds, from runtime/metrics
+	sites map[string]allocSite // cumulative, from the heap profile
+}
+
+var allocs *allocTracker
+
+var gcCPUMetric = []metrics.Sample{{Name: "/cpu/classes/gc/total:cpu-seconds"}}
+
+func sampleAllocs() allocSample {
+	s := allocSample{at: time.Now(), recs: atomic.LoadInt64(&totalRecs)}
+	runtime.ReadMemStats(&s.mem)
+	metrics.Read(gcCPUMetric)
+	if gcCPUMetric[0].Value.Kind() == metrics.KindFloat64 {
+		s.gcCPU = gcCPUMetric[0].Value.Float64()
+	}
+	s.sites = allocSites()
+	return s
+}
+
+// allocSites aggregates the heap profile by the first frame outside the
+// runtime. The profile is sampled (every runtime.MemProfileRate bytes) and
+// only current as of the last GC, so sites are approximate.
+func allocSites() map[string]allocSite {
+	var recs []runtime.MemProfileRecord
+	n, _ := runtime.MemProfile(nil, true)
+	for {
+		recs = make([]runtime.MemProfileRecord, n+50)
+		var ok bool
+		if n, ok = runtime.MemProfile(recs, true); ok {
+			recs = recs[:n]
+			break
+		}
+	}
+
+	sites := make(map[string]allocSite)
+	for i := range recs {
+		r := &recs[i]
+		name := "unknown"
+		frames := runtime.CallersFrames(r.Stack())
+		for {
+			f, more := frames.Next()
+			if !strings.HasPrefix(f.Function, "runtime.") {
+				name = fmt.Sprintf("%s %s:%d", f.Function, f.File[strings.LastIndexByte(f.File, '/')+1:], f.Line)
+				break
+			}
+			if !more {
+				break
+			}
+		}
+		s := sites[name]
+		s.Site = name
+		s.Bytes += r.AllocBytes
+		s.Objects += r.AllocObjects
+		sites[name] = s
+	}
+	return sites
+}
+
+func startAllocReports(interval time.Duration) {
+	allocs = &allocTracker{phase: "startup", base: sampleAllocs()}
+	go func() {
+		for range time.Tick(interval) {
+			allocs.mu.Lock()
+			allocs.report()
+			allocs.mu.Unlock()
+		}
+	}()
+}
+
+// markPhase reports the current phase up to now and starts the next one.
+func markPhase(phase string) {
+	if allocs == nil {
+		return
+	}
+	allocs.mu.Lock()
+	defer allocs.mu.Unlock()
+	if phase == allocs.phase {
+		return
+	}
+	allocs.report()
+	allocs.phase = phase
+}
+
+func (t *allocTracker) report() {
+	now := sampleAllocs()
+	base := t.base
+	t.base = now
+
+	r := &allocReport{
+		Phase:      t.phase,
+		Interval:   now.at.Sub(base.at),
+		Records:    now.recs - base.recs,
+		AllocBytes: now.mem.TotalAlloc - base.mem.TotalAlloc,
+		Allocs:     now.mem.Mallocs - base.mem.Mallocs,
+		GCs:        now.mem.NumGC - base.mem.NumGC,
+		GCPause:    time.Duration(now.mem.PauseTotalNs - base.mem.PauseTotalNs),
+		GCCPU:      time.Duration((now.gcCPU - base.gcCPU) * float64(time.Second)),
+		HeapAlloc:  now.mem.HeapAlloc,
+	}
+	for name, s := range now.sites {
+		prev := base.sites[name]
+		if s.Bytes -= prev.Bytes; s.Bytes > 0 {
+			s.Objects -= prev.Objects
+			r.Sites = append(r.Sites, s)
+		}
+	}
+	sort.Slice(r.Sites, func(i, j int) bool { return r.Sites[i].Bytes > r.Sites[j].Bytes })
+	if len(r.Sites) > 5 {
+		r.Sites = r.Sites[:5]
+	}
+	emit(r)
+}
+
+// allocReport is what the process allocated over one interval of one phase.
+type allocReport struct {
+	Phase      string        `json:"phase"`
+	Interval   time.Duration `json:"interval_ns"`
+	Records    int64         `json:"records"`
+	AllocBytes uint64        `json:"alloc_bytes"`
+	Allocs     uint64        `json:"allocs"`
+	GCs        uint32        `json:"gcs"`
+	GCPause    time.Duration `json:"gc_pause_ns"`
+	GCCPU      time.Duration `json:"gc_cpu_ns"`
+	HeapAlloc  uint64        `json:"heap_alloc_bytes"`
+	Sites      []allocSite   `json:"top_sites"`
+}
+
+type allocSite struct {
+	Site    string `json:"site"`
+	Bytes   int64  `json:"bytes"`
+	Objects int64  `json:"objects"`
+}
+
+func (*allocReport) kind() string { return "allocs" }
+
+func (r *allocReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "allocs %s: %0.2f MiB, %d objects", r.Phase, float64(r.AllocBytes)/(1024*1024), r.Allocs)
+	if r.Records > 0 {
+		fmt.Fprintf(&b, " (%0.0f B/record, %0.2f allocs/record)", float64(r.AllocBytes)/float64(r.Records), float64(r.Allocs)/float64(r.Records))
+	}
+	fmt.Fprintf(&b, "; %d GCs, pause %v, GC CPU %v; heap %0.2f MiB", r.GCs, r.GCPause, r.GCCPU.Round(time.Millisecond), float64(r.HeapAlloc)/(1024*1024))
+	for _, s := range r.Sites {
+		fmt.Fprintf(&b, "; %s %0.2f MiB", s.Site, float64(s.Bytes)/(1024*1024))
+	}
+	return b.String()
+}
+
+func (r *allocReport) metrics() []metric {
+	labels := []string{"phase", r.Phase}
+	return []metric{
+		{name: "alloc_bytes", labels: labels, value: float64(r.AllocBytes), counter: true},
+		{name: "allocs", labels: labels, value: float64(r.Allocs), counter: true},
+		{name: "gcs", labels: labels, value: float64(r.GCs), counter: true},
+		{name: "gc_pause_seconds", labels: labels, value: r.GCPause.Seconds(), counter: true},
+		{name: "gc_cpu_seconds", labels: labels, value: r.GCCPU.Seconds(), counter: true},
+		{name: "heap_alloc_bytes", value: float64(r.HeapAlloc)},
+	}
+}
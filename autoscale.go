@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// targetController searches for the operating point that meets a target,
+// for -target-p99 or -target-throughput: it steps -target-adjust (the client
+// count or the rate), measures each step for -target-window after letting it
+// settle, and bisects once it has bracketed the target, then holds the
+// operating point for the rest of the run.
+//
+// For a p99 target the operating point is the most load that stays within
+// it; for a throughput target it is the least that reaches it. A rate the
+// producers cannot keep up with counts as over a p99 target, since latency
+// only stays low by not producing.
+type targetController struct {
+	knob string // "clients" or "rate"
+	p99  time.Duration
+	thr  *minThroughput
+
+	mu      sync.Mutex
+	steps   []targetStep
+	point   int64 // 0 until converged
+	missed  bool  // converged without meeting the target
+	stopped bool  // once the run is stopping, so that clients stay stopped
+}
+
+var target *targetController
+
+// targetStep is one measured setting.
+type targetStep struct {
+	Value         int64         `json:"value"`
+	P99           time.Duration `json:"p99_ns"`
+	RecordsPerSec float64       `json:"records_per_sec"`
+	BytesPerSec   float64       `json:"bytes_per_sec"`
+	Over          bool          `json:"over"`
+}
+
+func newTargetController(knob string, p99 time.Duration, thr string) *targetController {
+	c := &targetController{knob: knob, p99: p99}
+	if (p99 > 0) == (thr != "") {
+		die("exactly one of -target-p99 and -target-throughput must be set")
+	}
+	if thr != "" {
+		t := parseThroughput("target-throughput", thr)
+		c.thr = &t
+	}
+	switch knob {
+	case "clients":
+	case "rate":
+		if *rate <= 0 {
+			die("-target-adjust rate requires a -rate to start from")
+		}
+	default:
+		die("unrecognized -target-adjust %q, expected clients or rate", knob)
+	}
+	if p99 > 0 && !measuringProduceLatency() {
+		die("-target-p99 only applies to producing, without -raw-produce")
+	}
+	if knob == "rate" && (*consumeMode || *autoBackoffOn) {
+		die("-target-adjust rate only applies to producing, without -auto-backoff")
+	}
+	if *targetWindow < time.Second || *targetSettle < 0 {
+		die("-target-window must be at least 1s and -target-settle non-negative")
+	}
+	return c
+}
+
+func (c *targetController) current() int64 {
+	if c.knob == "clients" {
+		return atomic.LoadInt64(&live.clients)
+	}
+	return atomic.LoadInt64(&live.rate)
+}
+
+func (c *targetController) set(v int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopped {
+		return
+	}
+	if c.knob == "clients" {
+		setClients(int(v))
+	} else {
+		atomic.StoreInt64(&live.rate, v)
+	}
+}
+
+// stop ends adjusting as the run stops.
+func (c *targetController) stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stopped = true
+}
+
+func (c *targetController) limit() int64 {
+	if c.knob == "clients" {
+		return int64(*targetMaxClients)
+	}
+	return 1 << 40
+}
+
+// resolution is how close the bracket must get: one client, or 5% of the
+// rate.
+func (c *targetController) resolution(lo int64) int64 {
+	if c.knob == "clients" {
+		return 1
+	}
+	return max(1, lo/20)
+}
+
+// measure sets v and measures it once settled.
+func (c *targetController) measure(v int64) targetStep {
+	c.set(v)
+	time.Sleep(*targetSettle)
+	lat := produceLat.snapshot()
+	recs := atomic.LoadInt64(&totalRecs) + atomic.LoadInt64(&rateRecs)
+	bytes := atomic.LoadInt64(&totalBytes) + atomic.LoadInt64(&rateBytes)
+	start := time.Now()
+	time.Sleep(*targetWindow)
+	secs := time.Since(start).Seconds()
+
+	s := targetStep{
+		Value:         v,
+		P99:           produceLat.snapshot().sub(lat).quantile(0.99),
+		RecordsPerSec: float64(atomic.LoadInt64(&totalRecs)+atomic.LoadInt64(&rateRecs)-recs) / secs,
+		BytesPerSec:   float64(atomic.LoadInt64(&totalBytes)+atomic.LoadInt64(&rateBytes)-bytes) / secs,
+	}
+	switch {
+	case c.thr != nil && c.thr.records:
+		s.Over = s.RecordsPerSec >= c.thr.perSec
+	case c.thr != nil:
+		s.Over = s.BytesPerSec >= c.thr.perSec
+	default:
+		s.Over = s.P99 > c.p99 || c.knob == "rate" && s.RecordsPerSec < 0.9*float64(v)
+	}
+	return s
+}
+
+// run brackets the target between the most load known to be under it (lo)
+// and the least known to be over it (hi), doubling or halving until both
+// are known and then bisecting, to within c.resolution.
+func (c *targetController) run() {
+	var lo, hi int64
+	v := max(c.current(), 1)
+	for {
+		s := c.measure(v)
+		c.mu.Lock()
+		c.steps = append(c.steps, s)
+		c.mu.Unlock()
+		verdict := "under target"
+		if s.Over {
+			verdict = "over target"
+		}
+		fmt.Fprintf(os.Stderr, "target: %d %s: p99 %v, %0.2f MiB/s, %0.2fk records/s; %s\n",
+			v, c.knob, s.P99.Round(10*time.Microsecond), s.BytesPerSec/(1024*1024), s.RecordsPerSec/1000, verdict)
+
+		if s.Over {
+			hi = v
+		} else {
+			lo = v
+		}
+		switch {
+		case !s.Over && hi == 0 && v >= c.limit():
+			c.done(lo, c.thr != nil)
+			return
+		case s.Over && lo == 0 && v <= 1:
+			c.done(1, c.thr == nil)
+			return
+		case hi == 0:
+			v = min(2*v, c.limit())
+		case lo == 0:
+			v = max(v/2, 1)
+		case hi-lo <= c.resolution(lo):
+			if c.thr != nil {
+				c.done(hi, false)
+			} else {
+				c.done(lo, false)
+			}
+			return
+		default:
+			v = lo + (hi-lo)/2
+		}
+	}
+}
+
+// done holds the operating point v, which missed the target if even the
+// least (or most) load allowed could not meet it.
+func (c *targetController) done(v int64, missed bool) {
+	c.set(v)
+	c.mu.Lock()
+	c.point, c.missed = v, missed
+	c.mu.Unlock()
+	if missed {
+		fmt.Fprintf(os.Stderr, "target: unable to meet the target; holding %d %s\n", v, c.knob)
+	} else {
+		fmt.Fprintf(os.Stderr, "target: operating point found; holding %d %s\n", v, c.knob)
+	}
+}
+
+// targetReport is the search's result, for the summary.
+type targetReport struct {
+	Target string       `json:"target"`
+	Adjust string       `json:"adjust"`
+	Point  int64        `json:"operating_point"` // 0 if the search had not finished
+	Met    bool         `json:"met"`
+	Steps  []targetStep `json:"steps"`
+}
+
+func (c *targetController) report() *targetReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r := &targetReport{
+		Adjust: c.knob,
+		Point:  c.point,
+		Met:    c.point > 0 && !c.missed,
+		Steps:  append([]targetStep(nil), c.steps...),
+	}
+	if c.thr != nil {
+		r.Target = ">= " + *targetThroughput
+	} else {
+		r.Target = "p99 <= " + c.p99.String()
+	}
+	return r
+}
+
+func (r *targetReport) String() string {
+	if r.Point == 0 {
+		return fmt.Sprintf("target %s: no operating point after %d steps adjusting %s", r.Target, len(r.Steps), r.Adjust)
+	}
+	var at targetStep
+	for _, s := range r.Steps {
+		if s.Value == r.Point {
+			at = s
+		}
+	}
+	verdict := "operating point"
+	if !r.Met {
+		verdict = "missed, closest"
+	}
+	return fmt.Sprintf("target %s: %s %d %s (p99 %v, %0.2f MiB/s, %0.2fk records/s) after %d steps",
+		r.Target, verdict, r.Point, r.Adjust, at.P99.Round(10*time.Microsecond), at.BytesPerSec/(1024*1024), at.RecordsPerSec/1000, len(r.Steps))
+}
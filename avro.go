@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// avroType is one node of a parsed Avro schema, able to append a random
+// binary encoded value of itself. Logical types generate as their
+// underlying type.
+type avroType struct {
+	typ     string
+	fields  []*avroType // record fields, or union branches
+	items   *avroType   // array items, or map values
+	symbols int         // enum symbol count
+	size    int         // fixed size
+}
+
+// parseAvroSchema parses an Avro schema in its JSON form.
+func parseAvroSchema(schema string) *avroType {
+	var raw interface{}
+	err := json.Unmarshal([]byte(schema), &raw)
+	chk(err, "invalid avro schema: %v", err)
+	return parseAvroType(raw, make(map[string]*avroType))
+}
+
+// parseAvroType parses one type, registering named types (records, enums,
+// fixed) in named so later references to them resolve.
+func parseAvroType(raw interface{}, named map[string]*avroType) *avroType {
+	switch v := raw.(type) {
+	case string:
+		switch v {
+		case "null", "boolean", "int", "long", "float", "double", "bytes", "string":
+			return &avroType{typ: v}
+		}
+		if t, ok := named[v]; ok {
+			return t
+		}
+		die("avro schema references unknown type %q", v)
+
+	case []interface{}:
+		t := &avroType{typ: "union"}
+		for _, branch := range v {
+			t.fields = append(t.fields, parseAvroType(branch, named))
+		}
+		if len(t.fields) == 0 {
+			die("avro schema has an empty union")
+		}
+		return t
+
+	case map[string]interface{}:
+		typ, _ := v["type"].(string)
+		name, _ := v["name"].(string)
+		t := &avroType{typ: typ}
+		switch typ {
+		case "record", "error":
+			t.typ = "record"
+			named[name] = t // before fields, which may refer back
+			fields, _ := v["fields"].([]interface{})
+			for _, f := range fields {
+				f, ok := f.(map[string]interface{})
+				if !ok {
+					die("avro record %s has an invalid field", name)
+				}
+				t.fields = append(t.fields, parseAvroType(f["type"], named))
+			}
+		case "enum":
+			symbols, _ := v["symbols"].([]interface{})
+			if t.symbols = len(symbols); t.symbols == 0 {
+				die("avro enum %s has no symbols", name)
+			}
+			named[name] = t
+		case "fixed":
+			size, _ := v["size"].(float64)
+			t.size = int(size)
+			named[name] = t
+		case "array":
+			t.items = parseAvroType(v["items"], named)
+		case "map":
+			t.items = parseAvroType(v["values"], named)
+		default:
+			// A primitive with attributes, e.g. a logical type, or a
+			// nested type definition.
+			return parseAvroType(v["type"], named)
+		}
+		return t
+	}
+	die("invalid avro schema type %v", raw)
+	return nil
+}
+
+// append appends a random value of t to dst.
+func (t *avroType) append(dst []byte, rng *rand.Rand) []byte {
+	switch t.typ {
+	case "null":
+	case "boolean":
+		dst = append(dst, byte(rng.Intn(2)))
+	case "int", "long":
+		dst = binary.AppendVarint(dst, rng.Int63n(1000000))
+	case "float":
+		dst = binary.LittleEndian.AppendUint32(dst, math.Float32bits(rng.Float32()*1000))
+	case "double":
+		dst = binary.LittleEndian.AppendUint64(dst, math.Float64bits(rng.Float64()*1000))
+	case "bytes", "string":
+		dst = binary.AppendVarint(dst, 8)
+		dst = appendLetters(dst, 8, rng)
+	case "enum":
+		dst = binary.AppendVarint(dst, int64(rng.Intn(t.symbols)))
+	case "fixed":
+		for i := 0; i < t.size; i++ {
+			dst = append(dst, byte(rng.Intn(256)))
+		}
+	case "union":
+		branch := rng.Intn(len(t.fields))
+		dst = binary.AppendVarint(dst, int64(branch))
+		dst = t.fields[branch].append(dst, rng)
+	case "record":
+		for _, f := range t.fields {
+			dst = f.append(dst, rng)
+		}
+	case "array", "map":
+		// One block of a few items, then the empty block ending it.
+		n := 1 + rng.Intn(3)
+		dst = binary.AppendVarint(dst, int64(n))
+		for i := 0; i < n; i++ {
+			if t.typ == "map" {
+				dst = binary.AppendVarint(dst, 8)
+				dst = appendLetters(dst, 8, rng)
+			}
+			dst = t.items.append(dst, rng)
+		}
+		dst = append(dst, 0)
+	default:
+		panic(fmt.Sprintf("unhandled avro type %s", t.typ))
+	}
+	return dst
+}
+
+func appendLetters(dst []byte, n int, rng *rand.Rand) []byte {
+	for i := 0; i < n; i++ {
+		dst = append(dst, byte('a'+rng.Intn(26)))
+	}
+	return dst
+}
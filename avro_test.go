@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"testing"
+)
+
+// skipAvro decodes one value of t from b, returning what follows it, or
+// false if b does not hold a valid value.
+func skipAvro(t *avroType, b []byte) ([]byte, bool) {
+	varint := func() (int64, bool) {
+		v, n := binary.Varint(b)
+		if n <= 0 {
+			return 0, false
+		}
+		b = b[n:]
+		return v, true
+	}
+	span := func(n int64) bool {
+		if n < 0 || int64(len(b)) < n {
+			return false
+		}
+		b = b[n:]
+		return true
+	}
+	switch t.typ {
+	case "null":
+	case "boolean":
+		if len(b) == 0 || b[0] > 1 {
+			return nil, false
+		}
+		b = b[1:]
+	case "int", "long":
+		if _, ok := varint(); !ok {
+			return nil, false
+		}
+	case "float":
+		if !span(4) {
+			return nil, false
+		}
+	case "double":
+		if !span(8) {
+			return nil, false
+		}
+	case "bytes", "string":
+		n, ok := varint()
+		if !ok || !span(n) {
+			return nil, false
+		}
+	case "enum":
+		n, ok := varint()
+		if !ok || n < 0 || n >= int64(t.symbols) {
+			return nil, false
+		}
+	case "fixed":
+		if !span(int64(t.size)) {
+			return nil, false
+		}
+	case "union":
+		n, ok := varint()
+		if !ok || n < 0 || n >= int64(len(t.fields)) {
+			return nil, false
+		}
+		return skipAvro(t.fields[n], b)
+	case "record":
+		for _, f := range t.fields {
+			var ok bool
+			if b, ok = skipAvro(f, b); !ok {
+				return nil, false
+			}
+		}
+	case "array", "map":
+		for {
+			n, ok := varint()
+			if !ok || n < 0 {
+				return nil, false
+			}
+			if n == 0 {
+				break
+			}
+			for ; n > 0; n-- {
+				if t.typ == "map" {
+					l, ok := varint()
+					if !ok || !span(l) {
+						return nil, false
+					}
+				}
+				if b, ok = skipAvro(t.items, b); !ok {
+					return nil, false
+				}
+			}
+		}
+	default:
+		return nil, false
+	}
+	return b, true
+}
+
+func TestAvroEncode(t *testing.T) {
+	for _, schema := range []string{
+		`"long"`,
+		`["null", "string"]`,
+		`{"type": "enum", "name": "e", "symbols": ["a", "b", "c"]}`,
+		`{"type": "fixed", "name": "f", "size": 16}`,
+		`{"type": "int", "logicalType": "date"}`,
+		`{"type": "array", "items": "double"}`,
+		`{"type": "map", "values": {"type": "array", "items": "boolean"}}`,
+		`{"type": "record", "name": "r", "fields": [
+			{"name": "id", "type": "long"},
+			{"name": "name", "type": "string"},
+			{"name": "score", "type": "float"},
+			{"name": "tags", "type": {"type": "map", "values": "bytes"}},
+			{"name": "next", "type": ["null", "r"]}
+		]}`,
+	} {
+		typ := parseAvroSchema(schema)
+		rng := rand.New(rand.NewSource(1))
+		for i := 0; i < 100; i++ {
+			b := typ.append(nil, rng)
+			rest, ok := skipAvro(typ, b)
+			if !ok || len(rest) != 0 {
+				t.Errorf("%s: value %x does not decode to exactly one value", schema, b)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// autoBackoff keeps unattended runs from spiraling into retry storms on a
+// degraded cluster. Every second it checks throttle time and the produce
+// error rate; once either has been over its threshold for -backoff-window,
+// the target rate is halved, and once both have been healthy for a window,
+// the rate is probed back up by a tenth of the requested rate at a time.
+//
+// The requested rate is the ceiling: -rate at startup, or whatever the
+// control API last set, which is noticed as a change the controller did not
+// make itself.
+func autoBackoff() {
+	var (
+		ceiling   = atomic.LoadInt64(&live.rate)
+		set       = ceiling
+		unhealthy time.Duration
+		healthy   time.Duration
+
+		lastThrottled = atomic.LoadInt64(&throttles.total)
+		lastErrs      = atomic.LoadInt64(&produceErrors)
+		lastRecs      = ackedRecs()
+	)
+	for range time.Tick(time.Second) {
+		if cur := atomic.LoadInt64(&live.rate); cur != set {
+			ceiling, set = cur, cur
+			unhealthy, healthy = 0, 0
+		}
+
+		throttledNow := atomic.LoadInt64(&throttles.total)
+		errsNow := atomic.LoadInt64(&produceErrors)
+		recsNow := ackedRecs()
+		throttled := time.Duration(throttledNow - lastThrottled)
+		errs, recs := errsNow-lastErrs, recsNow-lastRecs
+		lastThrottled, lastErrs, lastRecs = throttledNow, errsNow, recsNow
+
+		var errRate float64
+		if errs > 0 {
+			errRate = float64(errs) / float64(errs+recs)
+		}
+		if throttled > *backoffThrottle || errRate > *backoffErrors {
+			unhealthy += time.Second
+			healthy = 0
+		} else {
+			healthy += time.Second
+			unhealthy = 0
+		}
+
+		next := set
+		switch {
+		case ceiling <= 0 || atomic.LoadInt32(&live.paused) == 1:
+			continue
+		case unhealthy >= *backoffWindow:
+			if next = set / 2; next < 1 {
+				next = 1
+			}
+			fmt.Fprintf(os.Stderr, "auto-backoff: throttled %v/s, %0.2f%% errors; cutting rate to %d records/s\n",
+				throttled.Round(time.Millisecond), 100*errRate, next)
+			unhealthy = 0
+		case healthy >= *backoffWindow && set < ceiling:
+			if next = set + (ceiling+9)/10; next > ceiling {
+				next = ceiling
+			}
+			fmt.Fprintf(os.Stderr, "auto-backoff: healthy for %v; raising rate to %d of %d records/s\n", healthy, next, ceiling)
+			healthy = 0
+		}
+		if next != set {
+			set = next
+			atomic.StoreInt64(&live.rate, set)
+		}
+	}
+}
+
+// ackedRecs is every record acknowledged so far, including those not yet
+// swapped into totalRecs by the latest report, so that the error rate is
+// measured over the same second as the errors.
+func ackedRecs() int64 {
+	return atomic.LoadInt64(&totalRecs) + atomic.LoadInt64(&rateRecs)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// batchStats shows the batching a run actually achieves, for linger and
+// batch size tuning: how big produced batches are, and how many batches and
+// records each produce request carries. Every produce request is a flush of
+// whatever was batched for one broker.
+type batchStats struct {
+	requests    int64
+	batches     int64
+	records     int64
+	bytesHist   histogram // bytes per batch, as written
+	recordsHist histogram // records per batch
+}
+
+var batching batchStats
+
+func (s *batchStats) OnProduceBatchWritten(_ kgo.BrokerMetadata, _ string, _ int32, m kgo.ProduceBatchMetrics) {
+	atomic.AddInt64(&s.batches, 1)
+	atomic.AddInt64(&s.records, int64(m.NumRecords))
+	s.bytesHist.observeValue(int64(m.CompressedBytes))
+	s.recordsHist.observeValue(int64(m.NumRecords))
+}
+
+func (s *batchStats) OnBrokerE2E(_ kgo.BrokerMetadata, key int16, e2e kgo.BrokerE2E) {
+	if key == kmsg.Produce.Int16() && e2e.Err() == nil {
+		atomic.AddInt64(&s.requests, 1)
+	}
+}
+
+// sizeSummary is the percentiles of a histogram of sizes or counts.
+type sizeSummary struct {
+	P50 int64 `json:"p50"`
+	P99 int64 `json:"p99"`
+	Max int64 `json:"max"`
+}
+
+func (s *histSnapshot) sizes() sizeSummary {
+	return sizeSummary{
+		P50: int64(s.quantile(0.5)),
+		P99: int64(s.quantile(0.99)),
+		Max: int64(s.max()),
+	}
+}
+
+// batchReport is the batching over one interval. Byte counts are of the
+// records within batches (compressed, if compressing), excluding batch
+// overhead.
+type batchReport struct {
+	Requests     int64       `json:"produce_requests"`
+	Batches      int64       `json:"batches"`
+	Records      int64       `json:"records"`
+	BatchBytes   sizeSummary `json:"batch_bytes"`
+	BatchRecords sizeSummary `json:"batch_records"`
+}
+
+func (s *batchStats) swap() *batchReport {
+	return &batchReport{
+		Requests:     atomic.SwapInt64(&s.requests, 0),
+		Batches:      atomic.SwapInt64(&s.batches, 0),
+		Records:      atomic.SwapInt64(&s.records, 0),
+		BatchBytes:   s.bytesHist.interval().sizes(),
+		BatchRecords: s.recordsHist.interval().sizes(),
+	}
+}
+
+func (r *batchReport) String() string {
+	line := fmt.Sprintf("%d batches, batch bytes p50 %d, p99 %d, max %d; records per batch p50 %d, p99 %d, max %d; %d produce requests",
+		r.Batches, r.BatchBytes.P50, r.BatchBytes.P99, r.BatchBytes.Max,
+		r.BatchRecords.P50, r.BatchRecords.P99, r.BatchRecords.Max, r.Requests)
+	if r.Requests > 0 {
+		line += fmt.Sprintf(" (%0.1f batches, %0.1f records each)", float64(r.Batches)/float64(r.Requests), float64(r.Records)/float64(r.Requests))
+	}
+	return line
+}
+
+func (r *batchReport) metrics() []metric {
+	return []metric{
+		{name: "produce_requests", value: float64(r.Requests), counter: true},
+		{name: "produce_batches", value: float64(r.Batches), counter: true},
+		{name: "batch_bytes_p50", value: float64(r.BatchBytes.P50)},
+		{name: "batch_bytes_p99", value: float64(r.BatchBytes.P99)},
+		{name: "batch_bytes_max", value: float64(r.BatchBytes.Max)},
+		{name: "batch_records_p50", value: float64(r.BatchRecords.P50)},
+		{name: "batch_records_p99", value: float64(r.BatchRecords.P99)},
+		{name: "batch_records_max", value: float64(r.BatchRecords.Max)},
+	}
+}
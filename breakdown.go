@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// latencyBreakdown splits produce latency, for -report-latency-breakdown,
+// into broker time, the round trip of each produce request (writing it,
+// waiting on the broker, reading the response), and client time, the rest
+// of each record's latency: lingering, waiting for a batch to fill, and
+// waiting behind in-flight requests. kgo does not say which request carried
+// a record, so a record's client time is its latency less the most recent
+// round trip to its partition's leader, which is exact while requests to a
+// broker take similar times.
+type latencyBreakdown struct {
+	mu   sync.RWMutex
+	rtts map[int32]*int64 // broker => latest round trip, ns
+
+	broker histogram
+	client histogram
+}
+
+var breakdown = latencyBreakdown{
+	rtts: make(map[int32]*int64),
+}
+
+func (b *latencyBreakdown) OnBrokerE2E(meta kgo.BrokerMetadata, key int16, e2e kgo.BrokerE2E) {
+	if key != kmsg.Produce.Int16() || e2e.Err() != nil {
+		return
+	}
+	d := e2e.DurationE2E()
+	b.broker.observe(d)
+	b.mu.RLock()
+	rtt := b.rtts[meta.NodeID]
+	b.mu.RUnlock()
+	if rtt == nil {
+		b.mu.Lock()
+		if rtt = b.rtts[meta.NodeID]; rtt == nil {
+			rtt = new(int64)
+			b.rtts[meta.NodeID] = rtt
+		}
+		b.mu.Unlock()
+	}
+	atomic.StoreInt64(rtt, int64(d))
+}
+
+// produced splits the latency of r.
+func (b *latencyBreakdown) produced(r *kgo.Record, lat time.Duration) {
+	var rtt time.Duration
+	if leader, ok := produceLeaders.leader(topicPartition{r.Topic, r.Partition}); ok {
+		b.mu.RLock()
+		if p := b.rtts[leader]; p != nil {
+			rtt = time.Duration(atomic.LoadInt64(p))
+		}
+		b.mu.RUnlock()
+	}
+	b.client.observe(max(lat-rtt, 0))
+}
+
+// breakdownReport is produce latency split over one interval.
+type breakdownReport struct {
+	Broker *latencySummary `json:"broker"`
+	Client *latencySummary `json:"client"`
+}
+
+func (b *latencyBreakdown) swap() *breakdownReport {
+	return &breakdownReport{
+		Broker: b.broker.interval().summary(),
+		Client: b.client.interval().summary(),
+	}
+}
+
+func (r *breakdownReport) String() string {
+	return fmt.Sprintf("broker round trip %s; client buffering %s", r.Broker, r.Client)
+}
+
+func (r *breakdownReport) metrics() []metric {
+	return append(r.Broker.metrics("produce_broker_latency"), r.Client.metrics("produce_client_latency")...)
+}
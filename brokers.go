@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// brokerStats tracks connections and requests per broker, to show which
+// broker is slow during a run. Connection counts are cumulative; everything
+// else is per interval.
+type brokerStats struct {
+	mu      sync.Mutex
+	brokers map[int32]*brokerCounters
+}
+
+type brokerCounters struct {
+	open       int64
+	dials      int64
+	dialErrors int64
+	requests   int64
+	reqErrors  int64
+	bytesOut   int64
+	bytesIn    int64
+	dialLat    histogram
+	requestLat histogram
+}
+
+var brokerConns = brokerStats{brokers: make(map[int32]*brokerCounters)}
+
+func (s *brokerStats) get(node int32) *brokerCounters {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.brokers[node]
+	if c == nil {
+		c = new(brokerCounters)
+		s.brokers[node] = c
+	}
+	return c
+}
+
+func (s *brokerStats) OnBrokerConnect(meta kgo.BrokerMetadata, dialDur time.Duration, _ net.Conn, err error) {
+	c := s.get(meta.NodeID)
+	if err != nil {
+		atomic.AddInt64(&c.dialErrors, 1)
+		return
+	}
+	atomic.AddInt64(&c.open, 1)
+	atomic.AddInt64(&c.dials, 1)
+	c.dialLat.observe(dialDur)
+}
+
+func (s *brokerStats) OnBrokerDisconnect(meta kgo.BrokerMetadata, _ net.Conn) {
+	atomic.AddInt64(&s.get(meta.NodeID).open, -1)
+}
+
+func (s *brokerStats) OnBrokerE2E(meta kgo.BrokerMetadata, _ int16, e2e kgo.BrokerE2E) {
+	c := s.get(meta.NodeID)
+	atomic.AddInt64(&c.requests, 1)
+	atomic.AddInt64(&c.bytesOut, int64(e2e.BytesWritten))
+	atomic.AddInt64(&c.bytesIn, int64(e2e.BytesRead))
+	if e2e.Err() != nil {
+		atomic.AddInt64(&c.reqErrors, 1)
+		return
+	}
+	c.requestLat.observe(e2e.DurationE2E())
+}
+
+// brokerReport is one broker's connections and requests over one interval.
+type brokerReport struct {
+	Node       int32           `json:"node"`
+	Open       int64           `json:"open_conns"`
+	Dials      int64           `json:"dials"`
+	DialErrors int64           `json:"dial_errors"`
+	DialLat    *latencySummary `json:"dial_latency"`
+	Requests   int64           `json:"requests"`
+	Errors     int64           `json:"request_errors"`
+	BytesOut   int64           `json:"bytes_written"`
+	BytesIn    int64           `json:"bytes_read"`
+	Latency    *latencySummary `json:"request_latency"`
+}
+
+type brokersReport []*brokerReport
+
+// brokerName names a node ID, where kgo numbers seed brokers up from
+// math.MinInt32 until metadata gives their real IDs.
+func brokerName(node int32) string {
+	if node < 0 {
+		return "seed" + strconv.Itoa(int(node-math.MinInt32))
+	}
+	return strconv.Itoa(int(node))
+}
+
+func (s *brokerStats) swap() brokersReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var r brokersReport
+	for node, c := range s.brokers {
+		r = append(r, &brokerReport{
+			Node:       node,
+			Open:       atomic.LoadInt64(&c.open),
+			Dials:      atomic.SwapInt64(&c.dials, 0),
+			DialErrors: atomic.SwapInt64(&c.dialErrors, 0),
+			DialLat:    c.dialLat.interval().summary(),
+			Requests:   atomic.SwapInt64(&c.requests, 0),
+			Errors:     atomic.SwapInt64(&c.reqErrors, 0),
+			BytesOut:   atomic.SwapInt64(&c.bytesOut, 0),
+			BytesIn:    atomic.SwapInt64(&c.bytesIn, 0),
+			Latency:    c.requestLat.interval().summary(),
+		})
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].Node < r[j].Node })
+	return r
+}
+
+func (r brokersReport) String() string {
+	parts := make([]string, 0, len(r))
+	for _, b := range r {
+		part := fmt.Sprintf("broker %s: %d conns, %d dials, %d dial errors; %d requests, %d errors, %0.2f MiB out, %0.2f MiB in, request %s",
+			brokerName(b.Node), b.Open, b.Dials, b.DialErrors, b.Requests, b.Errors,
+			float64(b.BytesOut)/(1024*1024), float64(b.BytesIn)/(1024*1024), b.Latency)
+		if b.Dials > 0 {
+			part += fmt.Sprintf(", dial p99 %v", b.DialLat.P99.Round(time.Microsecond))
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "; ")
+}
+
+func (r brokersReport) metrics() []metric {
+	var ms []metric
+	for _, b := range r {
+		labels := []string{"broker", brokerName(b.Node)}
+		ms = append(ms,
+			metric{name: "broker_open_conns", labels: labels, value: float64(b.Open)},
+			metric{name: "broker_dials", labels: labels, value: float64(b.Dials), counter: true},
+			metric{name: "broker_dial_errors", labels: labels, value: float64(b.DialErrors), counter: true},
+			metric{name: "broker_requests", labels: labels, value: float64(b.Requests), counter: true},
+			metric{name: "broker_request_errors", labels: labels, value: float64(b.Errors), counter: true},
+			metric{name: "broker_bytes_written", labels: labels, value: float64(b.BytesOut), counter: true},
+			metric{name: "broker_bytes_read", labels: labels, value: float64(b.BytesIn), counter: true},
+		)
+		ms = append(ms, b.Latency.metrics("broker_request_latency", labels...)...)
+		ms = append(ms, b.DialLat.metrics("broker_dial_latency", labels...)...)
+	}
+	return ms
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// producing is every running producer client, for -report-buffered to sum
+// what they have buffered and not yet had acknowledged.
+var producing struct {
+	mu      sync.Mutex
+	clients map[*kgo.Client]struct{}
+}
+
+// trackBuffered adds client to the -report-buffered sum until the returned
+// func is called.
+func trackBuffered(client *kgo.Client) func() {
+	producing.mu.Lock()
+	defer producing.mu.Unlock()
+	if producing.clients == nil {
+		producing.clients = make(map[*kgo.Client]struct{})
+	}
+	producing.clients[client] = struct{}{}
+	return func() {
+		producing.mu.Lock()
+		defer producing.mu.Unlock()
+		delete(producing.clients, client)
+	}
+}
+
+// bufferedReport is what producers have buffered as of a report. A buffer
+// near its limit means producing is blocked on memory (acknowledgements are
+// not keeping up), rather than on generating records.
+type bufferedReport struct {
+	Records int64 `json:"records"`
+	Bytes   int64 `json:"bytes"`
+	Limit   int64 `json:"limit_bytes"` // across clients
+}
+
+func buffered(perClient int64) *bufferedReport {
+	producing.mu.Lock()
+	defer producing.mu.Unlock()
+	r := &bufferedReport{Limit: perClient * int64(len(producing.clients))}
+	for client := range producing.clients {
+		r.Records += client.BufferedProduceRecords()
+		r.Bytes += client.BufferedProduceBytes()
+	}
+	return r
+}
+
+func (r *bufferedReport) String() string {
+	var pct float64
+	if r.Limit > 0 {
+		pct = 100 * float64(r.Bytes) / float64(r.Limit)
+	}
+	return fmt.Sprintf("buffered %d records, %0.2f MiB (%0.1f%% of limit)", r.Records, float64(r.Bytes)/(1024*1024), pct)
+}
+
+func (r *bufferedReport) metrics() []metric {
+	return []metric{
+		{name: "buffered_records", value: float64(r.Records)},
+		{name: "buffered_bytes", value: float64(r.Bytes)},
+		{name: "buffered_limit_bytes", value: float64(r.Limit)},
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kbin"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// chaosProducer is -chaos-records: it produces, in place of -chaos-records
+// percent of generated records, records brokers should reject, to check
+// that rejections are handled and reported sanely. Chaos records go through
+// a client of their own, so that a rejected batch never takes real records
+// down with it, and their outcomes are counted apart from real records and
+// errors. The kinds are:
+//
+//	oversize  a -chaos-record-bytes record of random bytes, over the topic's
+//	          max.message.bytes, in a batch kgo allows to be that big
+//	headers   a record with a null header key, which kgo cannot encode, so
+//	          it goes in a hand built batch sent straight to the leader
+type chaosProducer struct {
+	pct     float64
+	kinds   []string
+	client  *kgo.Client
+	payload []byte // for oversize records
+
+	mu      sync.Mutex
+	leaders []int32
+
+	raw   chan struct{} // a slot per in flight hand built batch
+	rawWg sync.WaitGroup
+
+	sent     int64 // since the last report
+	accepted int64
+
+	rejMu    sync.Mutex
+	rejected map[string]int64 // kind/error name => count
+}
+
+var chaos *chaosProducer
+
+// maxRawChaos bounds hand built batches in flight; past it, producing
+// waits, as kgo's buffered record limit bounds oversize records.
+const maxRawChaos = 64
+
+func newChaosProducer(opts []kgo.Opt, pct float64, kinds, size string) *chaosProducer {
+	if pct <= 0 || pct > 100 {
+		die("-chaos-records must be within (0, 100]")
+	}
+	if *topic == "" {
+		die("a topic is required with -chaos-records")
+	}
+	c := &chaosProducer{pct: pct, raw: make(chan struct{}, maxRawChaos), rejected: make(map[string]int64)}
+	for _, kind := range strings.Split(kinds, ",") {
+		switch kind {
+		case "oversize", "headers":
+			c.kinds = append(c.kinds, kind)
+		default:
+			die("unrecognized -chaos-kinds %q, expected oversize or headers", kind)
+		}
+	}
+	n := parseBytes(size)
+	if n <= 0 {
+		die("invalid -chaos-record-bytes %q", size)
+	}
+	c.payload = make([]byte, n)
+	seededRand("chaos", 0).Read(c.payload)
+
+	client, err := kgo.NewClient(append(opts[:len(opts):len(opts)],
+		kgo.ProducerBatchMaxBytes(int32(n)+1<<10),
+		kgo.ProducerLinger(0),
+	)...)
+	chk(err, "unable to initialize chaos client: %v", err)
+	c.client = client
+	c.leaders = rawLeaders(context.Background(), client)
+	return c
+}
+
+// roll is whether the next record is a chaos record.
+func (c *chaosProducer) roll(rng *rand.Rand) bool {
+	return rng.Float64()*100 < c.pct
+}
+
+// produce produces one chaos record of a random kind, asynchronously.
+func (c *chaosProducer) produce(rng *rand.Rand) {
+	atomic.AddInt64(&c.sent, 1)
+	switch kind := c.kinds[rng.Intn(len(c.kinds))]; kind {
+	case "oversize":
+		c.client.Produce(context.Background(), kgo.SliceRecord(c.payload), func(_ *kgo.Record, err error) {
+			c.outcome(kind, err)
+		})
+	case "headers":
+		c.mu.Lock()
+		partition := int32(rng.Intn(len(c.leaders)))
+		leader := c.leaders[partition]
+		c.mu.Unlock()
+		c.raw <- struct{}{}
+		c.rawWg.Add(1)
+		go func() {
+			defer func() { <-c.raw; c.rawWg.Done() }()
+			c.produceRaw(kind, partition, leader, nullHeaderBatch())
+		}()
+	}
+}
+
+// close waits for every chaos record's outcome, so that the final report
+// counts them, and then closes the client.
+func (c *chaosProducer) close() {
+	c.rawWg.Wait()
+	c.client.Flush(context.Background())
+	c.client.Close()
+}
+
+// nullHeaderBatch is a batch of one record whose only header has a null
+// key. Records are varint length prefixed: attributes, timestamp and offset
+// deltas, a null key, a value, and then the headers.
+func nullHeaderBatch() []byte {
+	var body []byte
+	body = append(body, 0)                                // attributes
+	body = kbin.AppendVarint(body, 0)                     // timestamp delta
+	body = kbin.AppendVarint(body, 0)                     // offset delta
+	body = kbin.AppendVarint(body, -1)                    // key
+	body = append(kbin.AppendVarint(body, 5), "chaos"...) // value
+	body = kbin.AppendVarint(body, 1)                     // header count
+	body = kbin.AppendVarint(body, -1)                    // header key: null
+	body = kbin.AppendVarint(body, -1)                    // header value
+	record := kbin.AppendVarint(nil, int32(len(body)))
+	return encodeRawBatch(append(record, body...), 1)
+}
+
+func (c *chaosProducer) produceRaw(kind string, partition, leader int32, batch []byte) {
+	req := kmsg.NewPtrProduceRequest()
+	req.Acks = -1
+	req.TimeoutMillis = 30000
+	rt := kmsg.NewProduceRequestTopic()
+	rt.Topic = *topic
+	rp := kmsg.NewProduceRequestTopicPartition()
+	rp.Partition = partition
+	rp.Records = batch
+	rt.Partitions = append(rt.Partitions, rp)
+	req.Topics = append(req.Topics, rt)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	kresp, err := c.client.Broker(int(leader)).Request(ctx, req)
+	if err == nil {
+		resp := kresp.(*kmsg.ProduceResponse)
+		if len(resp.Topics) == 1 && len(resp.Topics[0].Partitions) == 1 {
+			err = kerr.ErrorForCode(resp.Topics[0].Partitions[0].ErrorCode)
+		} else {
+			err = errors.New("malformed produce response")
+		}
+	}
+	if errors.Is(err, kerr.NotLeaderForPartition) {
+		leaders := rawLeaders(ctx, c.client)
+		c.mu.Lock()
+		c.leaders = leaders
+		c.mu.Unlock()
+	}
+	c.outcome(kind, err)
+}
+
+// outcome counts a chaos record accepted, or rejected by error name.
+func (c *chaosProducer) outcome(kind string, err error) {
+	if err == nil {
+		atomic.AddInt64(&c.accepted, 1)
+		return
+	}
+	name := "TRANSPORT_ERROR"
+	var ke *kerr.Error
+	if errors.As(err, &ke) {
+		name = ke.Message
+	}
+	c.rejMu.Lock()
+	c.rejected[kind+"/"+name]++
+	c.rejMu.Unlock()
+}
+
+// chaosReport is the chaos records produced over one interval, and how they
+// fared; none of them count toward records, bytes, or errors.
+type chaosReport struct {
+	Sent     int64            `json:"sent"`
+	Accepted int64            `json:"accepted"`
+	Rejected map[string]int64 `json:"rejected,omitempty"` // kind/error name => count
+}
+
+func (c *chaosProducer) swap() *chaosReport {
+	c.rejMu.Lock()
+	rejected := c.rejected
+	c.rejected = make(map[string]int64)
+	c.rejMu.Unlock()
+	return &chaosReport{
+		Sent:     atomic.SwapInt64(&c.sent, 0),
+		Accepted: atomic.SwapInt64(&c.accepted, 0),
+		Rejected: rejected,
+	}
+}
+
+func (r *chaosReport) String() string {
+	line := fmt.Sprintf("chaos %d sent, %d accepted", r.Sent, r.Accepted)
+	names := make([]string, 0, len(r.Rejected))
+	for name := range r.Rejected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		line += fmt.Sprintf(", %d %s", r.Rejected[name], name)
+	}
+	return line
+}
+
+func (r *chaosReport) metrics() []metric {
+	ms := []metric{
+		{name: "chaos_records_sent", value: float64(r.Sent), counter: true},
+		{name: "chaos_records_accepted", value: float64(r.Accepted), counter: true},
+	}
+	for name, n := range r.Rejected {
+		kind, reason, _ := strings.Cut(name, "/")
+		ms = append(ms, metric{name: "chaos_records_rejected", labels: []string{"kind", kind, "error", reason}, value: float64(n), counter: true})
+	}
+	return ms
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"hash/crc32"
+	"testing"
+
+	"github.com/twmb/franz-go/pkg/kbin"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+func TestNullHeaderBatch(t *testing.T) {
+	raw := nullHeaderBatch()
+	var b kmsg.RecordBatch
+	if err := b.ReadFrom(raw); err != nil {
+		t.Fatalf("unable to read batch: %v", err)
+	}
+	if got := int(b.Length) + 12; got != len(raw) {
+		t.Errorf("batch length covers %d bytes, expected %d", got, len(raw))
+	}
+	if crc := int32(crc32.Checksum(raw[21:], crc32c)); b.CRC != crc {
+		t.Errorf("got crc %d, expected %d", b.CRC, crc)
+	}
+	if b.Magic != 2 || b.NumRecords != 1 || b.LastOffsetDelta != 0 {
+		t.Errorf("got magic %d with %d records, last offset delta %d; expected magic 2 with one record", b.Magic, b.NumRecords, b.LastOffsetDelta)
+	}
+
+	r := kbin.Reader{Src: b.Records}
+	length := r.Varint()
+	if int(length) != len(r.Src) {
+		t.Errorf("record length %d, but %d bytes follow", length, len(r.Src))
+	}
+	r.Int8() // attributes
+	r.Varlong()
+	r.Varint()
+	key := r.VarintBytes()
+	value := r.VarintBytes()
+	headers := r.Varint()
+	hkey := r.VarintBytes()
+	hvalue := r.VarintBytes()
+	if err := r.Complete(); err != nil || len(r.Src) != 0 {
+		t.Fatalf("record is malformed, %d bytes left over: %v", len(r.Src), err)
+	}
+	if key != nil || string(value) != "chaos" {
+		t.Errorf("got key %q value %q, expected a null key and value chaos", key, value)
+	}
+	if headers != 1 || hkey != nil || hvalue != nil {
+		t.Errorf("got %d headers, the first %q=%q, expected one with a null key and value", headers, hkey, hvalue)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"sync/atomic"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// checksumHeader is the record header -checksum producers add: the CRC-32C
+// of the record's key followed by its value. Kafka's own batch CRC only
+// covers a batch between client and broker; this covers each record end to
+// end, through compression, brokers, and storage, to the consumer.
+const checksumHeader = "bkc-crc32c"
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Records checked since the last report.
+var (
+	checksumsOK      int64
+	checksumsCorrupt int64
+	checksumsMissing int64
+)
+
+func recordChecksum(r *kgo.Record) uint32 {
+	return crc32.Update(crc32.Checksum(r.Key, castagnoli), castagnoli, r.Value)
+}
+
+func addChecksum(r *kgo.Record) {
+	r.Headers = append(r.Headers, kgo.RecordHeader{
+		Key:   checksumHeader,
+		Value: binary.BigEndian.AppendUint32(nil, recordChecksum(r)),
+	})
+}
+
+// checkChecksum verifies a consumed record's checksum. A corrupt record is
+// reported on stderr too, since it warrants a closer look.
+func checkChecksum(r *kgo.Record) {
+	for _, h := range r.Headers {
+		if h.Key != checksumHeader {
+			continue
+		}
+		if len(h.Value) == 4 && binary.BigEndian.Uint32(h.Value) == recordChecksum(r) {
+			atomic.AddInt64(&checksumsOK, 1)
+			return
+		}
+		atomic.AddInt64(&checksumsCorrupt, 1)
+		fmt.Fprintf(os.Stderr, "corrupt record at %s/%d@%d: checksum mismatch\n", r.Topic, r.Partition, r.Offset)
+		return
+	}
+	atomic.AddInt64(&checksumsMissing, 1)
+}
+
+// checksumReport is the records checked over one interval. Corrupt records
+// count as errors, for -assert-max-errors.
+type checksumReport struct {
+	OK      int64 `json:"ok"`
+	Corrupt int64 `json:"corrupt"`
+	Missing int64 `json:"missing"`
+}
+
+func swapChecksumReport() *checksumReport {
+	return &checksumReport{
+		OK:      atomic.SwapInt64(&checksumsOK, 0),
+		Corrupt: atomic.SwapInt64(&checksumsCorrupt, 0),
+		Missing: atomic.SwapInt64(&checksumsMissing, 0),
+	}
+}
+
+func (r *checksumReport) String() string {
+	return fmt.Sprintf("checksums %d ok, %d corrupt, %d missing", r.OK, r.Corrupt, r.Missing)
+}
+
+func (r *checksumReport) metrics() []metric {
+	return []metric{
+		{name: "checksums_ok", value: float64(r.OK), counter: true},
+		{name: "checksums_corrupt", value: float64(r.Corrupt), counter: true},
+		{name: "checksums_missing", value: float64(r.Missing), counter: true},
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// clientID renders -client-id-template for client idx, so that brokers'
+// quota accounting and request logs can tell instances apart. The template
+// may use {n} (or %d) for the client index, {host} for the hostname, and
+// {pid} for the process id; an empty template keeps the library default.
+func clientID(idx int) string {
+	return renderIDTemplate(*clientIDTemplate, idx)
+}
+
+// groupInstanceID renders -group-instance-id for client idx, the same way,
+// for static group membership (KIP-345): a member that restarts with the
+// same instance id within the session timeout takes its old place in the
+// group without a rebalance.
+func groupInstanceID(idx int) string {
+	return renderIDTemplate(*groupInstanceIDTemplate, idx)
+}
+
+func renderIDTemplate(tmpl string, idx int) string {
+	if tmpl == "" {
+		return ""
+	}
+	host, _ := os.Hostname()
+	n := strconv.Itoa(idx)
+	return strings.NewReplacer(
+		"{n}", n,
+		"%d", n,
+		"{host}", host,
+		"{pid}", strconv.Itoa(os.Getpid()),
+	).Replace(tmpl)
+}
@@ -0,0 +1,26 @@
+package main
+
+import "flag"
+
+// clientLibs are alternative client libraries that can drive the workload in
+// place of franz-go, for comparing libraries under identical load. Each is
+// compiled in with its own build tag and registers itself here from init.
+//
+// A library's setup func validates flags and builds whatever its clients
+// share, returning the func that runs one client until stopped. Clients
+// generate records with newValue, pace with pacer, honor pauses, and count
+// toward rateRecs and rateBytes exactly like the franz-go workload does. The
+// report sections built from franz-go hooks (TLS, commits) are omitted.
+var clientLibs = make(map[string]func() func(idx int, stop <-chan struct{}))
+
+// rejectFlags dies if any of the named flags were set, for flags that lib has
+// no equivalent for.
+func rejectFlags(lib string, names ...string) {
+	flag.Visit(func(f *flag.Flag) {
+		for _, name := range names {
+			if f.Name == name {
+				die("-%s is not supported with -client-lib %s", name, lib)
+			}
+		}
+	})
+}
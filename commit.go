@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+var (
+	commitReqs   int64
+	commitErrors int64
+	commitLat    histogram
+)
+
+// commitHook times every OffsetCommit request consumers send, whichever
+// -commit-mode issued it, so autocommitting and manual committing are
+// measured the same way: by what each commit costs at the coordinator.
+type commitHook struct{}
+
+func (commitHook) OnBrokerE2E(_ kgo.BrokerMetadata, key int16, e2e kgo.BrokerE2E) {
+	if key != kmsg.OffsetCommit.Int16() {
+		return
+	}
+	atomic.AddInt64(&commitReqs, 1)
+	if e2e.Err() == nil {
+		commitLat.observe(e2e.DurationE2E())
+	}
+}
+
+// countCommitErr counts a failed commit, whether the request failed or any
+// partition in the response did.
+func countCommitErr(_ *kgo.Client, _ *kmsg.OffsetCommitRequest, resp *kmsg.OffsetCommitResponse, err error) {
+	if err == nil && resp != nil {
+	out:
+		for _, t := range resp.Topics {
+			for _, p := range t.Partitions {
+				if err = kerr.ErrorForCode(p.ErrorCode); err != nil {
+					break out
+				}
+			}
+		}
+	}
+	if err != nil {
+		atomic.AddInt64(&commitErrors, 1)
+	}
+}
+
+// commitOpts returns the group options for -commit-mode.
+func commitOpts() []kgo.Opt {
+	opts := []kgo.Opt{kgo.WithHooks(commitHook{})}
+	switch *commitMode {
+	case "auto":
+		opts = append(opts, kgo.AutoCommitCallback(countCommitErr))
+		if *commitInterval > 0 {
+			opts = append(opts, kgo.AutoCommitInterval(*commitInterval))
+		}
+	case "sync", "async", "none":
+		opts = append(opts, kgo.DisableAutoCommit())
+	default:
+		die("unrecognized commit mode %s", *commitMode)
+	}
+	return opts
+}
+
+// committer commits manually in the sync and async commit modes: after every
+// -commit-every records or -commit-interval, whichever comes first, or after
+// every poll if neither is set.
+type committer struct {
+	client      *kgo.Client
+	uncommitted int
+	last        time.Time
+}
+
+func (c *committer) consumed(n int) {
+	if *commitMode != "sync" && *commitMode != "async" {
+		return
+	}
+	c.uncommitted += n
+	due := *commitEvery == 0 && *commitInterval == 0 ||
+		*commitEvery > 0 && c.uncommitted >= *commitEvery ||
+		*commitInterval > 0 && time.Since(c.last) >= *commitInterval
+	if !due || c.uncommitted == 0 {
+		return
+	}
+	c.uncommitted = 0
+	c.last = time.Now()
+
+	if *commitMode == "sync" {
+		c.client.CommitOffsetsSync(context.Background(), c.client.UncommittedOffsets(), countCommitErr)
+	} else {
+		c.client.CommitOffsets(context.Background(), c.client.UncommittedOffsets(), countCommitErr)
+	}
+}
+
+// commitReport is the group commits issued over one interval.
+type commitReport struct {
+	Commits int64           `json:"commits"`
+	Errors  int64           `json:"errors"`
+	Latency *latencySummary `json:"latency"`
+}
+
+func swapCommitReport() *commitReport {
+	return &commitReport{
+		Commits: atomic.SwapInt64(&commitReqs, 0),
+		Errors:  atomic.SwapInt64(&commitErrors, 0),
+		Latency: commitLat.interval().summary(),
+	}
+}
+
+func (r *commitReport) String() string {
+	return fmt.Sprintf("%d commits, %d errors, commit %s", r.Commits, r.Errors, r.Latency)
+}
+
+func (r *commitReport) metrics() []metric {
+	return append([]metric{
+		{name: "commits", value: float64(r.Commits), counter: true},
+		{name: "commit_errors", value: float64(r.Errors), counter: true},
+	}, r.Latency.metrics("commit_latency")...)
+}
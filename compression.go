@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// codecNames is indexed by ProduceBatchMetrics.CompressionType.
+var codecNames = [...]string{"none", "gzip", "snappy", "lz4", "zstd"}
+
+// parseCompression parses the comma delimited -compression list. With more
+// than one codec, clients take turns using each (client i uses codec i % n)
+// so that codecs can be compared against the same workload in one run.
+//
+// Each codec but none and snappy may have a level, as codec:level, since the
+// level trades CPU against ratio as much as the codec does: zstd takes
+// Kafka's levels 1 through 22 (kgo's encoder buckets them into four speeds),
+// and lz4 0 (fast) through 9. gzip levels (1 through 9) are only for
+// -client-lib sarama, as this franz-go release ignores them and would
+// silently use the default. A codec may only be listed once, as batches
+// are reported by the codec they were written with, which cannot tell two
+// levels of one codec apart; levels are compared across runs.
+func parseCompression(spec string) []kgo.CompressionCodec {
+	var codecs []kgo.CompressionCodec
+	listed := make(map[string]bool)
+	for _, name := range strings.Split(strings.ToLower(spec), ",") {
+		name, level, leveled := splitCompressionLevel(name)
+		if listed[name] {
+			die("-compression lists %s more than once; batches are reported per codec, so compare its levels in separate runs", name)
+		}
+		listed[name] = true
+		var codec kgo.CompressionCodec
+		switch name {
+		case "none", "snappy":
+			if leveled {
+				die("%s compression has no levels", name)
+			}
+			codec = kgo.NoCompression()
+			if name == "snappy" {
+				codec = kgo.SnappyCompression()
+			}
+		case "gzip":
+			if leveled && *clientLib == "franz-go" {
+				die("gzip compression levels are unsupported with franz-go, which ignores them")
+			}
+			codec = kgo.GzipCompression()
+		case "lz4":
+			codec = kgo.Lz4Compression()
+			if leveled {
+				if level < 0 || level > 9 {
+					die("lz4 compression level %d is not within [0, 9]", level)
+				}
+				// lz4.CompressionLevel: Fast is 0, and LevelN is 1 << (8+N).
+				if level > 0 {
+					level = 1 << (8 + level)
+				}
+				codec = codec.WithLevel(level)
+			}
+		case "zstd":
+			codec = kgo.ZstdCompression()
+			if leveled {
+				if level < 1 || level > 22 {
+					die("zstd compression level %d is not within [1, 22]", level)
+				}
+				codec = codec.WithLevel(int(zstd.EncoderLevelFromZstd(level)))
+			}
+		default:
+			die("unrecognized compression %s", name)
+		}
+		codecs = append(codecs, codec)
+	}
+	return codecs
+}
+
+// splitCompressionLevel splits codec:level.
+func splitCompressionLevel(spec string) (name string, level int, leveled bool) {
+	name, l, leveled := strings.Cut(spec, ":")
+	if leveled {
+		var err error
+		level, err = strconv.Atoi(l)
+		chk(err, "invalid compression level %q for %s: %v", l, name, err)
+	}
+	return name, level, leveled
+}
+
+// compressionStats totals successfully produced batches by the codec they
+// were actually written with, which is also how a codec the broker does not
+// support shows up: as batches written uncompressed.
+type compressionStats [len(codecNames)]struct {
+	batches      int64
+	records      int64
+	uncompressed int64
+	compressed   int64
+}
+
+var compressions compressionStats
+
+func (s *compressionStats) OnProduceBatchWritten(_ kgo.BrokerMetadata, _ string, _ int32, m kgo.ProduceBatchMetrics) {
+	if int(m.CompressionType) >= len(s) {
+		return
+	}
+	c := &s[m.CompressionType]
+	atomic.AddInt64(&c.batches, 1)
+	atomic.AddInt64(&c.records, int64(m.NumRecords))
+	atomic.AddInt64(&c.uncompressed, int64(m.UncompressedBytes))
+	atomic.AddInt64(&c.compressed, int64(m.CompressedBytes))
+}
+
+// codecReport is one codec's batches over one interval. Byte counts are of
+// the records within batches, excluding batch overhead.
+type codecReport struct {
+	Codec        string `json:"codec"`
+	Batches      int64  `json:"batches"`
+	Records      int64  `json:"records"`
+	Uncompressed int64  `json:"uncompressed_bytes"`
+	Compressed   int64  `json:"compressed_bytes"`
+}
+
+type compressionReport []*codecReport
+
+func (s *compressionStats) swap() compressionReport {
+	var r compressionReport
+	for i := range s {
+		c := &s[i]
+		batches := atomic.SwapInt64(&c.batches, 0)
+		if batches == 0 {
+			continue
+		}
+		r = append(r, &codecReport{
+			Codec:        codecNames[i],
+			Batches:      batches,
+			Records:      atomic.SwapInt64(&c.records, 0),
+			Uncompressed: atomic.SwapInt64(&c.uncompressed, 0),
+			Compressed:   atomic.SwapInt64(&c.compressed, 0),
+		})
+	}
+	return r
+}
+
+func (c *codecReport) ratio() float64 {
+	if c.Compressed == 0 {
+		return 0
+	}
+	return float64(c.Uncompressed) / float64(c.Compressed)
+}
+
+func (r compressionReport) String() string {
+	parts := make([]string, 0, len(r))
+	for _, c := range r {
+		parts = append(parts, fmt.Sprintf("%s %d batches, ratio %0.2fx (%0.1f KiB -> %0.1f KiB per batch)",
+			c.Codec, c.Batches, c.ratio(),
+			float64(c.Uncompressed)/float64(c.Batches)/1024, float64(c.Compressed)/float64(c.Batches)/1024))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (r compressionReport) metrics() []metric {
+	var ms []metric
+	for _, c := range r {
+		labels := []string{"codec", c.Codec}
+		ms = append(ms,
+			metric{name: "batches", labels: labels, value: float64(c.Batches), counter: true},
+			metric{name: "batch_uncompressed_bytes", labels: labels, value: float64(c.Uncompressed), counter: true},
+			metric{name: "batch_compressed_bytes", labels: labels, value: float64(c.Compressed), counter: true},
+			metric{name: "compression_ratio", labels: labels, value: c.ratio()},
+		)
+	}
+	return ms
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func TestParseCompression(t *testing.T) {
+	for _, test := range []struct {
+		spec   string
+		codecs []kgo.CompressionCodec
+	}{
+		{"none", []kgo.CompressionCodec{kgo.NoCompression()}},
+		{"SNAPPY", []kgo.CompressionCodec{kgo.SnappyCompression()}},
+		{"gzip,lz4", []kgo.CompressionCodec{kgo.GzipCompression(), kgo.Lz4Compression()}},
+		{"lz4:0", []kgo.CompressionCodec{kgo.Lz4Compression().WithLevel(0)}},
+		{"lz4:9", []kgo.CompressionCodec{kgo.Lz4Compression().WithLevel(1 << 17)}},
+		{"zstd:1", []kgo.CompressionCodec{kgo.ZstdCompression().WithLevel(int(zstd.SpeedFastest))}},
+		{"zstd:22,none", []kgo.CompressionCodec{kgo.ZstdCompression().WithLevel(int(zstd.SpeedBestCompression)), kgo.NoCompression()}},
+	} {
+		if got := parseCompression(test.spec); !reflect.DeepEqual(got, test.codecs) {
+			t.Errorf("%q: got %v, expected %v", test.spec, got, test.codecs)
+		}
+	}
+}
+
+func TestSplitCompressionLevel(t *testing.T) {
+	for _, test := range []struct {
+		spec    string
+		name    string
+		level   int
+		leveled bool
+	}{
+		{"zstd", "zstd", 0, false},
+		{"zstd:3", "zstd", 3, true},
+		{"lz4:0", "lz4", 0, true},
+	} {
+		name, level, leveled := splitCompressionLevel(test.spec)
+		if name != test.name || level != test.level || leveled != test.leveled {
+			t.Errorf("%q: got %s %d %v, expected %s %d %v", test.spec, name, level, leveled, test.name, test.level, test.leveled)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// poller is satisfied by both *kgo.Client and *kgo.GroupTransactSession.
+type poller interface {
+	PollFetches(context.Context) kgo.Fetches
+	PollRecords(context.Context, int) kgo.Fetches
+}
+
+// poll polls once, taking at most -max-poll-records and, if -poll-interval is
+// set, first waiting until that long has passed since the previous poll.
+func poll(ctx context.Context, p poller, lastPoll *time.Time) kgo.Fetches {
+	if *pollInterval > 0 {
+		if wait := *pollInterval - time.Since(*lastPoll); wait > 0 {
+			time.Sleep(wait)
+		}
+		*lastPoll = time.Now()
+	}
+	if *maxPollRecords > 0 {
+		return p.PollRecords(ctx, *maxPollRecords)
+	}
+	return p.PollFetches(ctx)
+}
+
+// stopContext returns a context that is canceled once stop is closed, so that
+// stopping a client interrupts a blocked poll.
+func stopContext(stop <-chan struct{}) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stop
+		cancel()
+	}()
+	return ctx
+}
+
+// consume polls until stopped, counting consumed records and value bytes toward
+// the rate line the same way producing does. reads, if non-nil, classifies
+// reads for -historical-lag, and member, if non-nil, counts this group
+// member's share for -report-fairness.
+func consume(client *kgo.Client, reads *readTracker, member *memberCounts, rng *rand.Rand, stop <-chan struct{}) {
+	var (
+		ctx      = stopContext(stop)
+		lastPoll time.Time
+		commits  = committer{client: client, last: time.Now()}
+	)
+	if capture != nil {
+		defer capture.flush()
+	}
+	var loops *looper
+	if *loopConsume {
+		loops = newLooper(client)
+	}
+	var chaos *pauseChaos
+	if *pauseEvery > 0 {
+		chaos = newPauseChaos()
+		go chaos.run(client, rand.New(rand.NewSource(rng.Int63())), stop)
+	}
+	for waitUnpaused(stop) {
+		pollCtx, cancel := ctx, context.CancelFunc(func() {})
+		if loops != nil {
+			pollCtx, cancel = context.WithTimeout(ctx, loops.quiet())
+		}
+		fetches := poll(pollCtx, client, &lastPoll)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		if pollCtx.Err() != nil {
+			loops.quieted(ctx)
+			continue
+		}
+		fetches.EachError(func(t string, p int32, err error) {
+			die("fetch error on %s/%d: %v", t, p, err)
+		})
+
+		if chaos != nil {
+			chaos.fetched(fetches)
+		}
+		if reads != nil {
+			reads.fetched(fetches)
+		}
+
+		var recs, bytes int64
+		fetches.EachRecord(func(r *kgo.Record) {
+			recs++
+			bytes += int64(len(r.Value))
+			if capture != nil {
+				capture.write(r)
+			}
+			if verifying != nil {
+				verifying.check(r)
+			}
+			if *checksums {
+				checkChecksum(r)
+			}
+		})
+		if processing != nil {
+			processing.process(recs, rng)
+		}
+		atomic.AddInt64(&rateRecs, recs)
+		atomic.AddInt64(&rateBytes, bytes)
+		if member != nil {
+			member.consumed(recs, bytes)
+		}
+		commits.consumed(int(recs))
+		if loops != nil {
+			loops.fetched(ctx, fetches)
+		}
+	}
+}
+
+// parseConsumePartitions parses -consume-partitions, a comma delimited list
+// of topic:partition@offset, where offset is earliest, latest, or an exact
+// offset.
+func parseConsumePartitions(spec string) map[string]map[int32]kgo.Offset {
+	parts := make(map[string]map[int32]kgo.Offset)
+	for _, tp := range strings.Split(spec, ",") {
+		at := "earliest"
+		if i := strings.LastIndexByte(tp, '@'); i >= 0 {
+			tp, at = tp[:i], tp[i+1:]
+		}
+		i := strings.LastIndexByte(tp, ':')
+		if i <= 0 {
+			die("invalid -consume-partitions entry %q, expected topic:partition@offset", tp)
+		}
+		t := tp[:i]
+		p, err := strconv.ParseInt(tp[i+1:], 10, 32)
+		chk(err, "invalid partition in -consume-partitions entry %q: %v", tp, err)
+
+		var o kgo.Offset
+		switch at {
+		case "earliest":
+			o = kgo.NewOffset().AtStart()
+		case "latest":
+			o = kgo.NewOffset().AtEnd()
+		default:
+			n, err := strconv.ParseInt(at, 10, 64)
+			if err != nil || n < 0 {
+				die("invalid offset %q in -consume-partitions, expected earliest, latest, or a non-negative offset", at)
+			}
+			o = kgo.NewOffset().At(n)
+		}
+		if parts[t] == nil {
+			parts[t] = make(map[int32]kgo.Offset)
+		}
+		parts[t][int32(p)] = o
+	}
+	return parts
+}
+
+// parseConsumeFrom parses -consume-from: earliest, latest, timestamp:RFC3339
+// (the first offset at or after that time, found by kgo with a by-timestamp
+// ListOffsets), or offset:N.
+func parseConsumeFrom(spec string) kgo.Offset {
+	kind, arg, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "earliest":
+		return kgo.NewOffset().AtStart()
+	case "latest":
+		return kgo.NewOffset().AtEnd()
+	case "timestamp":
+		ts, err := time.Parse(time.RFC3339Nano, arg)
+		chk(err, "invalid -consume-from timestamp %q: %v", arg, err)
+		return kgo.NewOffset().AfterMilli(ts.UnixMilli())
+	case "offset":
+		n, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil || n < 0 {
+			die("invalid -consume-from offset %q", arg)
+		}
+		return kgo.NewOffset().At(n)
+	default:
+		die("unrecognized -consume-from %q, expected earliest, latest, timestamp:RFC3339, or offset:N", spec)
+		return kgo.Offset{}
+	}
+}
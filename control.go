@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// serveControl serves a small HTTP API for hand-driving the workload while
+// it runs, e.g. during chaos experiments:
+//
+//	POST /rate         body: target produce records/s across all clients (0 is unlimited)
+//	POST /clients      body: number of clients to run
+//	POST /record-size  body: bytes per record (with -record-size sizing only)
+//	POST /pause
+//	POST /resume
+//	GET  /status       the current values as JSON
+func serveControl(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rate", controlInt(func(n int64) error {
+		if n < 0 {
+			return fmt.Errorf("rate must be non-negative")
+		}
+		atomic.StoreInt64(&live.rate, n)
+		return nil
+	}))
+	mux.HandleFunc("/clients", controlInt(func(n int64) error {
+		if n <= 0 {
+			return fmt.Errorf("number of clients must be positive; use /pause to stop the workload")
+		}
+		if store != nil || *assignPartitions {
+			return fmt.Errorf("the number of clients cannot change with -offset-store or -assign-partitions, which split partitions by client")
+		}
+		setClients(int(n))
+		return nil
+	}))
+	mux.HandleFunc("/record-size", controlInt(func(n int64) error {
+		if _, ok := valueSizer.(fixedSize); !ok || payloadTmpl != nil {
+			return fmt.Errorf("record size is only adjustable when sizing by -record-size")
+		}
+		if n <= 0 || n > int64(*maxBatchSize) {
+			return fmt.Errorf("record size must be within (0, %d]", *maxBatchSize)
+		}
+		atomic.StoreInt64(&live.recordSize, n)
+		return nil
+	}))
+	mux.HandleFunc("/pause", controlPost(func() { setPaused(true) }))
+	mux.HandleFunc("/resume", controlPost(func() { setPaused(false) }))
+	mux.HandleFunc("/status", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Rate       int64 `json:"rate"`
+			Clients    int64 `json:"clients"`
+			RecordSize int64 `json:"record_size"`
+			Paused     bool  `json:"paused"`
+		}{
+			atomic.LoadInt64(&live.rate),
+			atomic.LoadInt64(&live.clients),
+			atomic.LoadInt64(&live.recordSize),
+			atomic.LoadInt32(&live.paused) == 1,
+		})
+	})
+	go func() {
+		die("control server on %s failed: %v", addr, http.ListenAndServe(addr, mux))
+	}()
+}
+
+func controlPost(fn func()) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "POST required", http.StatusMethodNotAllowed)
+			return
+		}
+		fn()
+	}
+}
+
+// controlInt handles a POST whose body is a single integer.
+func controlInt(fn func(int64) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "POST required", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, 64))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(string(body)), 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid integer %q", body), http.StatusBadRequest)
+			return
+		}
+		if err := fn(n); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}
+}
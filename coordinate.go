@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Distributed runs: one host cannot saturate a large cluster, so a
+// coordinator (-coordinate) drives -workers processes started with
+// -worker-of, each running its own clients with the usual workload flags.
+// Workers register, are given their share of the coordinator's -rate and its
+// -duration, and start together once every worker is ready. Each worker
+// posts its per-interval counts to the coordinator, whose rate lines and
+// summary (and -assert flags) cover the whole fleet. Interrupting the
+// coordinator stops every worker.
+//
+//	POST /register  a worker joining; answers its assignment
+//	POST /ready     blocks until every worker is ready, then starts them
+//	POST /stats     one worker interval; answers whether to stop
+//	POST /done      a worker's final produce latencies
+
+// assignment is what the coordinator tells each worker at registration.
+type assignment struct {
+	Worker   int           `json:"worker"`
+	Rate     int64         `json:"rate"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+type workerStats struct {
+	Worker  int   `json:"worker"`
+	Records int64 `json:"records"`
+	Bytes   int64 `json:"bytes"`
+	Errors  int64 `json:"errors"`
+}
+
+type workerDone struct {
+	Worker  int           `json:"worker"`
+	Latency map[int]int64 `json:"latency_buckets"` // histogram bucket => count
+}
+
+// coordinator is the state of a -coordinate run.
+type coordinator struct {
+	mu         sync.Mutex
+	registered int
+	ready      int
+	start      chan struct{}         // closed once every worker is ready
+	done       map[int]chan struct{} // worker => closed once it finishes
+
+	stopping int32
+}
+
+// coordinate serves the coordinator API on addr and runs until every worker
+// finishes. It runs no clients of its own: each worker stands in for a
+// client as far as runWorkload is concerned.
+func coordinate(addr string, workers int) {
+	if workers <= 0 {
+		die("-coordinate requires a positive number of -workers")
+	}
+	// A worker's share of 0 would mean unlimited.
+	if *rate > 0 && *rate < int64(workers) {
+		die("-rate %d is less than one record/s per worker across %d -workers", *rate, workers)
+	}
+	c := &coordinator{
+		start: make(chan struct{}),
+		done:  make(map[int]chan struct{}),
+	}
+	for i := 0; i < workers; i++ {
+		c.done[i] = make(chan struct{})
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/register", func(w http.ResponseWriter, r *http.Request) {
+		c.mu.Lock()
+		idx := c.registered
+		c.registered++
+		c.mu.Unlock()
+		if idx >= workers {
+			http.Error(w, fmt.Sprintf("all %d workers are already registered", workers), http.StatusConflict)
+			return
+		}
+		// Any remainder of the rate goes to the lowest workers.
+		share := *rate / int64(workers)
+		if int64(idx) < *rate%int64(workers) {
+			share++
+		}
+		fmt.Fprintf(os.Stderr, "worker %d registered from %s\n", idx, r.RemoteAddr)
+		json.NewEncoder(w).Encode(assignment{Worker: idx, Rate: share, Duration: *runFor})
+	})
+	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
+		c.mu.Lock()
+		c.ready++
+		if c.ready == workers {
+			close(c.start)
+		}
+		c.mu.Unlock()
+		select {
+		case <-c.start:
+		case <-r.Context().Done():
+		}
+	})
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		var s workerStats
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		atomic.AddInt64(&rateRecs, s.Records)
+		atomic.AddInt64(&rateBytes, s.Bytes)
+		atomic.AddInt64(&totalErrs, s.Errors)
+		json.NewEncoder(w).Encode(struct {
+			Stop bool `json:"stop"`
+		}{atomic.LoadInt32(&c.stopping) == 1})
+	})
+	mux.HandleFunc("/done", func(w http.ResponseWriter, r *http.Request) {
+		var d workerDone
+		if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// A worker given up on is already summarized without.
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		done, ok := c.done[d.Worker]
+		if !ok {
+			return
+		}
+		for bucket, n := range d.Latency {
+			if bucket >= 0 && bucket < histBuckets {
+				atomic.AddInt64(&produceLat.counts[bucket], n)
+			}
+		}
+		close(done)
+		delete(c.done, d.Worker)
+	})
+	go func() {
+		die("coordinator on %s failed: %v", addr, http.ListenAndServe(addr, mux))
+	}()
+
+	fmt.Fprintf(os.Stderr, "coordinator waiting for %d workers on %s\n", workers, addr)
+	<-c.start
+	fmt.Fprintf(os.Stderr, "all %d workers ready, starting\n", workers)
+
+	*clients = workers
+	live.start = func(i int, stop <-chan struct{}) {
+		c.mu.Lock()
+		done := c.done[i]
+		c.mu.Unlock()
+		select {
+		case <-done:
+			return
+		case <-stop:
+		}
+		// Workers learn to stop on their next stats post, then finish.
+		// One that never does has exited or lost the coordinator, and is
+		// given up on rather than waited on forever.
+		atomic.StoreInt32(&c.stopping, 1)
+		select {
+		case <-done:
+		case <-time.After(*reportInterval + workerGrace):
+			c.giveUp(i)
+		}
+	}
+	go printRate()
+	runWorkload()
+}
+
+// workerGrace is how long, past its next stats post, a stopping worker has
+// to finish.
+const workerGrace = 30 * time.Second
+
+// giveUp stops waiting on worker i, reporting that the summary is missing
+// its final latencies.
+func (c *coordinator) giveUp(i int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.done[i]; !ok {
+		return // finished just in time
+	}
+	delete(c.done, i)
+	fmt.Fprintf(os.Stderr, "worker %d did not finish within %v of stopping; summarizing without its latencies\n", i, *reportInterval+workerGrace)
+}
+
+// workerClient is a -worker-of process's connection to its coordinator. It
+// is also a sink, forwarding every rate report to the coordinator.
+type workerClient struct {
+	base string
+	http *http.Client
+	self assignment
+
+	// Counts not yet accepted by the coordinator, retried with the next
+	// interval if a post fails.
+	pending  workerStats
+	lastErrs int64 // produceErrors as of the previous post
+}
+
+// joinCoordinator registers with the coordinator at addr, taking its share
+// of the rate and the run duration, and returns the sink that reports back.
+func joinCoordinator(addr string) *workerClient {
+	base := addr
+	if !strings.Contains(base, "://") {
+		base = "http://" + base
+	}
+	w := &workerClient{
+		base: strings.TrimSuffix(base, "/"),
+		http: &http.Client{Timeout: 5 * time.Second},
+	}
+	resp, err := http.Post(w.base+"/register", "application/json", nil)
+	chk(err, "unable to register with coordinator %s: %v", addr, err)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		die("coordinator %s rejected registration: %s", addr, resp.Status)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&w.self)
+	chk(err, "invalid registration response from coordinator %s: %v", addr, err)
+
+	*rate = w.self.Rate
+	*runFor = w.self.Duration
+	w.pending.Worker = w.self.Worker
+	seedWorker = w.self.Worker
+	fmt.Fprintf(os.Stderr, "registered as worker %d, rate %d records/s\n", w.self.Worker, w.self.Rate)
+	return w
+}
+
+// waitForStart blocks until every worker is ready.
+func (w *workerClient) waitForStart() {
+	resp, err := http.Post(w.base+"/ready", "application/json", nil)
+	chk(err, "unable to wait on coordinator: %v", err)
+	resp.Body.Close()
+}
+
+func (w *workerClient) write(_ time.Time, r report) {
+	switch r := r.(type) {
+	case *rateReport:
+		errs := atomic.LoadInt64(&produceErrors)
+		w.pending.Records += r.Records
+		w.pending.Bytes += r.Bytes
+		w.pending.Errors += r.errors() + errs - w.lastErrs
+		w.lastErrs = errs
+
+		var stop struct {
+			Stop bool `json:"stop"`
+		}
+		if err := w.post("/stats", w.pending, &stop); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to post stats to coordinator, retrying next interval: %v\n", err)
+			return
+		}
+		w.pending = workerStats{Worker: w.self.Worker}
+		if stop.Stop {
+			stopRun()
+		}
+
+	case *summaryReport:
+		d := workerDone{Worker: w.self.Worker, Latency: make(map[int]int64)}
+		if r.latency != nil {
+			for i, n := range r.latency.counts {
+				if n != 0 {
+					d.Latency[i] = n
+				}
+			}
+		}
+		if err := w.post("/done", d, nil); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to tell coordinator this worker is done: %v\n", err)
+		}
+	}
+}
+
+func (w *workerClient) post(path string, body, into interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	resp, err := w.http.Post(w.base+path, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("coordinator answered %s", resp.Status)
+	}
+	if into == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(into)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// Records cancelled by -produce-deadline, since the last report and over the
+// whole run. A cancelled record is one kgo gave up on before it was written
+// to a broker: it waited too long for buffer space (MaxBufferedRecords
+// backpressure) or in its partition's batch behind slow requests.
+var (
+	cancelledRecs  int64
+	totalCancelled int64
+)
+
+// produceRecord produces r, cancelling it if it is still buffered after
+// -produce-deadline, if set; kgo cannot cancel a record once it is written,
+// so a written record waits for its response however long. Records with a
+// -timestamp-mode timestamp measure latency from now rather than from their
+// timestamp.
+func produceRecord(client *kgo.Client, r *kgo.Record) {
+	if *checksums {
+		addChecksum(r)
+	}
+	promise := produced
+	if *poolRecords {
+		promise = producedPooled
+	}
+	if timestamps != nil {
+		start := time.Now()
+		promise = func(r *kgo.Record, err error) {
+			producedSince(start, r, err)
+			if *poolRecords {
+				recordPool.Put(r)
+			}
+		}
+	}
+	if *produceDeadline <= 0 {
+		client.Produce(context.Background(), r, promise)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *produceDeadline)
+	client.Produce(ctx, r, func(r *kgo.Record, err error) {
+		cancel()
+		promise(r, err)
+	})
+}
+
+// deadlineReport is the records cancelled by -produce-deadline over one
+// interval; the interval's acknowledged records are its rate.
+type deadlineReport struct {
+	Cancelled int64 `json:"cancelled"`
+	acked     int64
+}
+
+func swapDeadlineReport(acked int64) *deadlineReport {
+	r := &deadlineReport{Cancelled: atomic.SwapInt64(&cancelledRecs, 0), acked: acked}
+	atomic.AddInt64(&totalCancelled, r.Cancelled)
+	return r
+}
+
+func (r *deadlineReport) String() string {
+	var pct float64
+	if total := r.acked + r.Cancelled; total > 0 {
+		pct = 100 * float64(r.Cancelled) / float64(total)
+	}
+	return fmt.Sprintf("%d records cancelled at deadline (%0.2f%%)", r.Cancelled, pct)
+}
+
+func (r *deadlineReport) metrics() []metric {
+	return []metric{
+		{name: "produce_cancelled", value: float64(r.Cancelled), counter: true},
+	}
+}
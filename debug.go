@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	_ "net/http/pprof" // registers /debug/pprof on the default mux
+	"runtime"
+)
+
+// runtimeStats is a snapshot of the Go runtime, served as JSON on
+// /debug/runtime. Durations are in nanoseconds.
+type runtimeStats struct {
+	Goroutines    int      `json:"goroutines"`
+	HeapAlloc     uint64   `json:"heap_alloc_bytes"`
+	HeapInuse     uint64   `json:"heap_inuse_bytes"`
+	HeapObjects   uint64   `json:"heap_objects"`
+	Sys           uint64   `json:"sys_bytes"`
+	TotalAlloc    uint64   `json:"total_alloc_bytes"`
+	Mallocs       uint64   `json:"mallocs"`
+	NumGC         uint32   `json:"num_gc"`
+	GCCPUFraction float64  `json:"gc_cpu_fraction"`
+	PauseTotal    uint64   `json:"gc_pause_total_ns"`
+	RecentPauses  []uint64 `json:"gc_recent_pauses_ns"`
+}
+
+func readRuntimeStats() runtimeStats {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	s := runtimeStats{
+		Goroutines:    runtime.NumGoroutine(),
+		HeapAlloc:     ms.HeapAlloc,
+		HeapInuse:     ms.HeapInuse,
+		HeapObjects:   ms.HeapObjects,
+		Sys:           ms.Sys,
+		TotalAlloc:    ms.TotalAlloc,
+		Mallocs:       ms.Mallocs,
+		NumGC:         ms.NumGC,
+		GCCPUFraction: ms.GCCPUFraction,
+		PauseTotal:    ms.PauseTotalNs,
+	}
+
+	// PauseNs is a circular buffer; walk backwards from the most recent
+	// GC for however many pauses the buffer holds.
+	n := int(ms.NumGC)
+	if n > len(ms.PauseNs) {
+		n = len(ms.PauseNs)
+	}
+	for i := 0; i < n; i++ {
+		idx := (int(ms.NumGC) - 1 - i + len(ms.PauseNs)) % len(ms.PauseNs)
+		s.RecentPauses = append(s.RecentPauses, ms.PauseNs[idx])
+	}
+	return s
+}
+
+// serveDebug serves pprof (/debug/pprof/) and runtime stats
+// (/debug/runtime) on addr so that the generator itself can be profiled
+// when it, rather than the cluster, is the bottleneck.
+func serveDebug(addr string) {
+	http.HandleFunc("/debug/runtime", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(readRuntimeStats())
+	})
+	go func() {
+		die("debug server on %s failed: %v", addr, http.ListenAndServe(addr, nil))
+	}()
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// diagnostics collects what a post mortem of a failed overnight run needs,
+// for -diagnostics-dir: the last -diagnostics-log-lines of kgo logs, the
+// latest report of each kind, the flags, and the cluster's metadata, all
+// written to a new directory when the run dies or violates an -assert flag.
+type diagnostics struct {
+	dir       string
+	adminOpts []kgo.Opt
+
+	mu      sync.Mutex
+	lines   []string // ring of log lines
+	next    int
+	reports map[string]json.RawMessage // kind => latest
+
+	armed  int32 // set once flags are checked; usage errors do not dump
+	dumped int32
+}
+
+var diag *diagnostics
+
+// arm starts dumping on failures, once flags are checked, so that only the
+// run failing, not a bad command line, writes a bundle.
+func (d *diagnostics) arm() { atomic.StoreInt32(&d.armed, 1) }
+
+// dumping is whether failing now dumps.
+func (d *diagnostics) dumping() bool { return atomic.LoadInt32(&d.armed) == 1 }
+
+// secretFlags are flags whose values are redacted wherever flags are
+// recorded: credentials, and commands and paths yielding them.
+var secretFlags = map[string]bool{
+	"sasl-pass":          true,
+	"sasl-token-command": true,
+	"tls-key":            true,
+}
+
+// urlFlags are flags that may be URLs with credentials, which are redacted.
+var urlFlags = map[string]bool{
+	"push-results":        true,
+	"coordinate":          true,
+	"worker-of":           true,
+	"otlp-endpoint":       true,
+	"schema-registry-url": true,
+}
+
+// redactedFlag is f's value, fit to record.
+func redactedFlag(f *flag.Flag) string {
+	v := f.Value.String()
+	switch {
+	case v == "":
+	case secretFlags[f.Name]:
+		v = "(redacted)"
+	case urlFlags[f.Name]:
+		if u, err := url.Parse(v); err == nil && u.User != nil {
+			u.User = url.User("redacted")
+			v = u.String()
+		}
+	}
+	return v
+}
+
+func newDiagnostics(dir string, lines int) *diagnostics {
+	if lines <= 0 {
+		die("-diagnostics-log-lines must be positive")
+	}
+	return &diagnostics{dir: dir, lines: make([]string, 0, lines), reports: make(map[string]json.RawMessage)}
+}
+
+func (d *diagnostics) log(line string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.lines) < cap(d.lines) {
+		d.lines = append(d.lines, line)
+		return
+	}
+	d.lines[d.next] = line
+	d.next = (d.next + 1) % len(d.lines)
+}
+
+// write is the sink keeping the latest report of each kind.
+func (d *diagnostics) write(at time.Time, r report) {
+	b, err := json.Marshal(struct {
+		Time   time.Time `json:"time"`
+		Report report    `json:"report"`
+	}{at, r})
+	if err != nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.reports[r.kind()] = b
+}
+
+// ringLogger logs to the diagnostics ring at -diagnostics-log-level and to
+// the wrapped logger (if any) at its own level.
+type ringLogger struct {
+	inner kgo.Logger
+	level kgo.LogLevel
+}
+
+func (l ringLogger) Level() kgo.LogLevel {
+	if l.inner != nil && l.inner.Level() > l.level {
+		return l.inner.Level()
+	}
+	return l.level
+}
+
+func (l ringLogger) Log(level kgo.LogLevel, msg string, keyvals ...interface{}) {
+	if level <= l.level {
+		var b strings.Builder
+		fmt.Fprintf(&b, "%s [%s] %s", time.Now().Format(time.RFC3339Nano), level, msg)
+		for i := 0; i+1 < len(keyvals); i += 2 {
+			fmt.Fprintf(&b, "; %v: %v", keyvals[i], keyvals[i+1])
+		}
+		diag.log(b.String())
+	}
+	if l.inner != nil && level <= l.inner.Level() {
+		l.inner.Log(level, msg, keyvals...)
+	}
+}
+
+func parseLogLevel(level string) kgo.LogLevel {
+	switch strings.ToLower(level) {
+	case "debug":
+		return kgo.LogLevelDebug
+	case "info":
+		return kgo.LogLevelInfo
+	case "warn":
+		return kgo.LogLevelWarn
+	case "error":
+		return kgo.LogLevelError
+	}
+	die("unrecognized log level %s", level)
+	return kgo.LogLevelNone
+}
+
+// dump writes the bundle, once, printing where to stderr. Failing to write
+// part of it skips that part: the run is already failing.
+func (d *diagnostics) dump(reason string) {
+	if !atomic.CompareAndSwapInt32(&d.dumped, 0, 1) {
+		return
+	}
+	dir := filepath.Join(d.dir, "bkc-"+time.Now().Format("20060102-150405"))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		fmt.Fprintf(os.Stderr, "unable to create diagnostics directory %s: %v\n", dir, err)
+		return
+	}
+	write := func(name string, b []byte) {
+		if err := os.WriteFile(filepath.Join(dir, name), b, 0o644); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to write diagnostics %s: %v\n", name, err)
+		}
+	}
+
+	write("reason.txt", []byte(reason+"\n"))
+
+	d.mu.Lock()
+	lines := append(append([]string(nil), d.lines[d.next:]...), d.lines[:d.next]...)
+	var reports strings.Builder
+	for kind, r := range d.reports {
+		fmt.Fprintf(&reports, "{\"type\":%q,\"latest\":%s}\n", kind, r)
+	}
+	d.mu.Unlock()
+	write("kgo.log", []byte(strings.Join(lines, "\n")+"\n"))
+	write("reports.json", []byte(reports.String()))
+
+	var flags strings.Builder
+	flag.VisitAll(func(f *flag.Flag) {
+		fmt.Fprintf(&flags, "-%s=%s\n", f.Name, redactedFlag(f))
+	})
+	write("flags.txt", []byte(flags.String()))
+
+	if d.adminOpts != nil {
+		if b, err := d.metadata(); err == nil {
+			write("metadata.json", b)
+		} else {
+			write("metadata.json", []byte(fmt.Sprintf("{\"error\":%q}\n", err.Error())))
+		}
+	}
+	fmt.Fprintf(os.Stderr, "wrote diagnostics to %s\n", dir)
+}
+
+func (d *diagnostics) metadata() ([]byte, error) {
+	cl, err := kgo.NewClient(d.adminOpts...)
+	if err != nil {
+		return nil, err
+	}
+	defer cl.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	meta, err := kadm.NewClient(cl).Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(meta, "", "  ")
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+var (
+	txnCommits   int64
+	txnAborts    int64
+	txnCommitLat histogram
+)
+
+// eos runs a consume-transform-produce pipeline: every poll of -topic is
+// produced to -eos-topic and committed within one transaction. Only records
+// in committed transactions count toward the rate.
+func eos(idx int, opts []kgo.Opt, stop <-chan struct{}) {
+	sess, err := kgo.NewGroupTransactSession(append(opts[:len(opts):len(opts)],
+		kgo.TransactionalID(fmt.Sprintf("%s-%d", *txnID, idx)),
+		kgo.FetchIsolationLevel(kgo.ReadCommitted()),
+		kgo.RequireStableFetchOffsets(),
+	)...)
+	chk(err, "unable to initialize transact session: %v", err)
+	defer sess.Close()
+
+	var (
+		ctx      = stopContext(stop)
+		lastPoll time.Time
+	)
+	for waitUnpaused(stop) {
+		fetches := poll(ctx, sess, &lastPoll)
+		if ctx.Err() != nil {
+			return
+		}
+		fetches.EachError(func(t string, p int32, err error) {
+			die("fetch error on %s/%d: %v", t, p, err)
+		})
+		if fetches.NumRecords() == 0 {
+			continue
+		}
+
+		err := sess.Begin()
+		chk(err, "unable to begin transaction: %v", err)
+
+		// A failed produce aborts the rest of the transaction rather than
+		// the run; the abort is counted like any other.
+		e := kgo.AbortingFirstErrPromise(sess.Client())
+		var recs, bytes int64
+		fetches.EachRecord(func(r *kgo.Record) {
+			recs++
+			bytes += int64(len(r.Value))
+			sess.Produce(ctx, &kgo.Record{
+				Topic:   *eosTopic,
+				Key:     r.Key,
+				Value:   r.Value,
+				Headers: r.Headers,
+			}, e.Promise())
+		})
+
+		// Err waits for every record, so that only ending is timed.
+		produced := e.Err() == nil
+		start := time.Now()
+		committed, err := endTxn(sess, produced, stop)
+		chk(err, "unable to end transaction: %v", err)
+		if stopped(stop) {
+			return // ended by aborting, which is not the pipeline's doing
+		}
+		txnCommitLat.observe(time.Since(start))
+
+		if !committed {
+			atomic.AddInt64(&txnAborts, 1)
+			continue
+		}
+		atomic.AddInt64(&txnCommits, 1)
+		atomic.AddInt64(&rateRecs, recs)
+		atomic.AddInt64(&rateBytes, bytes)
+	}
+}
+
+// txnEndTimeout bounds ending a transaction.
+const txnEndTimeout = 30 * time.Second
+
+// txnEnder ends transactions, as a *kgo.GroupTransactSession does.
+type txnEnder interface {
+	End(ctx context.Context, commit kgo.TransactionEndTry) (bool, error)
+}
+
+// endTxn commits the transaction if every record was produced, or aborts
+// it. Ending runs on its own context rather than the run's, so that
+// stopping the run mid-transaction aborts the transaction rather than
+// failing to end it, which would leave it open to block read committed
+// consumers until it times out.
+func endTxn(sess txnEnder, produced bool, stop <-chan struct{}) (committed bool, err error) {
+	commit := kgo.TransactionEndTry(produced)
+	if stopped(stop) {
+		commit = kgo.TryAbort
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), txnEndTimeout)
+	defer cancel()
+	return sess.End(ctx, commit)
+}
+
+// txnReport is the transactions ended over one interval in -eos-topic mode.
+// Commit latency is the time End takes once every record of the transaction
+// is acknowledged, i.e. what a real pipeline pays per transaction on top of
+// producing.
+type txnReport struct {
+	Commits int64           `json:"commits"`
+	Aborts  int64           `json:"aborts"`
+	Latency *latencySummary `json:"commit_latency"`
+}
+
+func swapTxnReport() *txnReport {
+	return &txnReport{
+		Commits: atomic.SwapInt64(&txnCommits, 0),
+		Aborts:  atomic.SwapInt64(&txnAborts, 0),
+		Latency: txnCommitLat.interval().summary(),
+	}
+}
+
+func (r *txnReport) String() string {
+	return fmt.Sprintf("txn %d commits, %d aborts, commit %s", r.Commits, r.Aborts, r.Latency)
+}
+
+func (r *txnReport) metrics() []metric {
+	return append([]metric{
+		{name: "txn_commits", value: float64(r.Commits), counter: true},
+		{name: "txn_aborts", value: float64(r.Aborts), counter: true},
+	}, r.Latency.metrics("txn_commit_latency")...)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// fakeEnder records how a transaction was ended.
+type fakeEnder struct {
+	commit   kgo.TransactionEndTry
+	canceled bool
+}
+
+func (f *fakeEnder) End(ctx context.Context, commit kgo.TransactionEndTry) (bool, error) {
+	f.commit = commit
+	f.canceled = ctx.Err() != nil
+	return bool(commit), ctx.Err()
+}
+
+func TestEndTxn(t *testing.T) {
+	stoppedRun := make(chan struct{})
+	close(stoppedRun)
+
+	for _, test := range []struct {
+		name     string
+		produced bool
+		stop     chan struct{}
+		commit   kgo.TransactionEndTry
+	}{
+		{"produced", true, make(chan struct{}), kgo.TryCommit},
+		{"failed produce", false, make(chan struct{}), kgo.TryAbort},
+		{"stopped mid-transaction", true, stoppedRun, kgo.TryAbort},
+		{"stopped after a failed produce", false, stoppedRun, kgo.TryAbort},
+	} {
+		var f fakeEnder
+		committed, err := endTxn(&f, test.produced, test.stop)
+		if err != nil || f.canceled {
+			t.Errorf("%s: ended on a canceled context: %v", test.name, err)
+		}
+		if f.commit != test.commit || committed != bool(test.commit) {
+			t.Errorf("%s: ended with commit %v, expected %v", test.name, f.commit, test.commit)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// failoverChaos blackholes one seed broker at a time for -blackhole-for,
+// every -blackhole-every, rotating through -brokers: dials to the
+// blackholed address hang until they time out, and connections already open
+// to it are cut. Addresses are matched as dialed, so seeds that are brokers'
+// advertised addresses cut those brokers off entirely, while seeds behind
+// DNS or a load balancer only exercise bootstrapping from the others.
+type failoverChaos struct {
+	seeds []string
+
+	mu         sync.Mutex
+	blackholed string
+	until      time.Time
+	conns      map[string]map[net.Conn]struct{} // open connections by address
+
+	blackholes   int64 // since the last report
+	dialsBlocked int64
+	connsCut     int64
+	refreshes    int64
+}
+
+var failover = failoverChaos{conns: make(map[string]map[net.Conn]struct{})}
+
+// dialer wraps dial, blackholing and tracking connections.
+func (c *failoverChaos) dialer(dial func(ctx context.Context, network, host string) (net.Conn, error)) func(ctx context.Context, network, host string) (net.Conn, error) {
+	return func(ctx context.Context, network, host string) (net.Conn, error) {
+		c.mu.Lock()
+		blocked, until := c.blackholed == host, c.until
+		c.mu.Unlock()
+		if blocked {
+			atomic.AddInt64(&c.dialsBlocked, 1)
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(time.Until(until)):
+				return nil, fmt.Errorf("dial %s: blackholed", host)
+			}
+		}
+
+		conn, err := dial(ctx, network, host)
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.conns[host] == nil {
+			c.conns[host] = make(map[net.Conn]struct{})
+		}
+		tracked := &failoverConn{Conn: conn, host: host}
+		c.conns[host][tracked] = struct{}{}
+		return tracked, nil
+	}
+}
+
+// failoverConn forgets itself on close.
+type failoverConn struct {
+	net.Conn
+	host string
+	once sync.Once
+}
+
+func (c *failoverConn) Close() error {
+	c.once.Do(func() {
+		failover.mu.Lock()
+		delete(failover.conns[c.host], c)
+		failover.mu.Unlock()
+	})
+	return c.Conn.Close()
+}
+
+func (c *failoverChaos) rotate() {
+	tick := time.NewTicker(*blackholeEvery)
+	for i := 0; ; i++ {
+		<-tick.C
+		host := c.seeds[i%len(c.seeds)]
+
+		c.mu.Lock()
+		c.blackholed, c.until = host, time.Now().Add(*blackholeFor)
+		cut := make([]net.Conn, 0, len(c.conns[host]))
+		for conn := range c.conns[host] {
+			cut = append(cut, conn)
+		}
+		c.mu.Unlock()
+		atomic.AddInt64(&c.blackholes, 1)
+		atomic.AddInt64(&c.connsCut, int64(len(cut)))
+		for _, conn := range cut {
+			conn.Close()
+		}
+
+		time.Sleep(*blackholeFor)
+		c.mu.Lock()
+		c.blackholed = ""
+		c.mu.Unlock()
+	}
+}
+
+// refreshMetadata forces client to refresh metadata every
+// -metadata-refresh-every, as a metadata storm across many clients.
+func refreshMetadata(client *kgo.Client, stop <-chan struct{}) {
+	tick := time.NewTicker(*metadataRefreshEvery)
+	defer tick.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-tick.C:
+			client.ForceMetadataRefresh()
+			atomic.AddInt64(&failover.refreshes, 1)
+		}
+	}
+}
+
+// failoverReport is the blackholing and forced metadata refreshes over one
+// interval; its impact on producing is the rest of the same rate line.
+type failoverReport struct {
+	Blackholed   string `json:"blackholed,omitempty"`
+	Blackholes   int64  `json:"blackholes"`
+	DialsBlocked int64  `json:"dials_blocked"`
+	ConnsCut     int64  `json:"conns_cut"`
+	Refreshes    int64  `json:"metadata_refreshes"`
+}
+
+func (c *failoverChaos) swap() *failoverReport {
+	c.mu.Lock()
+	blackholed := c.blackholed
+	c.mu.Unlock()
+	return &failoverReport{
+		Blackholed:   blackholed,
+		Blackholes:   atomic.SwapInt64(&c.blackholes, 0),
+		DialsBlocked: atomic.SwapInt64(&c.dialsBlocked, 0),
+		ConnsCut:     atomic.SwapInt64(&c.connsCut, 0),
+		Refreshes:    atomic.SwapInt64(&c.refreshes, 0),
+	}
+}
+
+func (r *failoverReport) String() string {
+	line := fmt.Sprintf("failover %d forced metadata refreshes", r.Refreshes)
+	if r.Blackholed != "" {
+		line += ", blackholing " + r.Blackholed
+	}
+	return line + fmt.Sprintf(" (%d blackholes started, %d dials blocked, %d conns cut)", r.Blackholes, r.DialsBlocked, r.ConnsCut)
+}
+
+func (r *failoverReport) metrics() []metric {
+	blackholing := 0.0
+	if r.Blackholed != "" {
+		blackholing = 1
+	}
+	return []metric{
+		{name: "failover_metadata_refreshes", value: float64(r.Refreshes), counter: true},
+		{name: "failover_blackholes", value: float64(r.Blackholes), counter: true},
+		{name: "failover_dials_blocked", value: float64(r.DialsBlocked), counter: true},
+		{name: "failover_conns_cut", value: float64(r.ConnsCut), counter: true},
+		{name: "failover_blackholing", value: blackholing},
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// memberCounts is what one group member (client) consumed over the whole
+// run, for -report-fairness.
+type memberCounts struct {
+	group string
+	recs  int64
+	bytes int64
+}
+
+// members is every group member by client index. A restarted client keeps
+// adding to its index's counts.
+var members struct {
+	mu sync.Mutex
+	m  map[int]*memberCounts
+}
+
+// member returns client idx's counts, which are in group.
+func member(idx int, group string) *memberCounts {
+	members.mu.Lock()
+	defer members.mu.Unlock()
+	if members.m == nil {
+		members.m = make(map[int]*memberCounts)
+	}
+	c := members.m[idx]
+	if c == nil {
+		c = &memberCounts{group: group}
+		members.m[idx] = c
+	}
+	return c
+}
+
+func (c *memberCounts) consumed(recs, bytes int64) {
+	atomic.AddInt64(&c.recs, recs)
+	atomic.AddInt64(&c.bytes, bytes)
+}
+
+// fairnessReport is how evenly one group's members shared consuming over the
+// run. A balancer that assigns well has a coefficient of variation (stddev
+// over mean) near zero.
+type fairnessReport struct {
+	Group   string  `json:"group"`
+	Members int     `json:"members"`
+	Mean    float64 `json:"mean_records"`
+	Stddev  float64 `json:"stddev_records"`
+	CV      float64 `json:"cv_records"`
+	Min     int64   `json:"min_records"`
+	Max     int64   `json:"max_records"`
+	// The same over bytes, which differ from records with varying sizes.
+	BytesStddev float64 `json:"stddev_bytes"`
+	BytesCV     float64 `json:"cv_bytes"`
+}
+
+type fairnessReports []*fairnessReport
+
+// memberFairness computes fairness per group from every member's counts.
+func memberFairness() fairnessReports {
+	members.mu.Lock()
+	defer members.mu.Unlock()
+	byGroup := make(map[string][]*memberCounts)
+	for _, c := range members.m {
+		byGroup[c.group] = append(byGroup[c.group], c)
+	}
+
+	var rs fairnessReports
+	for group, cs := range byGroup {
+		recs := make([]float64, len(cs))
+		bytes := make([]float64, len(cs))
+		r := &fairnessReport{Group: group, Members: len(cs), Min: math.MaxInt64}
+		for i, c := range cs {
+			n := atomic.LoadInt64(&c.recs)
+			recs[i], bytes[i] = float64(n), float64(atomic.LoadInt64(&c.bytes))
+			r.Min, r.Max = min(r.Min, n), max(r.Max, n)
+		}
+		r.Mean, r.Stddev, r.CV = spread(recs)
+		_, r.BytesStddev, r.BytesCV = spread(bytes)
+		rs = append(rs, r)
+	}
+	sort.Slice(rs, func(i, j int) bool { return rs[i].Group < rs[j].Group })
+	return rs
+}
+
+// spread returns the mean, population standard deviation, and coefficient
+// of variation of vs.
+func spread(vs []float64) (mean, stddev, cv float64) {
+	for _, v := range vs {
+		mean += v
+	}
+	mean /= float64(len(vs))
+	for _, v := range vs {
+		stddev += (v - mean) * (v - mean)
+	}
+	stddev = math.Sqrt(stddev / float64(len(vs)))
+	if mean > 0 {
+		cv = stddev / mean
+	}
+	return mean, stddev, cv
+}
+
+func (r *fairnessReport) String() string {
+	return fmt.Sprintf("%s %d members, records per member mean %0.0f, stddev %0.0f (cv %0.3f), min %d, max %d; bytes cv %0.3f",
+		r.Group, r.Members, r.Mean, r.Stddev, r.CV, r.Min, r.Max, r.BytesCV)
+}
+
+func (rs fairnessReports) String() string {
+	parts := make([]string, 0, len(rs))
+	for _, r := range rs {
+		parts = append(parts, r.String())
+	}
+	return "fairness " + strings.Join(parts, "; ")
+}
+
+func (rs fairnessReports) metrics() []metric {
+	var ms []metric
+	for _, r := range rs {
+		labels := []string{"group", r.Group}
+		ms = append(ms,
+			metric{name: "summary_fairness_members", labels: labels, value: float64(r.Members)},
+			metric{name: "summary_fairness_stddev_records", labels: labels, value: r.Stddev},
+			metric{name: "summary_fairness_cv_records", labels: labels, value: r.CV},
+			metric{name: "summary_fairness_cv_bytes", labels: labels, value: r.BytesCV},
+		)
+	}
+	return ms
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// fanOut is -fan-out: each generated record is one logical record produced
+// as a copy to each of topics, as mirroring and duplication pipelines do.
+// Rate lines keep counting copies, what the cluster sees; the fan-out report
+// counts logical records, complete once their last copy is acknowledged, so
+// the two show the amplification and what it costs in latency.
+type fanOut struct {
+	topics []string // one per copy
+
+	logical      int64 // completed since the last report
+	logicalBytes int64
+	lat          histogram // until the last copy is acknowledged
+}
+
+var fanout *fanOut
+
+// parseFanOut parses -fan-out: a number of copies to produce to -topic, or a
+// comma delimited list of topics to produce a copy to each of.
+func parseFanOut(spec, topic string) *fanOut {
+	if n, err := strconv.Atoi(spec); err == nil {
+		if n < 1 {
+			die("-fan-out must be at least 1 copy")
+		}
+		if topic == "" {
+			die("a topic is required with -fan-out %d", n)
+		}
+		f := &fanOut{topics: make([]string, n)}
+		for i := range f.topics {
+			f.topics[i] = topic
+		}
+		return f
+	}
+	f := new(fanOut)
+	for _, t := range strings.Split(spec, ",") {
+		if t = strings.TrimSpace(t); t == "" {
+			die("invalid -fan-out %q, expected a number of copies or topics", spec)
+		}
+		f.topics = append(f.topics, t)
+	}
+	return f
+}
+
+// fanOutKey keys a copy's logical record in its context.
+type fanOutKey struct{}
+
+type fanOutRecord struct {
+	start time.Time
+	left  int32 // copies not yet acknowledged
+}
+
+// produce produces r's copies. Every copy is made before the first is
+// produced, since the client owns a record once it has it.
+func (f *fanOut) produce(client *kgo.Client, r *kgo.Record) {
+	ctx := context.WithValue(context.Background(), fanOutKey{}, &fanOutRecord{start: time.Now(), left: int32(len(f.topics))})
+	copies := make([]*kgo.Record, len(f.topics))
+	for i, t := range f.topics {
+		c := *r
+		c.Topic = t
+		c.Context = ctx
+		c.Headers = append([]kgo.RecordHeader(nil), r.Headers...)
+		copies[i] = &c
+	}
+	for _, c := range copies {
+		produceRecord(client, c)
+	}
+}
+
+// copied counts an acknowledged copy, completing its logical record with
+// the last. A logical record with a failed copy never completes.
+func (f *fanOut) copied(r *kgo.Record) {
+	if r.Context == nil {
+		return
+	}
+	l, ok := r.Context.Value(fanOutKey{}).(*fanOutRecord)
+	if !ok || atomic.AddInt32(&l.left, -1) != 0 {
+		return
+	}
+	f.lat.observe(time.Since(l.start))
+	atomic.AddInt64(&f.logical, 1)
+	atomic.AddInt64(&f.logicalBytes, int64(len(r.Value)))
+}
+
+// fanOutReport is the logical records completed over one interval.
+type fanOutReport struct {
+	Interval      time.Duration   `json:"interval_ns"`
+	Copies        int             `json:"copies"`
+	Logical       int64           `json:"logical_records"`
+	LogicalBytes  int64           `json:"logical_bytes"`
+	Amplification float64         `json:"amplification"` // bytes produced per logical byte
+	Latency       *latencySummary `json:"latency"`
+}
+
+func (f *fanOut) swap(interval time.Duration, bytes int64) *fanOutReport {
+	r := &fanOutReport{
+		Interval:     interval,
+		Copies:       len(f.topics),
+		Logical:      atomic.SwapInt64(&f.logical, 0),
+		LogicalBytes: atomic.SwapInt64(&f.logicalBytes, 0),
+		Latency:      f.lat.interval().summary(),
+	}
+	if r.LogicalBytes > 0 {
+		r.Amplification = float64(bytes) / float64(r.LogicalBytes)
+	}
+	return r
+}
+
+func (r *fanOutReport) String() string {
+	secs := r.Interval.Seconds()
+	return fmt.Sprintf("fan-out %dx: %0.2fk logical records/s, %0.2f MiB/s logical, %0.2fx amplification, all copies acked %s",
+		r.Copies, float64(r.Logical)/secs/1000, float64(r.LogicalBytes)/secs/(1024*1024), r.Amplification, r.Latency)
+}
+
+func (r *fanOutReport) metrics() []metric {
+	return append([]metric{
+		{name: "fanout_logical_records", value: float64(r.Logical), counter: true},
+		{name: "fanout_logical_bytes", value: float64(r.LogicalBytes), counter: true},
+		{name: "fanout_amplification", value: r.Amplification},
+	}, r.Latency.metrics("fanout_latency")...)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+)
+
+// clusterHealth is a -health-snapshot of the cluster, taken before and after
+// the run so that leadership movement and replication trouble during the run
+// show up in its results.
+type clusterHealth struct {
+	Phase           string           `json:"phase"`
+	Controller      int32            `json:"controller"`
+	Brokers         []int32          `json:"brokers"`
+	Partitions      int              `json:"partitions"`
+	Leaders         map[string]int   `json:"leaders"` // broker => partitions led
+	UnderReplicated []string         `json:"under_replicated,omitempty"`
+	Offline         []string         `json:"offline,omitempty"`
+	leaders         map[string]int32 // topic/partition => leader
+}
+
+// healthAdm is the admin client for -health-snapshot, and healthBefore the
+// snapshot of the cluster as the run started.
+var (
+	healthAdm    *kadm.Client
+	healthBefore *clusterHealth
+)
+
+// snapshotHealth describes every partition in the cluster. Snapshots only
+// observe the run, so a failed one is reported and skipped rather than
+// fatal.
+func snapshotHealth(adm *kadm.Client, phase string) *clusterHealth {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	meta, err := adm.Metadata(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to snapshot cluster health %s the run: %v\n", phase, err)
+		return nil
+	}
+
+	h := &clusterHealth{
+		Phase:      phase,
+		Controller: meta.Controller,
+		Brokers:    meta.Brokers.NodeIDs(),
+		Leaders:    make(map[string]int),
+		leaders:    make(map[string]int32),
+	}
+	for _, t := range meta.Topics.Sorted() {
+		for _, p := range t.Partitions.Sorted() {
+			tp := t.Topic + "/" + strconv.Itoa(int(p.Partition))
+			h.Partitions++
+			h.leaders[tp] = p.Leader
+			if p.Leader < 0 {
+				h.Offline = append(h.Offline, tp)
+				continue
+			}
+			h.Leaders[strconv.Itoa(int(p.Leader))]++
+			if len(p.ISR) < len(p.Replicas) {
+				h.UnderReplicated = append(h.UnderReplicated, tp)
+			}
+		}
+	}
+	return h
+}
+
+func (*clusterHealth) kind() string { return "health" }
+
+func (h *clusterHealth) String() string {
+	brokers := make([]string, 0, len(h.Brokers))
+	for _, b := range h.Brokers {
+		brokers = append(brokers, fmt.Sprintf("%d (%d led)", b, h.Leaders[strconv.Itoa(int(b))]))
+	}
+	line := fmt.Sprintf("health %s: controller %d; brokers %s; %d partitions, %d under-replicated, %d offline",
+		h.Phase, h.Controller, strings.Join(brokers, ", "), h.Partitions, len(h.UnderReplicated), len(h.Offline))
+	if len(h.UnderReplicated) > 0 {
+		line += "; under-replicated " + strings.Join(h.UnderReplicated, " ")
+	}
+	if len(h.Offline) > 0 {
+		line += "; offline " + strings.Join(h.Offline, " ")
+	}
+	return line
+}
+
+func (h *clusterHealth) metrics() []metric {
+	labels := []string{"phase", h.Phase}
+	ms := []metric{
+		{name: "health_brokers", labels: labels, value: float64(len(h.Brokers))},
+		{name: "health_partitions", labels: labels, value: float64(h.Partitions)},
+		{name: "health_under_replicated", labels: labels, value: float64(len(h.UnderReplicated))},
+		{name: "health_offline", labels: labels, value: float64(len(h.Offline))},
+	}
+	for b, n := range h.Leaders {
+		ms = append(ms, metric{name: "health_leaders", labels: []string{"phase", h.Phase, "broker", b}, value: float64(n)})
+	}
+	return ms
+}
+
+// healthDiff is what changed in the cluster between the snapshots before and
+// after the run, for the final summary.
+type healthDiff struct {
+	BrokersJoined   []int32        `json:"brokers_joined,omitempty"`
+	BrokersLeft     []int32        `json:"brokers_left,omitempty"`
+	LeadersMoved    int            `json:"leaders_moved"`
+	LeaderChange    map[string]int `json:"leader_change,omitempty"` // broker => change in partitions led
+	UnderReplicated int            `json:"under_replicated_change"`
+	Offline         int            `json:"offline_change"`
+	ControllerMoved bool           `json:"controller_moved,omitempty"`
+}
+
+func diffHealth(before, after *clusterHealth) *healthDiff {
+	d := &healthDiff{
+		LeaderChange:    make(map[string]int),
+		UnderReplicated: len(after.UnderReplicated) - len(before.UnderReplicated),
+		Offline:         len(after.Offline) - len(before.Offline),
+		ControllerMoved: before.Controller != after.Controller,
+	}
+	d.BrokersJoined = missing(after.Brokers, before.Brokers)
+	d.BrokersLeft = missing(before.Brokers, after.Brokers)
+	for tp, leader := range after.leaders {
+		if was, ok := before.leaders[tp]; ok && was != leader {
+			d.LeadersMoved++
+		}
+	}
+	for b, n := range after.Leaders {
+		if delta := n - before.Leaders[b]; delta != 0 {
+			d.LeaderChange[b] = delta
+		}
+	}
+	for b, n := range before.Leaders {
+		if _, ok := after.Leaders[b]; !ok {
+			d.LeaderChange[b] = -n
+		}
+	}
+	return d
+}
+
+// missing returns the ids in have that are not in of.
+func missing(have, of []int32) []int32 {
+	var m []int32
+	for _, id := range have {
+		found := false
+		for _, other := range of {
+			found = found || id == other
+		}
+		if !found {
+			m = append(m, id)
+		}
+	}
+	return m
+}
+
+func (d *healthDiff) String() string {
+	parts := []string{fmt.Sprintf("%d leaders moved", d.LeadersMoved)}
+	if len(d.LeaderChange) > 0 {
+		brokers := make([]string, 0, len(d.LeaderChange))
+		for b := range d.LeaderChange {
+			brokers = append(brokers, b)
+		}
+		sort.Strings(brokers)
+		var changes []string
+		for _, b := range brokers {
+			changes = append(changes, fmt.Sprintf("%s %+d", b, d.LeaderChange[b]))
+		}
+		parts = append(parts, "leaders per broker "+strings.Join(changes, ", "))
+	}
+	if d.ControllerMoved {
+		parts = append(parts, "controller moved")
+	}
+	if len(d.BrokersJoined) > 0 {
+		parts = append(parts, fmt.Sprintf("brokers joined %v", d.BrokersJoined))
+	}
+	if len(d.BrokersLeft) > 0 {
+		parts = append(parts, fmt.Sprintf("brokers left %v", d.BrokersLeft))
+	}
+	parts = append(parts, fmt.Sprintf("under-replicated %+d, offline %+d", d.UnderReplicated, d.Offline))
+	return "cluster " + strings.Join(parts, ", ")
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+// histBuckets covers every non-negative int64: values below 64 get their own
+// bucket, and every power of two above that is split into 32 buckets, so any
+// recorded value is within ~3% of the bucket it lands in.
+const histBuckets = 59*32 + 32
+
+// histogram is a lock free latency histogram, safe for concurrent use.
+type histogram struct {
+	counts [histBuckets]int64
+}
+
+func histBucket(v int64) int {
+	if v < 64 {
+		if v < 0 {
+			return 0
+		}
+		return int(v)
+	}
+	shift := bits.Len64(uint64(v)) - 6
+	return shift*32 + int(v>>uint(shift))
+}
+
+// histValue returns the midpoint of the values that land in bucket idx.
+func histValue(idx int) int64 {
+	if idx < 64 {
+		return int64(idx)
+	}
+	shift := uint(idx/32 - 1)
+	top := int64(idx%32 + 32)
+	return top<<shift + (int64(1)<<shift)/2
+}
+
+func (h *histogram) observe(d time.Duration) {
+	atomic.AddInt64(&h.counts[histBucket(int64(d))], 1)
+}
+
+// observeValue records a value that is not a duration, such as a size.
+func (h *histogram) observeValue(v int64) {
+	atomic.AddInt64(&h.counts[histBucket(v)], 1)
+}
+
+// swap returns everything observed since the previous swap and resets the
+// histogram, for windowed (per interval) percentiles.
+func (h *histogram) swap() *histSnapshot {
+	s := new(histSnapshot)
+	for i := range h.counts {
+		if h.counts[i] != 0 {
+			s.counts[i] = atomic.SwapInt64(&h.counts[i], 0)
+			s.total += s.counts[i]
+		}
+	}
+	return s
+}
+
+// snapshot returns everything observed so far without resetting, for
+// callers diffing snapshots while something else owns swapping.
+func (h *histogram) snapshot() *histSnapshot {
+	s := new(histSnapshot)
+	for i := range h.counts {
+		if n := atomic.LoadInt64(&h.counts[i]); n != 0 {
+			s.counts[i] = n
+			s.total += n
+		}
+	}
+	return s
+}
+
+// sub returns what was observed between prev and s.
+func (s *histSnapshot) sub(prev *histSnapshot) *histSnapshot {
+	d := new(histSnapshot)
+	for i := range s.counts {
+		d.counts[i] = s.counts[i] - prev.counts[i]
+	}
+	d.total = s.total - prev.total
+	return d
+}
+
+type histSnapshot struct {
+	counts [histBuckets]int64
+	total  int64
+}
+
+// quantile returns the value at q, within [0, 1].
+func (s *histSnapshot) quantile(q float64) time.Duration {
+	if s.total == 0 {
+		return 0
+	}
+	want := int64(q*float64(s.total) + 0.5)
+	if want < 1 {
+		want = 1
+	}
+	var seen int64
+	for i, c := range s.counts {
+		seen += c
+		if seen >= want {
+			return time.Duration(histValue(i))
+		}
+	}
+	return time.Duration(histValue(histBuckets - 1))
+}
+
+func (s *histSnapshot) max() time.Duration {
+	for i := histBuckets - 1; i >= 0; i-- {
+		if s.counts[i] != 0 {
+			return time.Duration(histValue(i))
+		}
+	}
+	return 0
+}
+
+// latencySummary is the handful of percentiles reports carry.
+type latencySummary struct {
+	Count int64         `json:"count"`
+	P50   time.Duration `json:"p50_ns"`
+	P90   time.Duration `json:"p90_ns"`
+	P99   time.Duration `json:"p99_ns"`
+	P999  time.Duration `json:"p999_ns"`
+	Max   time.Duration `json:"max_ns"`
+}
+
+func (s *histSnapshot) summary() *latencySummary {
+	return &latencySummary{
+		Count: s.total,
+		P50:   s.quantile(0.5),
+		P90:   s.quantile(0.9),
+		P99:   s.quantile(0.99),
+		P999:  s.quantile(0.999),
+		Max:   s.max(),
+	}
+}
+
+func (l *latencySummary) String() string {
+	r := func(d time.Duration) time.Duration {
+		switch {
+		case d >= time.Second:
+			return d.Round(time.Millisecond)
+		case d >= time.Millisecond:
+			return d.Round(10 * time.Microsecond)
+		default:
+			return d.Round(time.Microsecond)
+		}
+	}
+	return fmt.Sprintf("p50 %v, p90 %v, p99 %v, p99.9 %v, max %v", r(l.P50), r(l.P90), r(l.P99), r(l.P999), r(l.Max))
+}
+
+// metrics returns the summary as gauges named prefix_p50_seconds and so on.
+func (l *latencySummary) metrics(prefix string, labels ...string) []metric {
+	return []metric{
+		{name: prefix + "_p50_seconds", labels: labels, value: l.P50.Seconds()},
+		{name: prefix + "_p90_seconds", labels: labels, value: l.P90.Seconds()},
+		{name: prefix + "_p99_seconds", labels: labels, value: l.P99.Seconds()},
+		{name: prefix + "_p999_seconds", labels: labels, value: l.P999.Seconds()},
+		{name: prefix + "_max_seconds", labels: labels, value: l.Max.Seconds()},
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// Connection counts for -idle, across clients: open is a gauge, everything
+// else is since the last report.
+var idleStats struct {
+	open        int64
+	dials       int64
+	dialErrors  int64
+	disconnects int64
+	reconnects  int64
+}
+
+// idleConns is one -idle client's connection hook. A client opens several
+// connections per broker (one per kind of request), so a reconnect is any
+// dial to a broker this client has had a connection to it closed on.
+type idleConns struct {
+	mu     sync.Mutex
+	closed map[int32]int // node => disconnects not yet redialed
+}
+
+func newIdleConns() *idleConns {
+	return &idleConns{closed: make(map[int32]int)}
+}
+
+func (c *idleConns) OnBrokerConnect(meta kgo.BrokerMetadata, _ time.Duration, _ net.Conn, err error) {
+	if err != nil {
+		atomic.AddInt64(&idleStats.dialErrors, 1)
+		return
+	}
+	atomic.AddInt64(&idleStats.open, 1)
+	atomic.AddInt64(&idleStats.dials, 1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed[meta.NodeID] > 0 {
+		c.closed[meta.NodeID]--
+		atomic.AddInt64(&idleStats.reconnects, 1)
+	}
+}
+
+func (c *idleConns) OnBrokerDisconnect(meta kgo.BrokerMetadata, _ net.Conn) {
+	atomic.AddInt64(&idleStats.open, -1)
+	atomic.AddInt64(&idleStats.disconnects, 1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed[meta.NodeID]++
+}
+
+// idle connects client to every broker and holds its connections open until
+// stopped, producing a trickle if there is a -rate. With -idle-ping, every
+// broker is sent an ApiVersions request that often, which keeps connections
+// from idling out: -idle raises kgo's idle timeout to its maximum of 15
+// minutes, and brokers close connections idle for connections.max.idle.ms,
+// 10 minutes by default. Without pings, the report shows when they do.
+func idle(client *kgo.Client, rng *rand.Rand, stop <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	touch := func() {
+		meta, err := kmsg.NewPtrMetadataRequest().RequestWith(ctx, client)
+		if err != nil {
+			return // dial errors are counted by the hook
+		}
+		for _, b := range meta.Brokers {
+			kmsg.NewPtrApiVersionsRequest().RequestWith(ctx, client.Broker(int(b.NodeID)))
+		}
+	}
+	touch()
+
+	if *idlePing > 0 {
+		go func() {
+			tick := time.NewTicker(*idlePing)
+			defer tick.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-tick.C:
+					touch()
+				}
+			}
+		}()
+	}
+
+	if atomic.LoadInt64(&live.rate) > 0 {
+		produce(client, nil, rng, stop)
+		return
+	}
+	<-stop
+}
+
+// idleReport is the connections -idle clients hold, as of one interval.
+type idleReport struct {
+	Open        int64 `json:"open_conns"`
+	Dials       int64 `json:"dials"`
+	DialErrors  int64 `json:"dial_errors"`
+	Disconnects int64 `json:"disconnects"`
+	Reconnects  int64 `json:"reconnects"`
+}
+
+func swapIdleReport() *idleReport {
+	return &idleReport{
+		Open:        atomic.LoadInt64(&idleStats.open),
+		Dials:       atomic.SwapInt64(&idleStats.dials, 0),
+		DialErrors:  atomic.SwapInt64(&idleStats.dialErrors, 0),
+		Disconnects: atomic.SwapInt64(&idleStats.disconnects, 0),
+		Reconnects:  atomic.SwapInt64(&idleStats.reconnects, 0),
+	}
+}
+
+func (r *idleReport) String() string {
+	return fmt.Sprintf("idle %d open conns; %d dials, %d dial errors, %d disconnects, %d reconnects",
+		r.Open, r.Dials, r.DialErrors, r.Disconnects, r.Reconnects)
+}
+
+func (r *idleReport) metrics() []metric {
+	return []metric{
+		{name: "idle_open_conns", value: float64(r.Open)},
+		{name: "idle_dials", value: float64(r.Dials), counter: true},
+		{name: "idle_dial_errors", value: float64(r.DialErrors), counter: true},
+		{name: "idle_disconnects", value: float64(r.Disconnects), counter: true},
+		{name: "idle_reconnects", value: float64(r.Reconnects), counter: true},
+	}
+}
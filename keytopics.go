@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// keyTopics is -key-topics: every record goes to the topic its key hashes
+// to, out of -topic-0 through -topic-N-1, the way multi-tenant pipelines
+// give each tenant (key) a topic of its own. Records without a key get one
+// of -key-space keys at random, so that each topic sees a steady set of
+// tenants; -hot-partition-pct's hot key then makes one topic hot.
+type keyTopics struct {
+	names  []string
+	index  map[string]int // name => index into names and counts
+	counts []keyTopicCounts
+}
+
+type keyTopicCounts struct {
+	records int64 // since the last report
+	bytes   int64
+}
+
+var byKey *keyTopics
+
+func newKeyTopics(topic string, n int) *keyTopics {
+	if n < 1 {
+		die("-key-topics must be positive")
+	}
+	if topic == "" {
+		die("-key-topics names its topics after -topic, so a topic is required")
+	}
+	if *keySpace < 1 {
+		die("-key-space must be positive")
+	}
+	t := &keyTopics{names: make([]string, n), index: make(map[string]int, n), counts: make([]keyTopicCounts, n)}
+	for i := range t.names {
+		t.names[i] = topic + "-" + strconv.Itoa(i)
+		t.index[t.names[i]] = i
+	}
+	return t
+}
+
+// route sets r's topic from its key, giving it a key first if it has none.
+func (t *keyTopics) route(r *kgo.Record, rng *rand.Rand) {
+	if r.Key == nil {
+		r.Key = strconv.AppendInt([]byte("key-"), rng.Int63n(*keySpace), 10)
+	}
+	h := fnv.New32a()
+	h.Write(r.Key)
+	r.Topic = t.names[h.Sum32()%uint32(len(t.names))]
+}
+
+// produced counts a record acknowledged from its topic.
+func (t *keyTopics) produced(r *kgo.Record) {
+	if i, ok := t.index[r.Topic]; ok {
+		atomic.AddInt64(&t.counts[i].records, 1)
+		atomic.AddInt64(&t.counts[i].bytes, int64(len(r.Value)))
+	}
+}
+
+// keyTopicsReport is how evenly the topics were produced to over one
+// interval; per topic counts go to metric sinks only, as there may be
+// hundreds.
+type keyTopicsReport struct {
+	Interval time.Duration    `json:"interval_ns"`
+	Topics   []keyTopicRecord `json:"topics"`
+}
+
+type keyTopicRecord struct {
+	Topic   string `json:"topic"`
+	Records int64  `json:"records"`
+	Bytes   int64  `json:"bytes"`
+}
+
+func (t *keyTopics) swap(interval time.Duration) *keyTopicsReport {
+	r := &keyTopicsReport{Interval: interval, Topics: make([]keyTopicRecord, len(t.names))}
+	for i, name := range t.names {
+		r.Topics[i] = keyTopicRecord{
+			Topic:   name,
+			Records: atomic.SwapInt64(&t.counts[i].records, 0),
+			Bytes:   atomic.SwapInt64(&t.counts[i].bytes, 0),
+		}
+	}
+	return r
+}
+
+func (r *keyTopicsReport) String() string {
+	lo, hi := int64(math.MaxInt64), int64(0)
+	var busiest string
+	for _, t := range r.Topics {
+		lo = min(lo, t.Records)
+		if t.Records > hi {
+			hi, busiest = t.Records, t.Topic
+		}
+	}
+	secs := r.Interval.Seconds()
+	line := fmt.Sprintf("%d key topics, per topic min %0.2fk records/s, max %0.2fk records/s", len(r.Topics), float64(lo)/secs/1000, float64(hi)/secs/1000)
+	if busiest != "" {
+		line += " (" + busiest + ")"
+	}
+	return line
+}
+
+func (r *keyTopicsReport) metrics() []metric {
+	ms := make([]metric, 0, 2*len(r.Topics))
+	for _, t := range r.Topics {
+		labels := []string{"topic", t.Topic}
+		ms = append(ms,
+			metric{name: "topic_records", labels: labels, value: float64(t.Records), counter: true},
+			metric{name: "topic_bytes", labels: labels, value: float64(t.Bytes), counter: true},
+		)
+	}
+	return ms
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// runLabels is every -label: key=value pairs describing the run (cluster,
+// build, experiment), attached to every metric, every json sink report, and
+// the summary, so that results from many runs can be told apart once they
+// land in one place.
+var runLabels labelFlag
+
+// resultsAdminOpts are the options to ask the cluster its id with, for
+// -push-results.
+var resultsAdminOpts []kgo.Opt
+
+// labelFlag is a repeatable flag of key=value pairs, each also allowed to be
+// comma delimited, which is how it prints so that -scenario stages get the
+// same labels.
+type labelFlag struct {
+	keys []string
+	vals map[string]string
+}
+
+func (l *labelFlag) String() string {
+	kvs := make([]string, 0, len(l.keys))
+	for _, k := range l.keys {
+		kvs = append(kvs, k+"="+l.vals[k])
+	}
+	return strings.Join(kvs, ",")
+}
+
+func (l *labelFlag) Set(spec string) error {
+	for _, kv := range strings.Split(spec, ",") {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			return fmt.Errorf("invalid label %q, expected key=value", kv)
+		}
+		if l.vals == nil {
+			l.vals = make(map[string]string)
+		}
+		if _, dup := l.vals[k]; !dup {
+			l.keys = append(l.keys, k)
+		}
+		l.vals[k] = v
+	}
+	return nil
+}
+
+// labelMap is the labels for JSON, or nil without any.
+func (l *labelFlag) labelMap() map[string]string {
+	if len(l.keys) == 0 {
+		return nil
+	}
+	return l.vals
+}
+
+// labeled appends the run's labels to every metric's own.
+func labeled(ms []metric) []metric {
+	if len(runLabels.keys) == 0 {
+		return ms
+	}
+	for i := range ms {
+		labels := ms[i].labels[:len(ms[i].labels):len(ms[i].labels)]
+		for _, k := range runLabels.keys {
+			labels = append(labels, k, runLabels.vals[k])
+		}
+		ms[i].labels = labels
+	}
+	return ms
+}
+
+// pushedResults is what -push-results posts: the summary, with what is
+// needed to compare it against other runs.
+type pushedResults struct {
+	Labels    map[string]string `json:"labels,omitempty"`
+	Host      string            `json:"host"`
+	Started   time.Time         `json:"started"`
+	Build     string            `json:"build"` // vcs revision, or the module version
+	GoVersion string            `json:"go_version"`
+	ClusterID string            `json:"cluster_id,omitempty"`
+	Flags     map[string]string `json:"flags"` // those set on the command line
+	Summary   *summaryReport    `json:"summary"`
+}
+
+// pushResults posts the summary as JSON to url, for a central results
+// store. A failed push fails the run, as a run whose results are lost is
+// usually a run to repeat.
+func pushResults(url string, adminOpts []kgo.Opt, started time.Time, r *summaryReport) {
+	p := &pushedResults{
+		Labels:    runLabels.labelMap(),
+		Started:   started,
+		GoVersion: runtime.Version(),
+		Flags:     make(map[string]string),
+		Summary:   r,
+	}
+	p.Host, _ = os.Hostname()
+	if info, ok := debug.ReadBuildInfo(); ok {
+		p.Build = info.Main.Version
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" {
+				p.Build = s.Value
+			}
+		}
+	}
+	flag.Visit(func(f *flag.Flag) {
+		p.Flags[f.Name] = redactedFlag(f)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if adminOpts != nil {
+		if cl, err := kgo.NewClient(adminOpts...); err == nil {
+			if meta, err := kadm.NewClient(cl).BrokerMetadata(ctx); err == nil {
+				p.ClusterID = meta.Cluster
+			}
+			cl.Close()
+		}
+	}
+
+	body, err := json.Marshal(p)
+	chk(err, "unable to encode results: %v", err)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	chk(err, "invalid -push-results url %q: %v", url, err)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	chk(err, "unable to push results to %s: %v", url, err)
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		die("unable to push results to %s: %s: %s", url, resp.Status, strings.TrimSpace(string(msg)))
+	}
+}
+
+// labelsString is the labels for the summary line, sorted.
+func labelsString(labels map[string]string) string {
+	kvs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		kvs = append(kvs, k+"="+v)
+	}
+	sort.Strings(kvs)
+	return strings.Join(kvs, ",")
+}
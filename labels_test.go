@@ -0,0 +1,44 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLabelFlag(t *testing.T) {
+	for _, test := range []struct {
+		sets   []string
+		str    string
+		labels map[string]string
+		err    bool
+	}{
+		{nil, "", nil, false},
+		{[]string{"a=1"}, "a=1", map[string]string{"a": "1"}, false},
+		{[]string{"a=1,b=2", "c="}, "a=1,b=2,c=", map[string]string{"a": "1", "b": "2", "c": ""}, false},
+		{[]string{"b=1", "a=2", "b=3"}, "b=3,a=2", map[string]string{"a": "2", "b": "3"}, false},
+		{[]string{"a=b=c"}, "a=b=c", map[string]string{"a": "b=c"}, false},
+		{[]string{"a"}, "", nil, true},
+		{[]string{"=1"}, "", nil, true},
+	} {
+		var l labelFlag
+		var err error
+		for _, set := range test.sets {
+			if err = l.Set(set); err != nil {
+				break
+			}
+		}
+		if gotErr := err != nil; gotErr != test.err {
+			t.Errorf("%q: got err %v, expected err? %v", test.sets, err, test.err)
+			continue
+		}
+		if test.err {
+			continue
+		}
+		if str := l.String(); str != test.str {
+			t.Errorf("%q: got %q, expected %q", test.sets, str, test.str)
+		}
+		if labels := l.labelMap(); !reflect.DeepEqual(labels, test.labels) {
+			t.Errorf("%q: got labels %v, expected %v", test.sets, labels, test.labels)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+)
+
+// printLag prints, every interval, how far the group's committed offsets
+// trail the end of each partition it consumes. Lag only observes the run, so
+// a failed query is reported and retried on the next tick rather than fatal.
+func printLag(adm *kadm.Client, group string, interval time.Duration) {
+	for range time.Tick(interval) {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		lags, err := adm.Lag(ctx, group)
+		cancel()
+		if err == nil {
+			err = lags.Error()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to query lag for group %s: %v\n", group, err)
+			continue
+		}
+
+		r := &lagReport{Group: group, Total: lags[group].Lag.Total()}
+		for _, pl := range lags[group].Lag.Sorted() {
+			p := partitionLag{Topic: pl.Topic, Partition: pl.Partition, Lag: pl.Lag}
+			if pl.Err != nil {
+				p.Err = pl.Err.Error()
+			}
+			r.Partitions = append(r.Partitions, p)
+		}
+		emit(r)
+	}
+}
+
+// lagReport is one lag query: how far the group's commits trail the end of
+// each partition.
+type lagReport struct {
+	Group      string         `json:"group"`
+	Total      int64          `json:"total"`
+	Partitions []partitionLag `json:"partitions"`
+}
+
+type partitionLag struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Lag       int64  `json:"lag"`
+	Err       string `json:"error,omitempty"`
+}
+
+func (*lagReport) kind() string { return "lag" }
+
+func (r *lagReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "lag %d", r.Total)
+	for _, p := range r.Partitions {
+		if p.Err != "" {
+			fmt.Fprintf(&b, "; %s/%d error: %s", p.Topic, p.Partition, p.Err)
+			continue
+		}
+		fmt.Fprintf(&b, "; %s/%d %d", p.Topic, p.Partition, p.Lag)
+	}
+	return b.String()
+}
+
+func (r *lagReport) metrics() []metric {
+	ms := []metric{{name: "group_lag_total", labels: []string{"group", r.Group}, value: float64(r.Total)}}
+	for _, p := range r.Partitions {
+		if p.Err != "" {
+			continue
+		}
+		ms = append(ms, metric{
+			name:   "group_lag",
+			labels: []string{"group", r.Group, "topic", p.Topic, "partition", strconv.Itoa(int(p.Partition))},
+			value:  float64(p.Lag),
+		})
+	}
+	return ms
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// leaderTracker is, for every partition, the broker its produce batches
+// were last written to: its leader, as far as produce knows. kgo does not
+// say which broker acknowledged a record, so reports attributing records to
+// brokers look the leader up here.
+type leaderTracker struct {
+	mu      sync.RWMutex
+	leaders map[topicPartition]int32
+}
+
+// produceLeaders is the leaders as of the latest batch written by any
+// client, for -report-routing, -report-latency-breakdown, and
+// -latency-samples-file.
+var produceLeaders = newLeaderTracker()
+
+func newLeaderTracker() *leaderTracker {
+	return &leaderTracker{leaders: make(map[topicPartition]int32)}
+}
+
+func (t *leaderTracker) OnProduceBatchWritten(meta kgo.BrokerMetadata, topic string, partition int32, _ kgo.ProduceBatchMetrics) {
+	t.wrote(topicPartition{topic, partition}, meta.NodeID)
+}
+
+// wrote records a batch for tp written to node, returning the broker the
+// previous batch went to if it was another.
+func (t *leaderTracker) wrote(tp topicPartition, node int32) (from int32, moved bool) {
+	t.mu.RLock()
+	prev, known := t.leaders[tp]
+	t.mu.RUnlock()
+	if known && prev == node {
+		return 0, false
+	}
+	t.mu.Lock()
+	prev, known = t.leaders[tp]
+	t.leaders[tp] = node
+	t.mu.Unlock()
+	return prev, known && prev != node
+}
+
+// leader is tp's leader, if a batch has been written to it.
+func (t *leaderTracker) leader(tp topicPartition) (int32, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	node, ok := t.leaders[tp]
+	return node, ok
+}
+
+// led is how many partitions each broker leads.
+func (t *leaderTracker) led() map[int32]int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	led := make(map[int32]int)
+	for _, node := range t.leaders {
+		led[node]++
+	}
+	return led
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/metrics"
+	"sync"
+	"time"
+)
+
+// leakWatch samples the generator's own live heap, goroutines, and buffered
+// records every -leak-watch over a run, for the summary to flag any that
+// only ever grow. Multi-hour soaks are where client-side leaks show, and
+// growth that slow is invisible in rate lines.
+//
+// Samples are noisy (the heap saws between GCs, buffers fill and drain), so
+// a series counts as growing when the minimum of each of the last four of
+// five equal windows exceeds the one before, and by -leak-growth overall.
+// Minimums ride out spikes, and the first window, warming up, is left out.
+type leakWatch struct {
+	mu       sync.Mutex
+	samples  []leakSample
+	buffered bool // whether producers' buffered records are sampled
+	stopped  bool // once the run is stopping, which would look like shrinking
+}
+
+type leakSample struct {
+	heap       uint64 // live bytes as of the last GC
+	goroutines int
+	buffered   int64
+}
+
+var leaks *leakWatch
+
+var liveHeapMetric = []metrics.Sample{{Name: "/gc/heap/live:bytes"}}
+
+func watchLeaks(every time.Duration, buffered bool) *leakWatch {
+	w := &leakWatch{buffered: buffered}
+	w.sample()
+	go func() {
+		for range time.Tick(every) {
+			w.sample()
+		}
+	}()
+	return w
+}
+
+func (w *leakWatch) sample() {
+	var s leakSample
+	metrics.Read(liveHeapMetric)
+	if liveHeapMetric[0].Value.Kind() == metrics.KindUint64 {
+		s.heap = liveHeapMetric[0].Value.Uint64()
+	}
+	s.goroutines = runtime.NumGoroutine()
+	if w.buffered {
+		s.buffered = buffered(0).Records
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.stopped {
+		w.samples = append(w.samples, s)
+	}
+}
+
+// stop ends sampling as the run stops.
+func (w *leakWatch) stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stopped = true
+}
+
+// leakWindows is how many windows samples are split into, the first being
+// warmup; a verdict needs at least two samples per window.
+const leakWindows = 5
+
+// leakSeries is one sampled quantity over the run.
+type leakSeries struct {
+	First   float64 `json:"first"`
+	Last    float64 `json:"last"`
+	Growing bool    `json:"growing"`
+}
+
+// leakSeriesOf judges the quantity value takes from each sample.
+func leakSeriesOf(samples []leakSample, value func(leakSample) float64, growth float64) *leakSeries {
+	s := &leakSeries{First: value(samples[0]), Last: value(samples[len(samples)-1])}
+	if len(samples) < 2*leakWindows {
+		return s
+	}
+	mins := make([]float64, leakWindows)
+	for i := range mins {
+		window := samples[i*len(samples)/leakWindows : (i+1)*len(samples)/leakWindows]
+		mins[i] = value(window[0])
+		for _, sample := range window[1:] {
+			mins[i] = min(mins[i], value(sample))
+		}
+	}
+	s.Growing = true
+	for i := 2; i < leakWindows; i++ {
+		if mins[i] <= mins[i-1] {
+			s.Growing = false
+		}
+	}
+	s.Growing = s.Growing && mins[leakWindows-1] >= mins[1]*(1+growth)
+	return s
+}
+
+// leakReport is the leak watch over the whole run.
+type leakReport struct {
+	Samples    int         `json:"samples"`
+	Heap       *leakSeries `json:"heap_bytes"`
+	Goroutines *leakSeries `json:"goroutines"`
+	Buffered   *leakSeries `json:"buffered_records,omitempty"`
+}
+
+func (w *leakWatch) report(growth float64) *leakReport {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	r := &leakReport{
+		Samples:    len(w.samples),
+		Heap:       leakSeriesOf(w.samples, func(s leakSample) float64 { return float64(s.heap) }, growth),
+		Goroutines: leakSeriesOf(w.samples, func(s leakSample) float64 { return float64(s.goroutines) }, growth),
+	}
+	if w.buffered {
+		r.Buffered = leakSeriesOf(w.samples, func(s leakSample) float64 { return float64(s.buffered) }, growth)
+	}
+	return r
+}
+
+// growing names the series that grew.
+func (r *leakReport) growing() []string {
+	var names []string
+	if r.Heap.Growing {
+		names = append(names, "heap")
+	}
+	if r.Goroutines.Growing {
+		names = append(names, "goroutines")
+	}
+	if r.Buffered != nil && r.Buffered.Growing {
+		names = append(names, "buffered records")
+	}
+	return names
+}
+
+func (r *leakReport) String() string {
+	verdict := func(s *leakSeries) string {
+		if s.Growing {
+			return " GROWING"
+		}
+		return ""
+	}
+	line := fmt.Sprintf("leak watch over %d samples: heap %0.2f to %0.2f MiB%s, goroutines %0.0f to %0.0f%s",
+		r.Samples, r.Heap.First/(1024*1024), r.Heap.Last/(1024*1024), verdict(r.Heap),
+		r.Goroutines.First, r.Goroutines.Last, verdict(r.Goroutines))
+	if r.Buffered != nil {
+		line += fmt.Sprintf(", buffered records %0.0f to %0.0f%s", r.Buffered.First, r.Buffered.Last, verdict(r.Buffered))
+	}
+	if r.Samples < 2*leakWindows {
+		line += fmt.Sprintf(" (too few samples to judge; need %d)", 2*leakWindows)
+	}
+	return line
+}
+
+func (r *leakReport) metrics() []metric {
+	ms := r.Heap.metrics("summary_leak_heap_bytes")
+	ms = append(ms, r.Goroutines.metrics("summary_leak_goroutines")...)
+	if r.Buffered != nil {
+		ms = append(ms, r.Buffered.metrics("summary_leak_buffered_records")...)
+	}
+	return ms
+}
+
+func (s *leakSeries) metrics(name string) []metric {
+	var growing float64
+	if s.Growing {
+		growing = 1
+	}
+	return []metric{
+		{name: name + "_last", value: s.Last},
+		{name: name + "_growing", value: growing},
+	}
+}
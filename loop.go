@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// partitionLoops is partitions -loop-consume sent back since the last report.
+var partitionLoops int64
+
+// looper sends each partition a consumer reaches the end of back to
+// -loop-from, so that sustained read tests keep reading once the topic is
+// exhausted. Partitions loop on their own: a partition ends once a fetch
+// returns its last record below the high watermark, and small partitions
+// loop more often than big ones. Transaction markers and aborted records
+// sit below the high watermark without ever being returned, so a partition
+// whose records stop short of it has also ended once a fetch returns
+// nothing more from it, or once fetches go quiet.
+type looper struct {
+	client *kgo.Client
+	adm    *kadm.Client
+	from   int64 // unix millis to loop back to, or -1 for the start
+
+	short map[topicPartition]bool // last records ended below the high watermark
+}
+
+// parseLoopFrom parses -loop-from: earliest, or timestamp:RFC3339.
+func parseLoopFrom(spec string) int64 {
+	if spec == "earliest" {
+		return -1
+	}
+	if ts, ok := strings.CutPrefix(spec, "timestamp:"); ok {
+		at, err := time.Parse(time.RFC3339Nano, ts)
+		chk(err, "invalid -loop-from timestamp %q: %v", ts, err)
+		return at.UnixMilli()
+	}
+	die("unrecognized -loop-from %q, expected earliest or timestamp:RFC3339", spec)
+	return 0
+}
+
+func newLooper(client *kgo.Client) *looper {
+	return &looper{client: client, adm: kadm.NewClient(client), from: parseLoopFrom(*loopFrom), short: make(map[topicPartition]bool)}
+}
+
+// quiet is how long polls may go without fetches before every partition
+// left short of its high watermark is taken to have ended: long enough for
+// a fetch to wait out -fetch-max-wait twice over.
+func (l *looper) quiet() time.Duration {
+	wait := *fetchMaxWait
+	if wait == 0 {
+		wait = 5 * time.Second // kgo's default
+	}
+	return 2*wait + time.Second
+}
+
+// fetched loops the partitions fetches finished. It runs between polls, as
+// SetOffsets requires when consuming in a group.
+func (l *looper) fetched(ctx context.Context, fetches kgo.Fetches) {
+	var ended []topicPartition
+	fetches.EachPartition(func(p kgo.FetchTopicPartition) {
+		tp := topicPartition{p.Topic, p.Partition}
+		if len(p.Records) == 0 {
+			// kgo returns a partition without records when the
+			// broker had none past its offset, or only markers.
+			if p.Err == nil && l.short[tp] {
+				ended = append(ended, tp)
+			}
+			return
+		}
+		if last := p.Records[len(p.Records)-1]; last.Offset+1 >= p.HighWatermark {
+			ended = append(ended, tp)
+		} else {
+			l.short[tp] = true
+		}
+	})
+	l.loop(ctx, ended)
+}
+
+// quieted loops every partition left short of its high watermark, after
+// polls went quiet for as long as quiet.
+func (l *looper) quieted(ctx context.Context) {
+	ended := make([]topicPartition, 0, len(l.short))
+	for tp := range l.short {
+		ended = append(ended, tp)
+	}
+	l.loop(ctx, ended)
+}
+
+// loop sends ended partitions back. If their offsets cannot be listed, they
+// are retried once polls next go quiet.
+func (l *looper) loop(ctx context.Context, ended []topicPartition) {
+	if len(ended) == 0 {
+		return
+	}
+	var topics []string
+	seen := make(map[string]bool)
+	for _, tp := range ended {
+		delete(l.short, tp)
+		if !seen[tp.topic] {
+			seen[tp.topic] = true
+			topics = append(topics, tp.topic)
+		}
+	}
+
+	var listed kadm.ListedOffsets
+	var err error
+	if l.from < 0 {
+		listed, err = l.adm.ListStartOffsets(ctx, topics...)
+	} else {
+		listed, err = l.adm.ListOffsetsAfterMilli(ctx, l.from, topics...)
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "loop: unable to list offsets to loop back to, retrying once idle: %v\n", err)
+		for _, tp := range ended {
+			l.short[tp] = true
+		}
+		return
+	}
+
+	set := make(map[string]map[int32]kgo.EpochOffset)
+	for _, tp := range ended {
+		o, ok := listed.Lookup(tp.topic, tp.partition)
+		if !ok || o.Err != nil {
+			if ok {
+				fmt.Fprintf(os.Stderr, "loop: unable to list %s/%d's offset to loop back to, retrying once idle: %v\n", tp.topic, tp.partition, o.Err)
+			}
+			l.short[tp] = true
+			continue
+		}
+		if o.Offset >= 0 {
+			if set[tp.topic] == nil {
+				set[tp.topic] = make(map[int32]kgo.EpochOffset)
+			}
+			set[tp.topic][tp.partition] = kgo.EpochOffset{Epoch: -1, Offset: o.Offset}
+			atomic.AddInt64(&partitionLoops, 1)
+		}
+	}
+	l.client.SetOffsets(set)
+}
+
+// loopReport is the partitions sent back over one interval.
+type loopReport struct {
+	Loops int64 `json:"loops"`
+}
+
+func swapLoopReport() *loopReport {
+	return &loopReport{Loops: atomic.SwapInt64(&partitionLoops, 0)}
+}
+
+func (r *loopReport) String() string {
+	return fmt.Sprintf("%d partitions looped", r.Loops)
+}
+
+func (r *loopReport) metrics() []metric {
+	return []metric{{name: "partition_loops", value: float64(r.Loops), counter: true}}
+}
@@ -2,34 +2,215 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
+	"math/rand"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
-	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/twmb/franz-go/pkg/kadm"
 	"github.com/twmb/franz-go/pkg/kgo"
 )
 
 var (
-	brokers      = flag.String("brokers", "localhost:9092", "comma delimited list of seed brokers")
-	topic        = flag.String("topic", "", "topic to produce to or consume from")
-	clients      = flag.Int("num-clients", 1, "how many instances of client workload to run")
-	recordSize   = flag.Int("record-size", 100, "bytes per record")
-	compression  = flag.String("compression", "none", "compression algorithm to use (none,gzip,snappy,lz4,zstd, for producing)")
-	linger       = flag.Duration("linger", 0, "if non-zero, linger to use when producing")
-	maxBatchSize = flag.Int("max-batch-size", 1000000, "the maximum batch size to allow per-partition")
-	logLevel     = flag.String("log-level", "", "if non-empty, use a basic logger with this log level (debug, info, warn, error)")
+	brokers          = flag.String("brokers", "localhost:9092", "comma delimited list of seed brokers")
+	topic            = flag.String("topic", "", "topic to produce to or consume from")
+	preloadSize      = flag.String("preload", "", "if non-empty, first write this much data (e.g. 10GiB) into -topic as fast as possible, then start the measured workload")
+	clients          = flag.Int("num-clients", 1, "how many instances of client workload to run")
+	recordSize       = flag.Int("record-size", 100, "bytes per record")
+	recordSizeMix    = flag.String("record-size-mix", "", "if non-empty, weighted sizes to interleave within each producer instead of -record-size, e.g. 95:200,5:500k (weight:bytes)")
+	recordSizeDist   = flag.String("record-size-dist", "", "if non-empty, the distribution to draw record sizes from instead of -record-size: fixed, uniform:MIN-MAX, lognormal:MEAN,STDDEV, or histogram:FILE (lines of \"bytes weight\")")
+	compression      = flag.String("compression", "none", "compression algorithm to use (none,gzip,snappy,lz4,zstd, for producing), optionally with a level as codec:level, e.g. zstd:3 or lz4:9; a comma delimited list splits clients between codecs to compare them")
+	linger           = flag.Duration("linger", 0, "if non-zero, linger to use when producing")
+	seed             = flag.Int64("seed", 0, "if non-zero, seed every random choice (record sizes, keys and skew, templated and schema payloads, -process-time, -pause-every) so that runs with the same flags generate the same records, for fair A/B comparisons; otherwise a seed is picked and reported in the summary")
+	syncProduce      = flag.Bool("sync-produce", false, "if true, produce in a closed loop: each client produces -sync-batch records with ProduceSync and waits for all of them before producing more, to measure request-response producing rather than a full pipeline")
+	syncBatch        = flag.Int("sync-batch", 1, "for -sync-produce, how many records each ProduceSync call produces")
+	chaosPct         = flag.Float64("chaos-records", 0, "if non-zero, the percentage of generated records to replace with records brokers should reject (see -chaos-kinds), through a separate client, counting their rejections apart from real errors")
+	chaosKinds       = flag.String("chaos-kinds", "oversize,headers", "for -chaos-records, comma delimited kinds to pick between: oversize (a -chaos-record-bytes record) or headers (a record with a null header key)")
+	chaosBytes       = flag.String("chaos-record-bytes", "2MiB", "for -chaos-records, the size of oversize records; set it just over the topic's max.message.bytes")
+	tailLatency      = flag.Bool("tail-latency", false, "if true, tail -topic with an in-process consumer while producing at a low -rate, and report each record's delivery latency from produce to poll (-fetch-max-wait and -fetch-min-bytes apply to the tail consumer)")
+	keyTopicCount    = flag.Int("key-topics", 0, "if non-zero, produce each record to one of this many topics, -topic-0 through -topic-N-1, picked by hashing its key, for the traffic of many tenants with one topic each (the topics must exist or be auto created)")
+	keySpace         = flag.Int64("key-space", 10000, "for -key-topics, how many distinct keys (tenants) records without a key are given at random")
+	fanOutSpec       = flag.String("fan-out", "", "if non-empty, produce each record as several copies, to measure amplification: a number of copies to -topic, or a comma delimited list of topics to copy each record to, as mirroring pipelines do (-rate counts records before fan-out)")
+	workloadSpec     = flag.String("workloads", "", "if non-empty, semicolon delimited producer workloads that clients take turns running, each name:key=value,... overriding topic, linger, batch (max batch bytes), and compression, e.g. latency:topic=orders,linger=0;bulk:topic=logs,linger=50ms,batch=1MiB,compression=zstd")
+	maxBuffered      = flag.String("max-buffered-bytes", "", "if non-empty, the most record bytes (keys, values, and headers) each producer buffers awaiting acknowledgement before producing blocks, e.g. 256MiB (default 50MiB, enforced by record count)")
+	maxBatchSize     = flag.Int("max-batch-size", 1000000, "the maximum batch size to allow per-partition")
+	maxInflight      = flag.Int("max-produce-inflight-per-broker", 0, "if non-zero, the produce requests allowed in flight per broker; above 1 disables idempotency, which otherwise caps this at 1 (or 5 on newer brokers)")
+	requestTimeout   = flag.Duration("request-timeout", 0, "if non-zero, the time allowed for each request to be written and read, on top of any timeout within the request itself")
+	produceDeadline  = flag.Duration("produce-deadline", 0, "if non-zero, cancel any record still buffered (waiting for buffer space, or in a batch not yet written to a broker) this long after producing it, counting cancelled records rather than failing; records already written wait for their response and -produce-timeout as usual")
+	produceTimeout   = flag.Duration("produce-timeout", 0, "if non-zero, how long brokers are allowed to take to respond to produce requests (the request's timeout)")
+	dialTimeout      = flag.Duration("dial-timeout", 10*time.Second, "how long to allow dialing a broker, including any TLS handshake")
+	connIdleTimeout  = flag.Duration("conn-idle-timeout", 0, "if non-zero, roughly how long connections may idle before the client closes them (kgo's default is 20s; -idle's is 15m)")
+	brokerMaxWrite   = flag.String("broker-max-write-bytes", "", "if non-empty, the largest produce request to write to a broker, e.g. 200MiB (kgo's default is 100MiB, matching brokers' socket.request.max.bytes)")
+	brokerMaxRead    = flag.String("broker-max-read-bytes", "", "if non-empty, the largest response to read from a broker, e.g. 200MiB (kgo's default is 100MiB; raise it with -fetch-max-bytes)")
+	socketSendBuffer = flag.String("socket-send-buffer", "", "if non-empty, the SO_SNDBUF to set on broker connections, e.g. 4MiB, for high bandwidth-delay links (capped by the kernel's net.core.wmem_max)")
+	socketRecvBuffer = flag.String("socket-recv-buffer", "", "if non-empty, the SO_RCVBUF to set on broker connections before connecting, e.g. 4MiB, for high bandwidth-delay links (capped by the kernel's net.core.rmem_max)")
+	retryBackoff     = flag.Duration("retry-backoff", 0, "if non-zero, a fixed backoff between request retries instead of the default jittered exponential backoff")
+	logLevel         = flag.String("log-level", "", "if non-empty, use a basic logger with this log level (debug, info, warn, error)")
+	rate             = flag.Int64("rate", 0, "if non-zero, the target records/s to produce across all clients")
+	clientIDTemplate = flag.String("client-id-template", "", "if non-empty, the client id for each client, e.g. bench-%d or bench-{host}-{n}; {n} or %d is the client index, {host} the hostname, {pid} the process id")
+	clientLib        = flag.String("client-lib", "franz-go", "client library to drive the workload with: franz-go, or sarama if built with -tags sarama")
+
+	targetP99        = flag.Duration("target-p99", 0, "if non-zero, search for the most load (see -target-adjust) whose p99 produce latency stays within this, hold it, and report the operating point found")
+	targetThroughput = flag.String("target-throughput", "", "if non-empty, search for the least load (see -target-adjust) that reaches this throughput, e.g. 1GiB/s or 500000records/s, hold it, and report the operating point found")
+	targetAdjust     = flag.String("target-adjust", "clients", "for -target-p99 and -target-throughput, what to adjust: clients (starting from -num-clients) or rate (starting from -rate)")
+	targetSettle     = flag.Duration("target-settle", 5*time.Second, "for -target-p99 and -target-throughput, how long to let each step settle before measuring it")
+	targetWindow     = flag.Duration("target-window", 10*time.Second, "for -target-p99 and -target-throughput, how long to measure each step")
+	targetMaxClients = flag.Int("target-max-clients", 256, "for -target-adjust clients, the most clients to try")
+
+	autoBackoffOn   = flag.Bool("auto-backoff", false, "if true, halve -rate while throttling or produce errors exceed the -backoff thresholds, then probe back up once healthy")
+	backoffThrottle = flag.Duration("backoff-throttle", 100*time.Millisecond, "for -auto-backoff, the broker throttle time per second above which to back off")
+	backoffErrors   = flag.Float64("backoff-errors", 0.01, "for -auto-backoff, the fraction of records failing to produce above which to back off")
+	backoffWindow   = flag.Duration("backoff-window", 5*time.Second, "for -auto-backoff, how long thresholds must be exceeded (or healthy) before cutting (or raising) the rate")
+
+	assignPartitions = flag.Bool("assign-partitions", false, "if true, each client produces only to its own partitions, those whose number modulo -num-clients is its index (round robin between them), and throughput is reported per partition")
+
+	timestampSpec   = flag.String("timestamp-mode", "now", "timestamps to give produced records: now, fixed:RFC3339, skew:DURATION (now shifted into the past or future, e.g. skew:-72h), or monotonic:STEP (each producer's n'th record at the start plus n steps)")
+	hotPartitionPct = flag.Float64("hot-partition-pct", 0, "if non-zero, the percentage of produced records given -hot-key, so that they all land on one partition (hot partition skew)")
+	hotKey          = flag.String("hot-key", "hot", "for -hot-partition-pct, the key of hot records, which decides the hot partition")
+
+	valueTemplate  = flag.String("value-template", "", "if non-empty, a JSON template (or @file) to render record values from instead of -record-size filler; placeholders: {{seq}} {{int:MIN-MAX}} {{str:N}} {{choice:a|b}} {{now}}")
+	schemaRegistry = flag.String("schema-registry-url", "", "if non-empty, the Schema Registry to register -value-schema with")
+	valueSchema    = flag.String("value-schema", "", "if non-empty, an Avro (.avsc, JSON) or Protobuf (.proto, scalar fields only) schema file to register and produce random Confluent wire format values of, instead of -record-size filler")
+	schemaSubject  = flag.String("schema-subject", "", "the subject to register -value-schema under (default -topic with -value appended)")
+
+	keyField = flag.String("key-field", "", "if non-empty, the (dot separated) -value-template field whose value is used as the record key")
+
+	consumeMode             = flag.Bool("consume", false, "if true, consume from the topic rather than produce to it")
+	consumeFrom             = flag.String("consume-from", "earliest", "where to start consuming partitions without a committed (or stored) offset: earliest, latest, timestamp:RFC3339, or offset:N")
+	loopConsume             = flag.Bool("loop-consume", false, "if true, send each partition back to -loop-from once consumed to its end, repeating for the whole run so sustained read tests do not stall on an exhausted topic")
+	resetOffsetsTo          = flag.String("reset-offsets", "", "if non-empty, before the run commit -group's offsets for every partition of -topic to earliest, latest, or timestamp:RFC3339 (the first record at or after it), so repeated runs start from a known position; the group must have no members")
+	loopFrom                = flag.String("loop-from", "earliest", "for -loop-consume, where partitions go back to: earliest, or timestamp:RFC3339")
+	consumePartitions       = flag.String("consume-partitions", "", "if non-empty, consume exactly these partitions without a group instead of -topic, e.g. t:0@earliest,t:3@12345 (offset is earliest, latest, or exact); every client consumes all of them")
+	group                   = flag.String("group", "", "if non-empty, consumer group to consume in (requires -consume)")
+	groupInstanceIDTemplate = flag.String("group-instance-id", "", "if non-empty, a static group membership (KIP-345) instance id for each client, templated like -client-id-template, e.g. bench-{host}-{n}")
+	bounceEvery             = flag.Duration("bounce-every", 0, "if non-zero, how often to restart a group member (the highest indexed client, as -rebalance-every does), down for -bounce-for, reporting whether the group rebalanced (with -group-instance-id it should not)")
+	bounceFor               = flag.Duration("bounce-for", 5*time.Second, "for -bounce-every, how long each member stays down; keep it within the session timeout to avoid rebalancing static members")
+	rack                    = flag.String("rack", "", "if non-empty, the rack to consume from, for brokers to point consumers at an in-rack follower (KIP-392, with replica.selector.class set); reports which replica served each partition's fetches and how many bytes stayed in the rack")
+	fetchMaxBytes           = flag.Int("fetch-max-bytes", 0, "if non-zero, the maximum bytes a broker may return per fetch when consuming")
+	fetchMaxPartitionBytes  = flag.Int("fetch-max-partition-bytes", 0, "if non-zero, the maximum bytes a broker may return per partition per fetch when consuming")
+	fetchMaxWait            = flag.Duration("fetch-max-wait", 0, "if non-zero, how long a broker may wait for -fetch-min-bytes before answering a fetch")
+	fetchMinBytes           = flag.Int("fetch-min-bytes", 0, "if non-zero, the minimum bytes a broker should accumulate before answering a fetch")
+	maxPollRecords          = flag.Int("max-poll-records", 0, "if non-zero, the most records to take per poll when consuming (like max.poll.records)")
+	pollInterval            = flag.Duration("poll-interval", 0, "if non-zero, the minimum time between polls when consuming, to emulate a slow poll loop")
+	processTimeSpec         = flag.String("process-time", "", "if non-empty, how long each consumed record takes to process before the next poll, to emulate downstream work: a duration, uniform:MIN-MAX, or lognormal:MEAN,STDDEV (clamped to 100x the mean)")
+	processCPU              = flag.Bool("process-cpu", false, "for -process-time, spin the CPU for the processing time instead of sleeping")
+	historicalLag           = flag.Int64("historical-lag", 0, "if non-zero, report throughput and fetch latency separately for historical reads (partitions more than this many records behind their high watermark, e.g. from tiered storage) and tail reads")
+	poolRecords             = flag.Bool("pool-records", false, "if true, reuse produced records and their values once acknowledged instead of allocating each one, for when GC limits throughput at high client counts (see -report-allocs)")
+	metadataRefreshEvery    = flag.Duration("metadata-refresh-every", 0, "if non-zero, how often every client forces a metadata refresh, to demonstrate metadata load from many clients")
+	blackholeEvery          = flag.Duration("blackhole-every", 0, "if non-zero, how often to blackhole the next -brokers seed in turn for -blackhole-for: dials to it hang and its open connections are cut, to show client failover")
+	blackholeFor            = flag.Duration("blackhole-for", 10*time.Second, "for -blackhole-every, how long each seed stays blackholed")
+	pauseEvery              = flag.Duration("pause-every", 0, "if non-zero, how often each consumer pauses fetching a random -pause-fraction of its partitions, to simulate slow processing, reporting fetch request sizes (showing how fetch sessions cope) and heap in use alongside")
+	pauseFraction           = flag.Float64("pause-fraction", 0.25, "for -pause-every, the fraction of partitions to pause each time")
+	pauseFor                = flag.Duration("pause-for", time.Second, "for -pause-every, how long partitions stay paused")
+	commitMode              = flag.String("commit-mode", "auto", "how group consumers commit: auto, sync, async, or none")
+	commitEvery             = flag.Int("commit-every", 0, "for sync/async -commit-mode, commit after this many records (0 with no -commit-interval commits every poll)")
+	commitInterval          = flag.Duration("commit-interval", 0, "if non-zero, the autocommit interval, or for sync/async -commit-mode, the longest to go between commits")
+	balancerSpec            = flag.String("balancers", "", "if non-empty, comma delimited group balancers (range, roundrobin, sticky, cooperative-sticky) to compare: each gets its own group, -group-<balancer>, clients take turns joining each, and partition pauses during rebalances are reported per balancer")
+	reportFairness          = flag.Bool("report-fairness", false, "if true, count what each group member consumes and summarize how evenly members shared the work (stddev and coefficient of variation across members, per -balancers group)")
+	rebalanceEvery          = flag.Duration("rebalance-every", 0, "if non-zero, restart one client per -balancers group this often to force rebalances")
+	healthSnapshot          = flag.Bool("health-snapshot", false, "if true, snapshot brokers, partition leadership, and under-replicated and offline partitions before and after the run, and summarize what changed")
+	reportLag               = flag.Duration("report-lag", 0, "if non-zero, how often to query and print per-partition lag of -group")
+	offsetStorePath         = flag.String("offset-store", "", "if non-empty, consume without a group and keep positions in this file instead of committing to Kafka (written every -commit-interval, default 1s), verifying on restart that consumption resumes at the stored positions")
+
+	eosTopic = flag.String("eos-topic", "", "if non-empty, consume -topic in -group and transactionally produce every record to this topic (exactly-once pipeline)")
+	txnID    = flag.String("txn-id", "big-kafka-conn", "transactional id prefix for -eos-topic; each client appends its index")
+
+	replayPath    = flag.String("replay", "", "if non-empty, produce the records in this file (or directory of files, in name order) instead of generating them, keeping keys and headers; JSON lines or -capture files")
+	replayTiming  = flag.Bool("replay-timing", false, "if true, replay records with the same gaps between them as their original timestamps")
+	capturePath   = flag.String("capture", "", "if non-empty, write every consumed record (key, value, headers, timestamp, partition, offset) to this file for -replay or offline analysis")
+	captureFormat = flag.String("capture-format", "capture", "format of -capture files: capture (binary, preserves any bytes) or json (one record per line)")
+
+	idleMode = flag.Bool("idle", false, "if true, connect every client to every broker and hold the connections open, producing nothing (or a trickle of -rate), reporting disconnects and reconnects: a connection count scalability test")
+	idlePing = flag.Duration("idle-ping", time.Minute, "for -idle, how often each client sends every broker a request to keep its connections from idling out; 0 never does")
+
+	rawProduceMode  = flag.Bool("raw-produce", false, "if true, build Produce requests and record batches directly with kmsg instead of producing through kgo (protocol experiments)")
+	rawBatchRecords = flag.Int("raw-batch-records", 100, "records per batch in -raw-produce mode")
+	rawMangle       = flag.String("raw-mangle", "", "comma delimited ways to deliberately break -raw-produce batches: crc, length, count, offset-delta, magic, timestamp, empty")
+
+	uiMode           = flag.Bool("ui", false, "if true, show a live terminal dashboard instead of printing stats lines to stdout (implies -report-brokers)")
+	reportInterval   = flag.Duration("report-interval", time.Second, "how often to report rates and stats; rates are over the time actually elapsed between reports")
+	percentiles      = flag.String("percentiles", "window", "what percentiles in rate reports cover: window (each report interval) or cumulative (the run so far); the final summary always covers the run")
+	sinkSpec         = flag.String("sinks", "stdout", "comma delimited list of where to report stats: stdout, json:<path>, prom:<addr>, statsd:<host:port>")
+	diagnosticsDir   = flag.String("diagnostics-dir", "", "if non-empty, when the run dies or exceeds an -assert flag, write a diagnostics bundle to a new directory in this one: recent kgo logs, the latest reports, flags, and cluster metadata")
+	diagnosticsLevel = flag.String("diagnostics-log-level", "debug", "for -diagnostics-dir, the level of kgo logs to keep (debug, info, warn, error), independent of -log-level")
+	diagnosticsLines = flag.Int("diagnostics-log-lines", 10000, "for -diagnostics-dir, how many of the most recent kgo log lines to keep")
+	debugAddr        = flag.String("debug-addr", "", "if non-empty, serve pprof and runtime stats (/debug/runtime) on this address")
+	latencySamplesTo = flag.String("latency-samples-file", "", "if non-empty, stream a sample per produced record (or per -raw-produce request) to this file for offline analysis: when it was sent, its latency, broker, partition, and size")
+	samplesFormat    = flag.String("latency-samples-format", "csv", "format of -latency-samples-file: csv, or binary (fixed 32 byte big endian samples)")
+	samplesRate      = flag.Float64("latency-samples-rate", 1, "for -latency-samples-file, the fraction of records (or requests) to sample, evenly spaced")
+	reportRouting    = flag.Bool("report-routing", false, "if true, report which broker produce batches went to and how many partitions each leads, and report each partition leadership move as produce sees it, with a timestamp")
+	reportBrokers    = flag.Bool("report-brokers", false, "if true, report connections, dial latency, request counts, bytes, and request latency per broker")
+	reportBuffered   = flag.Bool("report-buffered", false, "if true, report the records and bytes producers have buffered awaiting acknowledgement, and how full their buffers are")
+	reportBatches    = flag.Bool("report-batches", false, "if true, report produced batch sizes, records per batch, and batches and records per produce request")
+	reportThrottle   = flag.Bool("report-throttle", false, "if true, report broker throttle time per second and per-broker throttle percentiles (for quota testing)")
+	reportBreakdown  = flag.Bool("report-latency-breakdown", false, "if true, split produce latency into broker round trips and time buffered in the client (lingering and batching), to tell whether tail latency comes from -linger or the cluster")
+	reportRetries    = flag.Bool("report-retries", false, "if true, report produce requests that failed and were retried (and how many were ambiguous: written but unanswered), batches brokers failed retryably, and duplicate sequence numbers brokers rejected")
+	checksums        = flag.Bool("checksum", false, "if true, add a CRC-32C of each produced record's key and value in a header, or verify it when consuming, counting corrupt records as errors")
+	verifyMode       = flag.Bool("verify", false, "if true, stamp produced records with a producer id and sequence number and consume them back in process, or check them when consuming, reporting duplicates and gaps (for validating idempotency under injected failures)")
+	leakEvery        = flag.Duration("leak-watch", 0, "if non-zero, how often to sample the generator's own live heap, goroutines, and buffered records, flagging any that grow steadily over the run in the final summary (for soak tests; use at least 10 samples' worth of -duration)")
+	leakGrowth       = flag.Float64("leak-growth", 0.1, "for -leak-watch, the least growth (as a fraction, 0.1 being 10%) past warmup that counts as a leak")
+	allocsEvery      = flag.Duration("report-allocs", 0, "if non-zero, how often to report the generator's own allocations, GC cost, and top allocation sites, split by run phase (startup, running, paused)")
+	runFor           = flag.Duration("duration", 0, "if non-zero, stop after running this long (otherwise on interrupt) and print the final summary")
+	numRecords       = flag.Int64("num-records", 0, "if non-zero, stop after producing (or consuming) this many records, reporting an ETA on the rate lines")
+	quiet            = flag.Bool("quiet", false, "if true, print only the final summary to stdout, not rate lines or other periodic reports (for scripted runs; other sinks still get everything)")
+	summaryFile      = flag.String("summary-file", "", "if non-empty, also write the final summary as JSON to this file")
+	pushResultsTo    = flag.String("push-results", "", "if non-empty, POST the final summary as JSON to this URL, with -label labels, the host, build, Go version, cluster id, and flags, for a central results store (with -coordinate, only the coordinator pushes)")
+	scenarioPath     = flag.String("scenario", "", "if non-empty, run the stages in this file one after another, each a line of \"name duration flags...\" run with these flags plus its own, and summarize each stage")
+	controlAddr      = flag.String("control-addr", "", "if non-empty, serve an HTTP API on this address to change -rate, -num-clients, and -record-size, or pause, while running")
+
+	coordinateAddr = flag.String("coordinate", "", "if non-empty, coordinate -workers processes from this address instead of running clients: split -rate between them, start them together, stop them after -duration, and report their combined stats")
+	numWorkers     = flag.Int("workers", 1, "for -coordinate, how many -worker-of processes to wait for")
+	workerOf       = flag.String("worker-of", "", "if non-empty, run as a worker of the -coordinate process at this address, which overrides -rate with this worker's share and -duration")
+
+	assertP99           = flag.Duration("assert-p99-latency", 0, "if non-zero, exit non-zero if the run's p99 produce latency exceeds this")
+	assertMinThroughput = flag.String("assert-min-throughput", "", "if non-empty, exit non-zero if the run's average throughput is below this, e.g. 200MiB/s or 50000records/s")
+	assertNoLeaks       = flag.Bool("assert-no-leaks", false, "for -leak-watch, exit non-zero if the live heap, goroutines, or buffered records grew steadily over the run")
+	assertMaxErrors     = flag.Int64("assert-max-errors", -1, "if non-negative, exit non-zero if the run has more errors than this (failed produces, commits, aborted transactions, rejected raw requests); produce errors are counted rather than fatal")
+
+	otlpEndpoint    = flag.String("otlp-endpoint", "", "if non-empty, export OpenTelemetry traces of produced/consumed records to this OTLP/HTTP endpoint (host:port or URL)")
+	otlpSampleRatio = flag.Float64("otlp-sample-ratio", 0.01, "fraction of records to trace when -otlp-endpoint is set")
+
+	useTLS          = flag.Bool("tls", false, "if true, connect to brokers over TLS")
+	tlsCA           = flag.String("tls-ca", "", "if non-empty, path to a PEM CA bundle to verify brokers with (implies -tls)")
+	tlsCert         = flag.String("tls-cert", "", "if non-empty, path to a PEM client certificate (requires -tls-key, implies -tls)")
+	tlsKey          = flag.String("tls-key", "", "if non-empty, path to a PEM client key (requires -tls-cert, implies -tls)")
+	tlsServerName   = flag.String("tls-server-name", "", "if non-empty, server name to verify broker certificates against")
+	tlsSessionCache = flag.Int("tls-session-cache", 1024, "size of the TLS session cache shared by all clients; 0 disables session resumption")
+
+	saslMechanism    = flag.String("sasl-mechanism", "", "if non-empty, authenticate with this SASL mechanism: plain, scram-sha-256, scram-sha-512, aws-msk-iam (usually with -tls), or oauthbearer")
+	saslUser         = flag.String("sasl-user", "", "SASL user, or for aws-msk-iam an access key")
+	saslPass         = flag.String("sasl-pass", "", "SASL password, or for aws-msk-iam a secret key; if empty, $BKC_SASL_PASS, which keeps it out of process listings")
+	saslTokenCommand = flag.String("sasl-token-command", "", "for aws-msk-iam or oauthbearer, a shell command printing credentials whenever they are needed: AWS credential_process JSON (e.g. aws configure export-credentials --format process) or an OAuth token")
+
+	payloadTmpl *payloadTemplate
+	schemaVals  *schemaValues
+	timestamps  *timestampMode
+	hotKeyBytes []byte
+	valueSizer  recordSizer
+	capture     *recordWriter
+	processing  *processTime
+
+	reportCompression bool
+	bufferLimit       int64 // per producer, in bytes
+	balancers         []*groupBalancer
 
 	rateRecs  int64
 	rateBytes int64
 )
 
 func die(msg string, args ...interface{}) {
+	restoreTerminal()
 	fmt.Fprintf(os.Stderr, msg+"\n", args...)
+	if diag != nil && diag.dumping() {
+		diag.dump(fmt.Sprintf(msg, args...))
+	}
 	os.Exit(1)
 }
 
@@ -50,91 +231,1313 @@ func formatValue(num int64, v []byte) {
 	}
 }
 
+// newValue returns the value, and possibly key, of a producer's num'th record.
+func newValue(num int64, rng *rand.Rand) (value, key []byte) {
+	if payloadTmpl != nil {
+		return payloadTmpl.render(num, rng)
+	}
+	if schemaVals != nil {
+		return schemaVals.render(rng), nil
+	}
+	value = make([]byte, valueSizer.next(rng))
+	formatValue(num, value)
+	return value, nil
+}
+
+// produced is the promise for every produced record, whose latency is from
+// its timestamp.
+func produced(r *kgo.Record, err error) { producedSince(r.Timestamp, r, err) }
+
+// producedSince handles a produced record, whose latency is from start.
+func producedSince(start time.Time, r *kgo.Record, err error) {
+	if err != nil && *produceDeadline > 0 && errors.Is(err, context.DeadlineExceeded) {
+		atomic.AddInt64(&cancelledRecs, 1)
+		return
+	}
+	if err != nil && countProduceErrs {
+		atomic.AddInt64(&produceErrors, 1)
+		return
+	}
+	chk(err, "produce error: %v", err)
+	lat := time.Since(start)
+	produceLat.observe(lat)
+	if *reportBreakdown {
+		breakdown.produced(r, lat)
+	}
+	if samples != nil {
+		samples.produced(r, start, lat)
+	}
+	if workloads != nil {
+		if w := workloadOf(r.Topic); w != nil {
+			w.produced(len(r.Value), lat)
+		}
+	}
+	if partitionCounts != nil {
+		producedTo(r.Partition, len(r.Value))
+	}
+	if fanout != nil {
+		fanout.copied(r)
+	}
+	if byKey != nil {
+		byKey.produced(r)
+	}
+	if tailing != nil {
+		atomic.AddInt64(&tailing.produced, 1)
+	}
+	atomic.AddInt64(&rateRecs, 1)
+	atomic.AddInt64(&rateBytes, int64(len(r.Value)))
+}
+
+// produce produces until stopped, round robin to parts if non-nil and
+// otherwise wherever the partitioner puts records.
+func produce(client *kgo.Client, parts []int32, rng *rand.Rand, stop <-chan struct{}) {
+	var (
+		num      int64
+		p        pacer
+		producer = rng.Uint64() // for -verify
+		batch    []*kgo.Record  // for -sync-produce
+	)
+	for waitUnpaused(stop) && !stopped(stop) {
+		p.wait()
+		if chaos != nil && chaos.roll(rng) {
+			chaos.produce(rng)
+			continue
+		}
+
+		var r *kgo.Record
+		if *poolRecords {
+			r = pooledRecord(num, rng)
+		} else {
+			value, key := newValue(num, rng)
+			r = kgo.SliceRecord(value)
+			r.Key = key
+		}
+		r.Key = skewKey(r.Key, rng)
+		if byKey != nil {
+			byKey.route(r, rng)
+		}
+		if parts != nil {
+			r.Partition = parts[num%int64(len(parts))]
+		}
+		if timestamps != nil {
+			r.Timestamp = timestamps.at(num)
+		}
+		if verifying != nil {
+			r.Headers = []kgo.RecordHeader{{Key: verifyHeader, Value: verifyValue(producer, num)}}
+		}
+		if tailing != nil {
+			tailing.stamp(r)
+		}
+		num++
+		switch {
+		case *syncProduce:
+			if batch = append(batch, r); len(batch) == *syncBatch {
+				produceSync(client, batch)
+				batch = batch[:0]
+			}
+		case fanout != nil:
+			fanout.produce(client, r)
+		default:
+			produceRecord(client, r)
+		}
+	}
+	if len(batch) > 0 {
+		produceSync(client, batch)
+	}
+
+	// Closing the client would fail anything still buffered, and produce
+	// errors are fatal, so let outstanding records finish first.
+	client.Flush(context.Background())
+}
+
+// rateReport is what was produced or consumed over one interval.
+type rateReport struct {
+	Interval    time.Duration     `json:"interval_ns"`
+	Records     int64             `json:"records"`
+	Bytes       int64             `json:"bytes"`
+	Progress    *progressReport   `json:"progress,omitempty"`
+	TLS         *tlsReport        `json:"tls,omitempty"`
+	Txn         *txnReport        `json:"txn,omitempty"`
+	Commits     *commitReport     `json:"commits,omitempty"`
+	Raw         *rawReport        `json:"raw,omitempty"`
+	Deadline    *deadlineReport   `json:"deadline,omitempty"`
+	Idle        *idleReport       `json:"idle,omitempty"`
+	Latency     *latencySummary   `json:"produce_latency,omitempty"`
+	Breakdown   *breakdownReport  `json:"latency_breakdown,omitempty"`
+	Partitions  *partitionReport  `json:"partitions,omitempty"`
+	Retries     *retryReport      `json:"retries,omitempty"`
+	Bounces     *bounceReport     `json:"bounces,omitempty"`
+	Checksums   *checksumReport   `json:"checksums,omitempty"`
+	Loops       *loopReport       `json:"loops,omitempty"`
+	Replicas    *replicaReport    `json:"replicas,omitempty"`
+	FanOut      *fanOutReport     `json:"fan_out,omitempty"`
+	Chaos       *chaosReport      `json:"chaos,omitempty"`
+	Tail        *tailReport       `json:"tail,omitempty"`
+	KeyTopics   *keyTopicsReport  `json:"key_topics,omitempty"`
+	Sync        *syncReport       `json:"sync,omitempty"`
+	Workloads   workloadReports   `json:"workloads,omitempty"`
+	Pool        *poolReport       `json:"pool,omitempty"`
+	Failover    *failoverReport   `json:"failover,omitempty"`
+	Verify      *verifyReport     `json:"verify,omitempty"`
+	Processing  *processReport    `json:"processing,omitempty"`
+	Buffered    *bufferedReport   `json:"buffered,omitempty"`
+	Throttle    *throttleReport   `json:"throttle,omitempty"`
+	Compression compressionReport `json:"compression,omitempty"`
+	Rebalances  rebalanceReports  `json:"rebalances,omitempty"`
+	Pauses      *pauseReport      `json:"pauses,omitempty"`
+	Batches     *batchReport      `json:"batches,omitempty"`
+	Reads       *readPathReport   `json:"reads,omitempty"`
+	Brokers     brokersReport     `json:"brokers,omitempty"`
+	Routing     *routingReport    `json:"routing,omitempty"`
+}
+
+func (*rateReport) kind() string { return "rate" }
+
+func (r *rateReport) String() string {
+	secs := r.Interval.Seconds()
+	line := fmt.Sprintf("%0.2f MiB/s; %0.2fk records/s", float64(r.Bytes)/secs/(1024*1024), float64(r.Records)/secs/1000)
+	if r.Progress != nil {
+		line += "; " + r.Progress.String()
+	}
+	if r.Latency != nil {
+		line += "; produce " + r.Latency.String()
+	}
+	if r.Breakdown != nil {
+		line += "; " + r.Breakdown.String()
+	}
+	if r.Txn != nil {
+		line += "; " + r.Txn.String()
+	}
+	if r.Commits != nil {
+		line += "; " + r.Commits.String()
+	}
+	if r.Raw != nil {
+		line += "; " + r.Raw.String()
+	}
+	if r.Deadline != nil {
+		line += "; " + r.Deadline.String()
+	}
+	if r.Idle != nil {
+		line += "; " + r.Idle.String()
+	}
+	if r.Buffered != nil {
+		line += "; " + r.Buffered.String()
+	}
+	if r.Partitions != nil {
+		line += "; " + r.Partitions.String()
+	}
+	if r.Retries != nil {
+		line += "; " + r.Retries.String()
+	}
+	if r.Bounces != nil {
+		line += "; " + r.Bounces.String()
+	}
+	if r.Checksums != nil {
+		line += "; " + r.Checksums.String()
+	}
+	if r.Loops != nil {
+		line += "; " + r.Loops.String()
+	}
+	if r.Replicas != nil {
+		line += "; " + r.Replicas.String()
+	}
+	if r.FanOut != nil {
+		line += "; " + r.FanOut.String()
+	}
+	if r.Chaos != nil {
+		line += "; " + r.Chaos.String()
+	}
+	if r.Tail != nil {
+		line += "; " + r.Tail.String()
+	}
+	if r.KeyTopics != nil {
+		line += "; " + r.KeyTopics.String()
+	}
+	if r.Sync != nil {
+		line += "; " + r.Sync.String()
+	}
+	if r.Workloads != nil {
+		line += "; " + r.Workloads.String()
+	}
+	if r.Pool != nil {
+		line += "; " + r.Pool.String()
+	}
+	if r.Failover != nil {
+		line += "; " + r.Failover.String()
+	}
+	if r.Verify != nil {
+		line += "; " + r.Verify.String()
+	}
+	if r.Batches != nil {
+		line += "; " + r.Batches.String()
+	}
+	if r.Reads != nil {
+		line += "; " + r.Reads.String()
+	}
+	if r.Processing != nil {
+		line += "; " + r.Processing.String()
+	}
+	if r.Compression != nil {
+		line += "; " + r.Compression.String()
+	}
+	if r.Rebalances != nil {
+		line += "; " + r.Rebalances.String()
+	}
+	if r.Pauses != nil {
+		line += "; " + r.Pauses.String()
+	}
+	if r.Throttle != nil {
+		line += "; " + r.Throttle.String()
+	}
+	if r.TLS != nil {
+		line += "; " + r.TLS.String()
+	}
+	if r.Brokers != nil {
+		line += "; " + r.Brokers.String()
+	}
+	if r.Routing != nil {
+		line += "; " + r.Routing.String()
+	}
+	return line
+}
+
+func (r *rateReport) metrics() []metric {
+	ms := []metric{
+		{name: "records", value: float64(r.Records), counter: true},
+		{name: "bytes", value: float64(r.Bytes), counter: true},
+	}
+	if r.Progress != nil {
+		ms = append(ms, r.Progress.metrics()...)
+	}
+	if r.Latency != nil {
+		ms = append(ms, r.Latency.metrics("produce_latency")...)
+	}
+	if r.Breakdown != nil {
+		ms = append(ms, r.Breakdown.metrics()...)
+	}
+	if r.Txn != nil {
+		ms = append(ms, r.Txn.metrics()...)
+	}
+	if r.Commits != nil {
+		ms = append(ms, r.Commits.metrics()...)
+	}
+	if r.Raw != nil {
+		ms = append(ms, r.Raw.metrics()...)
+	}
+	if r.Deadline != nil {
+		ms = append(ms, r.Deadline.metrics()...)
+	}
+	if r.Idle != nil {
+		ms = append(ms, r.Idle.metrics()...)
+	}
+	if r.Buffered != nil {
+		ms = append(ms, r.Buffered.metrics()...)
+	}
+	if r.Partitions != nil {
+		ms = append(ms, r.Partitions.metrics()...)
+	}
+	if r.Retries != nil {
+		ms = append(ms, r.Retries.metrics()...)
+	}
+	if r.Bounces != nil {
+		ms = append(ms, r.Bounces.metrics()...)
+	}
+	if r.Checksums != nil {
+		ms = append(ms, r.Checksums.metrics()...)
+	}
+	if r.Loops != nil {
+		ms = append(ms, r.Loops.metrics()...)
+	}
+	if r.Replicas != nil {
+		ms = append(ms, r.Replicas.metrics()...)
+	}
+	if r.FanOut != nil {
+		ms = append(ms, r.FanOut.metrics()...)
+	}
+	if r.Chaos != nil {
+		ms = append(ms, r.Chaos.metrics()...)
+	}
+	if r.Tail != nil {
+		ms = append(ms, r.Tail.metrics()...)
+	}
+	if r.KeyTopics != nil {
+		ms = append(ms, r.KeyTopics.metrics()...)
+	}
+	if r.Sync != nil {
+		ms = append(ms, r.Sync.metrics()...)
+	}
+	if r.Workloads != nil {
+		ms = append(ms, r.Workloads.metrics()...)
+	}
+	if r.Pool != nil {
+		ms = append(ms, r.Pool.metrics()...)
+	}
+	if r.Failover != nil {
+		ms = append(ms, r.Failover.metrics()...)
+	}
+	if r.Verify != nil {
+		ms = append(ms, r.Verify.metrics()...)
+	}
+	if r.Batches != nil {
+		ms = append(ms, r.Batches.metrics()...)
+	}
+	if r.Reads != nil {
+		ms = append(ms, r.Reads.metrics()...)
+	}
+	if r.Processing != nil {
+		ms = append(ms, r.Processing.metrics()...)
+	}
+	if r.Compression != nil {
+		ms = append(ms, r.Compression.metrics()...)
+	}
+	if r.Rebalances != nil {
+		ms = append(ms, r.Rebalances.metrics()...)
+	}
+	if r.Pauses != nil {
+		ms = append(ms, r.Pauses.metrics()...)
+	}
+	if r.Throttle != nil {
+		ms = append(ms, r.Throttle.metrics()...)
+	}
+	if r.TLS != nil {
+		ms = append(ms, r.TLS.metrics()...)
+	}
+	if r.Brokers != nil {
+		ms = append(ms, r.Brokers.metrics()...)
+	}
+	if r.Routing != nil {
+		ms = append(ms, r.Routing.metrics()...)
+	}
+	return ms
+}
+
+// ratesStop stops printRate, which closes ratesDone once it has.
+var (
+	ratesStop = make(chan struct{})
+	ratesDone = make(chan struct{})
+)
+
 func printRate() {
-	for range time.Tick(time.Second) {
-		recs := atomic.SwapInt64(&rateRecs, 0)
-		bytes := atomic.SwapInt64(&rateBytes, 0)
-		fmt.Printf("%0.2f MiB/s; %0.2fk records/s\n", float64(bytes)/(1024*1024), float64(recs)/1000)
+	defer close(ratesDone)
+	rates.start()
+	tick := time.NewTicker(*reportInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			emit(swapRateReport(rates.next()))
+		case <-ratesStop:
+			return
+		}
+	}
+}
+
+// stopRates stops printRate, waiting out a report it is in the middle of, so
+// that the run's last report does not swap the same counters concurrently.
+func stopRates() {
+	close(ratesStop)
+	<-ratesDone
+}
+
+// swapRateReport takes everything counted over the past interval, adding it
+// to the run's totals.
+func swapRateReport(interval time.Duration) *rateReport {
+	r := &rateReport{
+		Interval: interval,
+		Records:  atomic.SwapInt64(&rateRecs, 0),
+		Bytes:    atomic.SwapInt64(&rateBytes, 0),
+	}
+	atomic.AddInt64(&totalRecs, r.Records)
+	atomic.AddInt64(&totalBytes, r.Bytes)
+	if *eosTopic != "" {
+		r.Txn = swapTxnReport()
+	} else if *group != "" && *commitMode != "none" && *clientLib == "franz-go" || *offsetStorePath != "" {
+		r.Commits = swapCommitReport()
+	} else if *rawProduceMode {
+		r.Raw = swapRawReport()
+	}
+	if measuringProduceLatency() {
+		r.Latency = intervalProduceLatency()
+	}
+	if *reportBreakdown {
+		r.Breakdown = breakdown.swap()
+	}
+	if *produceDeadline > 0 {
+		r.Deadline = swapDeadlineReport(r.Records)
+	}
+	if *idleMode {
+		r.Idle = swapIdleReport()
+	}
+	if *reportBuffered {
+		r.Buffered = buffered(bufferLimit)
+	}
+	if balancers != nil {
+		r.Rebalances = swapRebalanceReports(balancers)
+	}
+	if *pauseEvery > 0 {
+		r.Pauses = swapPauseReport()
+	}
+	if *historicalLag > 0 {
+		r.Reads = swapReadPathReport(interval)
+	}
+	if processing != nil {
+		r.Processing = swapProcessReport(interval)
+	}
+	if partitionCounts != nil {
+		r.Partitions = swapPartitionReport(interval)
+	}
+	if *reportRetries {
+		r.Retries = retries.swap()
+	}
+	if *bounceEvery > 0 {
+		r.Bounces = bounces.swap()
+	}
+	if *checksums && *consumeMode {
+		r.Checksums = swapChecksumReport()
+	}
+	if *loopConsume {
+		r.Loops = swapLoopReport()
+	}
+	if *rack != "" && *clientLib == "franz-go" {
+		r.Replicas = swapReplicaReport(*rack)
+	}
+	if fanout != nil {
+		r.FanOut = fanout.swap(interval, r.Bytes)
+	}
+	if byKey != nil {
+		r.KeyTopics = byKey.swap(interval)
+	}
+	if chaos != nil {
+		r.Chaos = chaos.swap()
+	}
+	if tailing != nil {
+		r.Tail = tailing.swap()
+	}
+	if *syncProduce {
+		r.Sync = swapSyncReport(r.Records)
+	}
+	if workloads != nil {
+		r.Workloads = swapWorkloadReports()
 	}
+	if *poolRecords {
+		r.Pool = swapPoolReport()
+	}
+	if *metadataRefreshEvery > 0 || *blackholeEvery > 0 {
+		r.Failover = failover.swap()
+	}
+	if verifying != nil {
+		r.Verify = verifying.swap()
+	}
+	if *reportBatches && *clientLib == "franz-go" {
+		r.Batches = batching.swap()
+	}
+	if reportCompression && *clientLib == "franz-go" {
+		r.Compression = compressions.swap()
+	}
+	if *reportThrottle && *clientLib == "franz-go" {
+		r.Throttle = throttles.swap(r.Interval)
+	}
+	if *useTLS && *clientLib == "franz-go" {
+		r.TLS = conns.report()
+	}
+	if *reportBrokers && *clientLib == "franz-go" {
+		r.Brokers = brokerConns.swap()
+	}
+	if *reportRouting {
+		r.Routing = routing.swap()
+	}
+	atomic.AddInt64(&totalErrs, r.errors())
+	if diag != nil && *assertMaxErrors >= 0 {
+		if errs := atomic.LoadInt64(&totalErrs) + atomic.LoadInt64(&produceErrors); errs > *assertMaxErrors {
+			go diag.dump(fmt.Sprintf("%d errors exceed -assert-max-errors %d", errs, *assertMaxErrors))
+		}
+	}
+	r.Progress = progress()
+	return r
 }
 
 func main() {
+	flag.Var(&runLabels, "label", "a key=value label for the run, attached to every metric, json sink report, and the summary; may be repeated or comma delimited, e.g. -label cluster=prod-east -label build=1234")
 	flag.Parse()
+	if *saslPass == "" {
+		*saslPass = os.Getenv(saslPassEnv)
+	}
+
+	if *scenarioPath != "" {
+		if *coordinateAddr != "" || *workerOf != "" {
+			die("-scenario runs stages in this process's place, and cannot be coordinated")
+		}
+		runScenario(*scenarioPath)
+		return
+	}
+	initSeed()
+	if *coordinateAddr != "" {
+		if *workerOf != "" {
+			die("-coordinate and -worker-of are mutually exclusive")
+		}
+		if *rate < 0 {
+			die("invalid negative rate %d", *rate)
+		}
+		sinks = parseSinks(*sinkSpec)
+		coordinate(*coordinateAddr, *numWorkers)
+		return
+	}
+	if *uiMode && *clientLib == "franz-go" {
+		*reportBrokers = true
+	}
+	var coord *workerClient
+	if *workerOf != "" {
+		coord = joinCoordinator(*workerOf)
+	}
 
 	if *recordSize <= 0 {
 		die("record bytes must be larger than zero")
 	}
+	if *valueTemplate != "" {
+		payloadTmpl = parsePayloadTemplate(*valueTemplate, *keyField)
+	} else if *keyField != "" {
+		die("-key-field requires -value-template")
+	}
+	if *valueSchema != "" || *schemaRegistry != "" {
+		if *valueSchema == "" || *schemaRegistry == "" {
+			die("-value-schema and -schema-registry-url require each other")
+		}
+		if payloadTmpl != nil || *recordSizeMix != "" || *recordSizeDist != "" {
+			die("-value-schema cannot be used with -value-template, -record-size-mix, or -record-size-dist")
+		}
+		subject := *schemaSubject
+		if subject == "" {
+			subject = *topic + "-value"
+		}
+		schemaVals = newSchemaValues(*schemaRegistry, subject, *valueSchema)
+	}
+
+	if *hotPartitionPct < 0 || *hotPartitionPct > 100 {
+		die("-hot-partition-pct must be within [0, 100]")
+	}
+	if *assignPartitions {
+		if *consumeMode || *eosTopic != "" || *rawProduceMode || *replayPath != "" || *idleMode || *clientLib != "franz-go" {
+			die("-assign-partitions only applies to producing generated records with franz-go")
+		}
+		if *topic == "" {
+			die("a topic is required with -assign-partitions")
+		}
+		if *hotPartitionPct > 0 {
+			die("-assign-partitions and -hot-partition-pct both choose partitions")
+		}
+	}
+	if *hotPartitionPct > 0 && (*consumeMode || *eosTopic != "" || *rawProduceMode || *replayPath != "") {
+		die("-hot-partition-pct only applies to producing generated records")
+	}
+	hotKeyBytes = []byte(*hotKey)
+	if timestamps = parseTimestampMode(*timestampSpec); timestamps != nil && (*consumeMode || *eosTopic != "" || *rawProduceMode || *replayPath != "") {
+		die("-timestamp-mode only applies to producing generated records")
+	}
+
+	if *rate < 0 {
+		die("invalid negative rate %d", *rate)
+	}
+	live.rate = *rate
+	live.recordSize = int64(*recordSize)
+	valueSizer = fixedSize{}
+	if *recordSizeMix != "" {
+		if payloadTmpl != nil {
+			die("-record-size-mix cannot be used with -value-template")
+		}
+		valueSizer = parseSizeMix(*recordSizeMix)
+	}
+	if *recordSizeDist != "" {
+		if payloadTmpl != nil || *recordSizeMix != "" {
+			die("-record-size-dist cannot be used with -value-template or -record-size-mix")
+		}
+		valueSizer = parseSizeDist(*recordSizeDist)
+	}
+	if valueSizer.max() > *maxBatchSize {
+		die("records of up to %d bytes cannot fit in a max batch size of %d", valueSizer.max(), *maxBatchSize)
+	}
 
 	opts := []kgo.Opt{
 		kgo.SeedBrokers(strings.Split(*brokers, ",")...),
+	}
+
+	var logger kgo.Logger
+	if *logLevel != "" {
+		logger = kgo.BasicLogger(os.Stderr, parseLogLevel(*logLevel), nil)
+	}
+	if *diagnosticsDir != "" {
+		diag = newDiagnostics(*diagnosticsDir, *diagnosticsLines)
+		logger = ringLogger{inner: logger, level: parseLogLevel(*diagnosticsLevel)}
+	}
+	if *reportRetries {
+		if *consumeMode || *rawProduceMode || *clientLib != "franz-go" {
+			die("-report-retries only applies to producing with franz-go")
+		}
+		logger = retryLogger{inner: logger}
+		opts = append(opts, kgo.WithHooks(&retries))
+	}
+	if logger != nil {
+		opts = append(opts, kgo.WithLogger(logger))
+	}
+
+	if *tlsCA != "" || *tlsCert != "" || *tlsKey != "" {
+		*useTLS = true
+	}
+	netDialer := newNetDialer()
+	dial := netDialer.DialContext
+	if *useTLS {
+		dialer := &tls.Dialer{
+			NetDialer: netDialer,
+			Config:    newTLSConfig(),
+		}
+		dial = dialer.DialContext
+	}
+	if *blackholeEvery > 0 {
+		if *clientLib != "franz-go" {
+			die("-blackhole-every only works with franz-go")
+		}
+		if *blackholeFor <= 0 || *blackholeFor >= *blackholeEvery {
+			die("-blackhole-for must be positive and shorter than -blackhole-every")
+		}
+		failover.seeds = strings.Split(*brokers, ",")
+		dial = failover.dialer(dial)
+		go failover.rotate()
+	}
+	opts = append(opts, kgo.Dialer(dial))
+	if *connIdleTimeout != 0 {
+		opts = append(opts, kgo.ConnIdleTimeout(*connIdleTimeout))
+	}
+	if *brokerMaxWrite != "" {
+		opts = append(opts, kgo.BrokerMaxWriteBytes(brokerMaxBytes("broker-max-write-bytes", *brokerMaxWrite)))
+	}
+	if *brokerMaxRead != "" {
+		opts = append(opts, kgo.BrokerMaxReadBytes(brokerMaxBytes("broker-max-read-bytes", *brokerMaxRead)))
+	}
+
+	if *saslMechanism != "" {
+		if *clientLib != "franz-go" {
+			die("-sasl-mechanism only works with franz-go")
+		}
+		opts = append(opts, kgo.SASL(newSASLMechanism(*saslMechanism)))
+	}
+
+	// Everything above configures how to talk to the cluster. The admin
+	// client shares that, but none of the workload options or hooks below.
+	adminOpts := opts[:len(opts):len(opts)]
+	resultsAdminOpts = adminOpts
+	if diag != nil {
+		diag.adminOpts = adminOpts
+	}
+
+	// kgo limits buffering by record count, sized here to the limit in
+	// bytes; an explicit -max-buffered-bytes is enforced as bytes too.
+	bufferLimit = 50 << 20
+	if *maxBuffered != "" {
+		if bufferLimit = int64(parseBytes(*maxBuffered)); bufferLimit < int64(valueSizer.max()) {
+			die("-max-buffered-bytes %q must fit at least one record of up to %d bytes", *maxBuffered, valueSizer.max())
+		}
+		opts = append(opts, kgo.MaxBufferedBytes(int(bufferLimit)))
+	}
+	opts = append(opts,
 		kgo.DefaultProduceTopic(*topic),
-		kgo.MaxBufferedRecords(50<<20 / *recordSize + 1),
-		kgo.BatchMaxBytes(int32(*maxBatchSize)),
+		kgo.MaxBufferedRecords(int(float64(bufferLimit)/valueSizer.mean())+1),
+		kgo.ProducerBatchMaxBytes(int32(*maxBatchSize)),
 		kgo.RequiredAcks(kgo.AllISRAcks()),
+	)
+
+	if *requestTimeout != 0 {
+		opts = append(opts, kgo.RequestTimeoutOverhead(*requestTimeout))
+	}
+	if *retryBackoff != 0 {
+		backoff := *retryBackoff
+		opts = append(opts, kgo.RetryBackoffFn(func(int) time.Duration { return backoff }))
+	}
+	if *produceTimeout != 0 {
+		opts = append(opts, kgo.ProduceRequestTimeout(*produceTimeout))
+	}
+	if *maxInflight < 0 {
+		die("-max-produce-inflight-per-broker must be positive")
+	}
+	if *maxInflight != 0 {
+		opts = append(opts, kgo.MaxProduceRequestsInflightPerBroker(*maxInflight))
+		if *maxInflight > 1 {
+			opts = append(opts, kgo.DisableIdempotentWrite())
+		}
 	}
 
-	switch strings.ToLower(*logLevel) {
-	case "":
-	case "debug":
-		opts = append(opts, kgo.WithLogger(kgo.BasicLogger(os.Stderr, kgo.LogLevelDebug, nil)))
-	case "info":
-		opts = append(opts, kgo.WithLogger(kgo.BasicLogger(os.Stderr, kgo.LogLevelInfo, nil)))
-	case "warn":
-		opts = append(opts, kgo.WithLogger(kgo.BasicLogger(os.Stderr, kgo.LogLevelWarn, nil)))
-	case "error":
-		opts = append(opts, kgo.WithLogger(kgo.BasicLogger(os.Stderr, kgo.LogLevelError, nil)))
-	default:
-		die("unrecognized log level %s", *logLevel)
+	if *useTLS {
+		opts = append(opts, kgo.WithHooks(&conns))
+	}
+	if *reportBatches {
+		opts = append(opts, kgo.WithHooks(&batching))
+	}
+	if *reportBrokers {
+		opts = append(opts, kgo.WithHooks(&brokerConns))
+	}
+	if *reportRouting {
+		if *consumeMode || *rawProduceMode || *clientLib != "franz-go" {
+			die("-report-routing only applies to producing with franz-go")
+		}
+		go routing.emitChanges()
+	}
+	if *latencySamplesTo != "" {
+		if *consumeMode || *clientLib != "franz-go" {
+			die("-latency-samples-file only applies to producing with franz-go")
+		}
+		samples = newLatencySamples(*latencySamplesTo, *samplesFormat, *samplesRate)
+	}
+	if *reportThrottle || *autoBackoffOn {
+		opts = append(opts, kgo.WithHooks(&throttles))
+	}
+	if *reportBreakdown {
+		if !measuringProduceLatency() || *clientLib != "franz-go" || *eosTopic != "" {
+			die("-report-latency-breakdown only applies to producing with franz-go")
+		}
+		opts = append(opts, kgo.WithHooks(&breakdown))
+	}
+	if *reportRouting || *reportBreakdown || samples != nil {
+		opts = append(opts, kgo.WithHooks(produceLeaders))
+	}
+
+	if *otlpEndpoint != "" {
+		if *otlpSampleRatio < 0 || *otlpSampleRatio > 1 {
+			die("otlp sample ratio must be within [0, 1]")
+		}
+		opts = append(opts, kgo.WithHooks(otelHooks(*otlpEndpoint, *otlpSampleRatio)...))
+		defer stopTracing()
 	}
 
 	if *linger != 0 {
-		opts = append(opts, kgo.Linger(*linger))
+		opts = append(opts, kgo.ProducerLinger(*linger))
+	}
+
+	codecs := parseCompression(*compression)
+	if len(codecs) == 1 {
+		opts = append(opts, kgo.ProducerBatchCompression(codecs[0]))
+	}
+	reportCompression = strings.ToLower(*compression) != "none"
+	if *workloadSpec != "" {
+		if *consumeMode || *rawProduceMode || *replayPath != "" || *idleMode || *assignPartitions || *clientLib != "franz-go" {
+			die("-workloads only applies to producing generated records with franz-go, and not with -assign-partitions")
+		}
+		if len(codecs) > 1 {
+			die("-workloads sets compression per workload, so -compression must be one codec")
+		}
+		if *verifyMode {
+			die("-workloads produces to each workload's topic, so cannot combine with -verify, which only consumes -topic")
+		}
+		workloads = parseWorkloads(*workloadSpec)
+		if *clients < len(workloads) {
+			die("-workloads has %d workloads but -num-clients is %d, leaving some workloads without a client", len(workloads), *clients)
+		}
+	}
+	if *fanOutSpec != "" {
+		if *consumeMode || *rawProduceMode || *replayPath != "" || *idleMode || *clientLib != "franz-go" {
+			die("-fan-out only applies to producing generated records with franz-go")
+		}
+		if *assignPartitions || *workloadSpec != "" || *poolRecords || *verifyMode {
+			die("-fan-out picks each copy's topic, so cannot combine with -assign-partitions, -workloads, -pool-records, or -verify")
+		}
+		fanout = parseFanOut(*fanOutSpec, *topic)
+	}
+	if *keyTopicCount != 0 {
+		if *consumeMode || *rawProduceMode || *replayPath != "" || *idleMode || *clientLib != "franz-go" {
+			die("-key-topics only applies to producing generated records with franz-go")
+		}
+		if *assignPartitions || *workloadSpec != "" || *fanOutSpec != "" || *verifyMode {
+			die("-key-topics picks each record's topic, so cannot combine with -assign-partitions, -workloads, -fan-out, or -verify")
+		}
+		byKey = newKeyTopics(*topic, *keyTopicCount)
+	}
+	if *syncProduce {
+		if *consumeMode || *rawProduceMode || *replayPath != "" || *idleMode || *clientLib != "franz-go" {
+			die("-sync-produce only applies to producing generated records with franz-go")
+		}
+		if *syncBatch <= 0 {
+			die("-sync-batch must be positive")
+		}
+		if *poolRecords || *fanOutSpec != "" || *produceDeadline > 0 {
+			die("-sync-produce cannot combine with -pool-records, -fan-out, or -produce-deadline")
+		}
+	}
+	if reportCompression {
+		opts = append(opts, kgo.WithHooks(&compressions))
+	}
+
+	// Before any consuming options, for -preload.
+	produceOpts := opts[:len(opts):len(opts)]
+
+	if *chaosPct != 0 {
+		if *consumeMode || *rawProduceMode || *replayPath != "" || *idleMode || *clientLib != "franz-go" {
+			die("-chaos-records only applies to producing generated records with franz-go")
+		}
+		if *verifyMode {
+			die("-chaos-records cannot combine with -verify, whose consumer would see accepted chaos records")
+		}
+		chaos = newChaosProducer(produceOpts, *chaosPct, *chaosKinds, *chaosBytes)
 	}
 
-	switch strings.ToLower(*compression) {
-	case "none":
-		opts = append(opts, kgo.BatchCompression(kgo.NoCompression()))
-	case "gzip":
-		opts = append(opts, kgo.BatchCompression(kgo.GzipCompression()))
-	case "snappy":
-		opts = append(opts, kgo.BatchCompression(kgo.SnappyCompression()))
-	case "lz4":
-		opts = append(opts, kgo.BatchCompression(kgo.Lz4Compression()))
-	case "zstd":
-		opts = append(opts, kgo.BatchCompression(kgo.ZstdCompression()))
-	default:
-		die("unrecognized compression %s", *compression)
+	if *eosTopic != "" {
+		if *group == "" {
+			die("-eos-topic requires -group")
+		}
+		if *maxInflight > 1 {
+			die("-eos-topic produces idempotently, so -max-produce-inflight-per-broker cannot exceed 1")
+		}
+		*consumeMode = true
+	}
+
+	if *consumeMode {
+		opts = append(opts, kgo.ConsumeResetOffset(parseConsumeFrom(*consumeFrom)))
+		if *consumePartitions != "" {
+			if *group != "" || *offsetStorePath != "" || *clientLib != "franz-go" {
+				die("-consume-partitions consumes without a group, and only with franz-go")
+			}
+			opts = append(opts, kgo.ConsumePartitions(parseConsumePartitions(*consumePartitions)))
+		} else if *topic == "" {
+			die("a topic is required when consuming")
+		} else if *offsetStorePath == "" {
+			opts = append(opts, kgo.ConsumeTopics(*topic))
+		} else if *group != "" || *eosTopic != "" || *clientLib != "franz-go" {
+			die("-offset-store consumes without a group, and only with franz-go")
+		}
+		if *group != "" {
+			opts = append(opts, kgo.ConsumerGroup(*group))
+			if *eosTopic == "" {
+				opts = append(opts, commitOpts()...)
+			}
+		}
+		if *commitMode != "auto" && (*group == "" || *eosTopic != "") {
+			die("-commit-mode requires -group, and does not apply to -eos-topic")
+		}
+		if *fetchMaxBytes != 0 {
+			opts = append(opts, kgo.FetchMaxBytes(int32(*fetchMaxBytes)))
+		}
+		if *fetchMaxPartitionBytes != 0 {
+			opts = append(opts, kgo.FetchMaxPartitionBytes(int32(*fetchMaxPartitionBytes)))
+		}
+		if *fetchMaxWait != 0 {
+			opts = append(opts, kgo.FetchMaxWait(*fetchMaxWait))
+		}
+		if *fetchMinBytes != 0 {
+			opts = append(opts, kgo.FetchMinBytes(int32(*fetchMinBytes)))
+		}
+		if *rack != "" {
+			opts = append(opts, kgo.Rack(*rack))
+		}
+	} else if *group != "" || *offsetStorePath != "" {
+		die("-group and -offset-store require -consume")
+	} else if *rack != "" {
+		die("-rack only applies to consuming")
+	}
+
+	if *produceDeadline < 0 {
+		die("-produce-deadline must be positive")
+	}
+	if (*reportBuffered || *maxBuffered != "") && (*consumeMode || *rawProduceMode || *clientLib != "franz-go") {
+		die("-report-buffered and -max-buffered-bytes only apply to producing with franz-go")
+	}
+	if *produceDeadline > 0 && (*consumeMode || *rawProduceMode || *clientLib != "franz-go") {
+		die("-produce-deadline only applies to producing with franz-go")
+	}
+
+	if *metadataRefreshEvery > 0 {
+		if *clientLib != "franz-go" {
+			die("-metadata-refresh-every only works with franz-go")
+		}
+		// kgo otherwise waits at least 5s between refreshes.
+		opts = append(opts, kgo.MetadataMinAge(min(*metadataRefreshEvery, 5*time.Second)))
+	}
+
+	if *poolRecords && (*consumeMode || *rawProduceMode || *replayPath != "" || *idleMode || *clientLib != "franz-go") {
+		die("-pool-records only applies to producing generated records with franz-go")
+	}
+
+	if *idleMode {
+		if *consumeMode || *rawProduceMode || *replayPath != "" || *clientLib != "franz-go" {
+			die("-idle only applies to producing generated records with franz-go")
+		}
+		if *idlePing < 0 {
+			die("-idle-ping must be non-negative")
+		}
+		if *connIdleTimeout == 0 {
+			opts = append(opts, kgo.ConnIdleTimeout(15*time.Minute))
+		}
+	}
+
+	if *rawProduceMode {
+		if *consumeMode || *clientLib != "franz-go" {
+			die("-raw-produce only applies to producing with franz-go")
+		}
+		if *topic == "" {
+			die("a topic is required with -raw-produce")
+		}
+		if strings.ToLower(*compression) != "none" {
+			die("-raw-produce batches are uncompressed")
+		}
+		if *rawBatchRecords <= 0 {
+			die("-raw-batch-records must be positive")
+		}
+		parseRawMangles(*rawMangle)
+	} else if *rawMangle != "" {
+		die("-raw-mangle requires -raw-produce")
 	}
 
 	if *clients <= 0 {
 		die("number of clients must be positive")
 	}
+	if *reportInterval < 10*time.Millisecond {
+		die("-report-interval must be at least 10ms")
+	}
+	cumulative := parsePercentiles(*percentiles)
 
-	var wg sync.WaitGroup
+	if *processTimeSpec != "" {
+		if !*consumeMode || *eosTopic != "" || *clientLib != "franz-go" {
+			die("-process-time only applies to consuming with franz-go, and not to -eos-topic")
+		}
+		processing = parseProcessTime(*processTimeSpec)
+	} else if *processCPU {
+		die("-process-cpu requires -process-time")
+	}
 
-	go printRate()
+	if *historicalLag > 0 {
+		if !*consumeMode || *eosTopic != "" || *offsetStorePath != "" || *clientLib != "franz-go" {
+			die("-historical-lag only applies to plain consuming with franz-go")
+		}
+	}
+
+	if *loopConsume {
+		if !*consumeMode || *eosTopic != "" || *offsetStorePath != "" || *clientLib != "franz-go" {
+			die("-loop-consume only applies to plain consuming with franz-go")
+		}
+		parseLoopFrom(*loopFrom)
+	}
+
+	if *pauseEvery > 0 {
+		if !*consumeMode || *eosTopic != "" || *offsetStorePath != "" || *clientLib != "franz-go" {
+			die("-pause-every only applies to plain consuming with franz-go")
+		}
+		if *pauseFraction <= 0 || *pauseFraction > 1 {
+			die("-pause-fraction must be within (0, 1]")
+		}
+		if *pauseFor <= 0 {
+			die("-pause-for must be positive")
+		}
+		opts = append(opts, kgo.WithHooks(&pauseFetches))
+	}
+
+	if *balancerSpec != "" {
+		if *group == "" || *eosTopic != "" || *clientLib != "franz-go" {
+			die("-balancers requires -group, does not apply to -eos-topic, and only works with franz-go")
+		}
+		balancers = parseBalancers(*balancerSpec, *group)
+		if *rebalanceEvery > 0 {
+			if *clients <= len(balancers) {
+				die("-rebalance-every needs more than one client per balancer")
+			}
+			go churnClients(*rebalanceEvery, *rebalanceEvery/2, len(balancers), nil)
+		}
+	} else if *rebalanceEvery > 0 {
+		die("-rebalance-every requires -balancers")
+	}
+
+	if *groupInstanceIDTemplate != "" {
+		if *group == "" || *clientLib != "franz-go" {
+			die("-group-instance-id requires -group, and only works with franz-go")
+		}
+		if *clients > 1 && groupInstanceID(0) == groupInstanceID(1) {
+			die("-group-instance-id must include {n} or %%d so that each client has its own instance id")
+		}
+	}
+	if *bounceEvery > 0 {
+		if *group == "" || *eosTopic != "" || *clientLib != "franz-go" {
+			die("-bounce-every requires -group, does not apply to -eos-topic, and only works with franz-go")
+		}
+		if *clients < 2 {
+			die("-bounce-every needs at least two clients, to watch one bounce from the others")
+		}
+		if *bounceFor <= 0 || *bounceFor >= *bounceEvery {
+			die("-bounce-for must be positive and shorter than -bounce-every")
+		}
+		go churnClients(*bounceEvery, *bounceFor, 1, bounces.bounce)
+	}
+
+	if *reportFairness && (*group == "" || *eosTopic != "" || *clientLib != "franz-go") {
+		die("-report-fairness requires -group, does not apply to -eos-topic, and only works with franz-go")
+	}
+
+	if *capturePath != "" {
+		if !*consumeMode || *eosTopic != "" || *offsetStorePath != "" || *clientLib != "franz-go" {
+			die("-capture only applies to plain consuming with franz-go")
+		}
+		if *group == "" && *clients > 1 {
+			die("-capture with more than one client requires -group, or every client captures every record")
+		}
+		capture = newRecordWriter(*capturePath, *captureFormat)
+	}
+
+	var replayRecs <-chan *kgo.Record
+	if *replayPath != "" {
+		if *consumeMode || *rawProduceMode || *clientLib != "franz-go" {
+			die("-replay only applies to producing with franz-go")
+		}
+		if *topic == "" {
+			die("a topic is required with -replay")
+		}
+		replayRecs = replaySource(replayFiles(*replayPath), *replayTiming)
+	} else if *replayTiming {
+		die("-replay-timing requires -replay")
+	}
+
+	if *autoBackoffOn {
+		if *rate == 0 {
+			die("-auto-backoff requires a -rate to back off from")
+		}
+		if *consumeMode || *rawProduceMode || *clientLib != "franz-go" {
+			die("-auto-backoff only applies to producing with franz-go")
+		}
+		if *backoffWindow < time.Second {
+			die("-backoff-window must be at least 1s")
+		}
+		go autoBackoff()
+	}
+	countProduceErrs = *autoBackoffOn || *assertMaxErrors >= 0
+
+	if *checksums && (*rawProduceMode || *idleMode || *eosTopic != "" || *offsetStorePath != "" || *clientLib != "franz-go") {
+		die("-checksum only applies to producing records or plain consuming with franz-go")
+	}
+
+	if *verifyMode {
+		if *rawProduceMode || *replayPath != "" || *idleMode || *eosTopic != "" || *offsetStorePath != "" || *clientLib != "franz-go" {
+			die("-verify only applies to producing generated records or plain consuming with franz-go")
+		}
+		if *topic == "" {
+			die("a topic is required with -verify")
+		}
+		if *consumeMode {
+			verifying = newVerifier()
+		} else {
+			verifying = startVerifier(adminOpts, *topic)
+		}
+	}
+
+	if *tailLatency {
+		if *consumeMode || *rawProduceMode || *replayPath != "" || *idleMode || *clientLib != "franz-go" {
+			die("-tail-latency only applies to producing generated records with franz-go")
+		}
+		if *topic == "" || *rate == 0 {
+			die("-tail-latency requires a -topic and a low -rate to tail, e.g. -rate 10")
+		}
+		if *keyTopicCount != 0 || *fanOutSpec != "" || *workloadSpec != "" {
+			die("-tail-latency tails -topic, so cannot combine with -key-topics, -fan-out, or -workloads")
+		}
+		tailing = startTail(adminOpts, *topic)
+	}
+
+	var preloadTotal int
+	if *preloadSize != "" {
+		preloadTotal = parseBytes(*preloadSize)
+		if preloadTotal <= 0 {
+			die("invalid -preload size %q", *preloadSize)
+		}
+		if *topic == "" {
+			die("a topic is required with -preload")
+		}
+	}
+	lib, libOk := clientLibs[*clientLib]
+	if *clientLib != "franz-go" && !libOk {
+		die("unknown client library %s (alternatives are compiled in with build tags, e.g. -tags sarama)", *clientLib)
+	}
+
+	var resetAt int64
+	if *resetOffsetsTo != "" {
+		resetAt = parseResetOffsets(*resetOffsetsTo)
+	}
+
+	// Flags are checked: failing from here is the run failing.
+	if diag != nil {
+		diag.arm()
+	}
 
-	for i := 0; i < *clients; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-
-			client, err := kgo.NewClient(opts...)
-			chk(err, "unable to initialize client: %v", err)
-
-			var num int64
-			for {
-				r := kgo.SliceRecord(make([]byte, *recordSize))
-				formatValue(num, r.Value)
-				client.Produce(context.Background(), r, func(r *kgo.Record, err error) {
-					chk(err, "produce error: %v", err)
-					atomic.AddInt64(&rateRecs, 1)
-					atomic.AddInt64(&rateBytes, int64(*recordSize))
-				})
-				num++
+	if *healthSnapshot {
+		adm, err := kgo.NewClient(adminOpts...)
+		chk(err, "unable to initialize admin client: %v", err)
+		healthAdm = kadm.NewClient(adm)
+	}
+
+	if *reportLag > 0 {
+		if *group == "" {
+			die("-report-lag requires -group")
+		}
+		adm, err := kgo.NewClient(adminOpts...)
+		chk(err, "unable to initialize admin client: %v", err)
+		go printLag(kadm.NewClient(adm), *group, *reportLag)
+	}
+
+	sinks = parseSinks(*sinkSpec)
+	if *uiMode {
+		for i, s := range sinks {
+			if _, ok := s.(stdoutSink); ok {
+				sinks[i] = newUISink()
 			}
-		}()
+		}
+	}
+	if coord != nil {
+		sinks = append(sinks, coord)
+	}
+	if diag != nil {
+		sinks = append(sinks, diag)
+	}
+
+	if *allocsEvery > 0 {
+		startAllocReports(*allocsEvery)
 	}
 
-	wg.Wait()
+	if *debugAddr != "" {
+		serveDebug(*debugAddr)
+	}
+
+	var topicParts []int32
+	if *offsetStorePath != "" || *assignPartitions {
+		adm, err := kgo.NewClient(adminOpts...)
+		chk(err, "unable to initialize admin client: %v", err)
+		topics, err := kadm.NewClient(adm).ListTopics(context.Background(), *topic)
+		if err == nil {
+			err = topics.Error()
+		}
+		chk(err, "unable to list partitions of %s: %v", *topic, err)
+		topicParts = topics[*topic].Partitions.Numbers()
+		adm.Close()
+		if len(topicParts) == 0 {
+			die("topic %s has no partitions", *topic)
+		}
+	}
+	if *assignPartitions {
+		partitionCounts = make([]partitionRate, slices.Max(topicParts)+1)
+	}
+	if *offsetStorePath != "" {
+		store = loadOffsetStore(*offsetStorePath)
+		interval := *commitInterval
+		if interval == 0 {
+			interval = time.Second
+		}
+		go store.flushEvery(interval)
+	}
+
+	if *controlAddr != "" {
+		serveControl(*controlAddr)
+	}
+
+	if *preloadSize != "" {
+		preload(produceOpts, int64(preloadTotal))
+		// Hooks saw the preload too; drop that from the first rate line.
+		swapRateReport(time.Second)
+		lastProduceLat = produceLat.snapshot()
+	}
+	if *resetOffsetsTo != "" {
+		resetOffsets(adminOpts, *resetOffsetsTo, resetAt)
+	}
+	cumulativePercentiles = cumulative
+
+	if coord != nil {
+		coord.waitForStart()
+	}
+	go printRate()
+
+	if *clientLib != "franz-go" {
+		live.start = lib()
+		runWorkload()
+		return
+	}
+
+	live.start = func(i int, stop <-chan struct{}) {
+		clientOpts := opts
+		if id := clientID(i); id != "" {
+			clientOpts = append(clientOpts[:len(clientOpts):len(clientOpts)], kgo.ClientID(id))
+		}
+		if *reportRouting {
+			clientOpts = append(clientOpts[:len(clientOpts):len(clientOpts)], kgo.WithHooks(routing.client()))
+		}
+		if len(codecs) > 1 {
+			clientOpts = append(clientOpts[:len(clientOpts):len(clientOpts)], kgo.ProducerBatchCompression(codecs[i%len(codecs)]))
+		}
+		if id := groupInstanceID(i); id != "" {
+			clientOpts = append(clientOpts[:len(clientOpts):len(clientOpts)], kgo.InstanceID(id))
+		}
+		if workloads != nil {
+			clientOpts = append(clientOpts[:len(clientOpts):len(clientOpts)], workloads[i%len(workloads)].opts...)
+		}
+		if *eosTopic != "" {
+			eos(i, clientOpts, stop)
+			return
+		}
+		var reads *readTracker
+		var giveUp []func(map[string][]int32)
+		if *historicalLag > 0 {
+			reads = newReadTracker()
+			clientOpts = append(clientOpts[:len(clientOpts):len(clientOpts)], kgo.WithHooks(reads))
+			giveUp = append(giveUp, reads.gaveUp)
+		}
+		if balancers != nil {
+			clientOpts = append(clientOpts[:len(clientOpts):len(clientOpts)], balancers[i%len(balancers)].opts(giveUp...)...)
+		} else if giveUp != nil {
+			clientOpts = append(clientOpts[:len(clientOpts):len(clientOpts)], givingUpOpts(giveUp...)...)
+		}
+
+		g := *group
+		if balancers != nil {
+			g = balancers[i%len(balancers)].group
+		}
+		var mc *memberCounts
+		if *reportFairness {
+			mc = member(i, g)
+		}
+		if *idleMode {
+			clientOpts = append(clientOpts[:len(clientOpts):len(clientOpts)], kgo.WithHooks(newIdleConns()))
+		}
+		var replicas *replicaTracker
+		if *rack != "" {
+			replicas = new(replicaTracker)
+			clientOpts = append(clientOpts[:len(clientOpts):len(clientOpts)], kgo.WithHooks(replicas))
+		}
+		var parts []int32
+		if *assignPartitions {
+			parts = assignedPartitions(i, *clients, topicParts)
+			clientOpts = append(clientOpts[:len(clientOpts):len(clientOpts)], kgo.RecordPartitioner(kgo.ManualPartitioner()))
+		}
+		if store != nil {
+			clientOpts = append(clientOpts[:len(clientOpts):len(clientOpts)], kgo.ConsumePartitions(store.assigned(i, *clients, topicParts)))
+		}
+		client, err := kgo.NewClient(clientOpts...)
+		chk(err, "unable to initialize client: %v", err)
+		defer client.Close()
+		if replicas != nil {
+			replicas.client.Store(client)
+		}
+		if *reportBuffered || leaks != nil && leaks.buffered {
+			defer trackBuffered(client)()
+		}
+		if *metadataRefreshEvery > 0 {
+			go refreshMetadata(client, stop)
+		}
+		if *bounceEvery > 0 {
+			defer bounces.member(i, g, client)()
+		}
+
+		rng := seededRand("client", i)
+		switch {
+		case store != nil:
+			consumeExternal(client, rng, stop)
+		case *consumeMode:
+			consume(client, reads, mc, rng, stop)
+		case *rawProduceMode:
+			rawProduce(client, rng, stop)
+		case *idleMode:
+			idle(client, rng, stop)
+		case replayRecs != nil:
+			replayProduce(client, replayRecs, stop)
+		default:
+			produce(client, parts, rng, stop)
+		}
+	}
+	runWorkload()
 }
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// newNetDialer returns the dialer every broker connection starts from, with
+// -dial-timeout and, if set, -socket-send-buffer and -socket-recv-buffer.
+// The buffers are set before connecting, since the receive buffer bounds
+// the TCP window scale negotiated in the handshake; on high bandwidth-delay
+// links the kernel's defaults can cap a connection's throughput well below
+// the link's.
+func newNetDialer() *net.Dialer {
+	if *dialTimeout <= 0 {
+		die("-dial-timeout must be positive")
+	}
+	d := &net.Dialer{Timeout: *dialTimeout}
+	sndBuf, rcvBuf := socketBufferSize("send", *socketSendBuffer), socketBufferSize("recv", *socketRecvBuffer)
+	if sndBuf == 0 && rcvBuf == 0 {
+		return d
+	}
+	if !socketBuffersSupported {
+		die("-socket-send-buffer and -socket-recv-buffer are only supported on unix")
+	}
+	d.Control = func(_, _ string, c syscall.RawConn) error {
+		var err error
+		if cerr := c.Control(func(fd uintptr) {
+			if sndBuf > 0 {
+				err = setSocketBuffer(fd, "send", sndBuf)
+			}
+			if rcvBuf > 0 && err == nil {
+				err = setSocketBuffer(fd, "recv", rcvBuf)
+			}
+		}); cerr != nil {
+			return cerr
+		}
+		return err
+	}
+	return d
+}
+
+func socketBufferSize(which, size string) int {
+	if size == "" {
+		return 0
+	}
+	n := parseBytes(size)
+	if n <= 0 {
+		die("invalid -socket-%s-buffer size %q", which, size)
+	}
+	return n
+}
+
+// shortBufferOnce warns once that the kernel gave a socket less buffer than
+// asked for, as Linux does past net.core.wmem_max and rmem_max.
+var shortBufferOnce sync.Once
+
+func warnShortBuffer(which string, want, got int) {
+	shortBufferOnce.Do(func() {
+		fmt.Fprintf(os.Stderr, "asked for a %d byte socket %s buffer but the kernel allowed %d; raise its limit (e.g. sysctl net.core.%smem_max) to use more\n",
+			want, which, got, map[string]string{"send": "w", "recv": "r"}[which])
+	})
+}
+
+// brokerMaxBytes parses -broker-max-write-bytes or -broker-max-read-bytes.
+func brokerMaxBytes(name, size string) int32 {
+	n := parseBytes(size)
+	if n <= 0 || n > 1<<31-1 {
+		die("invalid -%s %q", name, size)
+	}
+	return int32(n)
+}
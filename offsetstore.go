@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// offsetStore keeps consumer positions in a local file rather than in Kafka,
+// like applications that commit offsets alongside their own state. Clients
+// split the topic's partitions between them (partition % clients), consume
+// them directly without a group, and record positions here; the store is
+// periodically written to disk like a commit.
+//
+// On startup, each partition's first record is checked against the stored
+// position, and every later record against the previous one, so a restart
+// (or kill -9) shows whether consumption resumed exactly where it left off.
+type offsetStore struct {
+	path string
+
+	mu      sync.Mutex
+	offsets map[int32]int64 // partition => next offset to consume
+	resumed map[int32]bool  // partitions seen since startup
+	pending int             // stored partitions not yet resumed
+	bad     int             // partitions that resumed elsewhere
+}
+
+type offsetFile struct {
+	Topic   string          `json:"topic"`
+	Offsets map[int32]int64 `json:"offsets"`
+}
+
+var store *offsetStore
+
+func loadOffsetStore(path string) *offsetStore {
+	s := &offsetStore{
+		path:    path,
+		offsets: make(map[int32]int64),
+		resumed: make(map[int32]bool),
+	}
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s
+	}
+	chk(err, "unable to read offset store %s: %v", path, err)
+	var f offsetFile
+	err = json.Unmarshal(raw, &f)
+	chk(err, "unable to parse offset store %s: %v", path, err)
+	if f.Topic != *topic {
+		die("offset store %s is for topic %s, not %s", path, f.Topic, *topic)
+	}
+	if f.Offsets != nil {
+		s.offsets = f.Offsets
+	}
+	s.pending = len(s.offsets)
+	fmt.Fprintf(os.Stderr, "resuming %d partitions from offset store %s\n", len(s.offsets), path)
+	return s
+}
+
+// assigned returns where client idx of n starts each of its partitions.
+func (s *offsetStore) assigned(idx, n int, partitions []int32) map[string]map[int32]kgo.Offset {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	offsets := make(map[int32]kgo.Offset)
+	for _, p := range partitions {
+		if int(p)%n != idx {
+			continue
+		}
+		if at, ok := s.offsets[p]; ok {
+			offsets[p] = kgo.NewOffset().At(at)
+		} else {
+			offsets[p] = parseConsumeFrom(*consumeFrom)
+		}
+	}
+	return map[string]map[int32]kgo.Offset{*topic: offsets}
+}
+
+// consumed verifies and records one partition's fetched records.
+func (s *offsetStore) consumed(p kgo.FetchTopicPartition) {
+	if len(p.Records) == 0 {
+		return
+	}
+	first, last := p.Records[0].Offset, p.Records[len(p.Records)-1].Offset
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	at, stored := s.offsets[p.Partition]
+	switch {
+	case !s.resumed[p.Partition] && stored:
+		s.resumed[p.Partition] = true
+		s.pending--
+		if first != at {
+			s.bad++
+			fmt.Fprintf(os.Stderr, "partition %d resumed at offset %d, but the store has %d\n", p.Partition, first, at)
+		}
+		if s.pending == 0 {
+			fmt.Fprintf(os.Stderr, "every stored partition resumed; %d at the wrong offset\n", s.bad)
+		}
+	case stored && first < at:
+		fmt.Fprintf(os.Stderr, "partition %d rewound to offset %d after consuming up to %d\n", p.Partition, first, at-1)
+	}
+	s.resumed[p.Partition] = true
+	s.offsets[p.Partition] = last + 1
+}
+
+// flush writes the store atomically (temp file, fsync, rename), counting it
+// as a commit.
+func (s *offsetStore) flush() {
+	s.mu.Lock()
+	raw, err := json.Marshal(offsetFile{Topic: *topic, Offsets: s.offsets})
+	s.mu.Unlock()
+	chk(err, "unable to encode offset store: %v", err)
+
+	start := time.Now()
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp*")
+	if err == nil {
+		_, err = tmp.Write(raw)
+		if err == nil {
+			err = tmp.Sync()
+		}
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(tmp.Name(), s.path)
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}
+	atomic.AddInt64(&commitReqs, 1)
+	commitLat.observe(time.Since(start))
+	if err != nil {
+		atomic.AddInt64(&commitErrors, 1)
+		fmt.Fprintf(os.Stderr, "unable to write offset store %s: %v\n", s.path, err)
+	}
+}
+
+func (s *offsetStore) flushEvery(interval time.Duration) {
+	for range time.Tick(interval) {
+		s.flush()
+	}
+}
+
+// consumeExternal is consume for -offset-store: records go to the store
+// rather than being committed, and the store is flushed once stopped.
+func consumeExternal(client *kgo.Client, rng *rand.Rand, stop <-chan struct{}) {
+	var (
+		ctx      = stopContext(stop)
+		lastPoll time.Time
+	)
+	defer store.flush()
+	for waitUnpaused(stop) {
+		fetches := poll(ctx, client, &lastPoll)
+		if ctx.Err() != nil {
+			return
+		}
+		fetches.EachError(func(t string, p int32, err error) {
+			die("fetch error on %s/%d: %v", t, p, err)
+		})
+
+		var recs, bytes int64
+		fetches.EachPartition(func(p kgo.FetchTopicPartition) {
+			for _, r := range p.Records {
+				recs++
+				bytes += int64(len(r.Value))
+			}
+			store.consumed(p)
+		})
+		if processing != nil {
+			processing.process(recs, rng)
+		}
+		atomic.AddInt64(&rateRecs, recs)
+		atomic.AddInt64(&rateBytes, bytes)
+	}
+}
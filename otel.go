@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/plugin/kotel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// tracing is the provider exporting spans for -otlp-endpoint, whose last
+// spans are only exported by shutting it down.
+var tracing *sdktrace.TracerProvider
+
+// stopTracing exports every span still batched and stops the provider,
+// giving up after ten seconds.
+func stopTracing() {
+	if tracing == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	tracing.Shutdown(ctx)
+}
+
+// otelHooks returns kotel hooks that trace produced and fetched records,
+// exporting spans over OTLP/HTTP to endpoint. The endpoint is either a
+// host:port (plaintext) or a full http(s):// URL.
+//
+// Trace context is injected into record headers with the W3C propagator, so
+// anything consuming what we produce can join the same trace.
+func otelHooks(endpoint string, sampleRatio float64) []kgo.Hook {
+	expOpts := []otlptracehttp.Option{otlptracehttp.WithEndpointURL(endpoint)}
+	if !strings.Contains(endpoint, "://") {
+		expOpts = []otlptracehttp.Option{otlptracehttp.WithEndpoint(endpoint), otlptracehttp.WithInsecure()}
+	}
+	exp, err := otlptracehttp.New(context.Background(), expOpts...)
+	chk(err, "unable to create otlp exporter: %v", err)
+
+	tracing = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "big-kafka-conn"))),
+	)
+
+	tracer := kotel.NewTracer(
+		kotel.TracerProvider(tracing),
+		kotel.TracerPropagator(propagation.TraceContext{}),
+	)
+	return kotel.NewKotel(kotel.WithTracer(tracer)).Hooks()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// partitionCounts is what was produced to each partition since the last
+// report, for -assign-partitions, indexed by partition.
+var partitionCounts []partitionRate
+
+type partitionRate struct {
+	Partition int32 `json:"partition"`
+	Records   int64 `json:"records"`
+	Bytes     int64 `json:"bytes"`
+}
+
+// assignedPartitions returns the partitions client idx of n produces to
+// with -assign-partitions: those p with p%n == idx, the same split as
+// -offset-store consumers use. With more clients than partitions, clients
+// share partitions instead, so that every client has one.
+func assignedPartitions(idx, n int, partitions []int32) []int32 {
+	var assigned []int32
+	for _, p := range partitions {
+		if int(p)%n == idx {
+			assigned = append(assigned, p)
+		}
+	}
+	if len(assigned) == 0 {
+		assigned = []int32{partitions[idx%len(partitions)]}
+	}
+	return assigned
+}
+
+// producedTo counts one record acknowledged from partition p.
+func producedTo(p int32, bytes int) {
+	if int(p) < len(partitionCounts) {
+		atomic.AddInt64(&partitionCounts[p].Records, 1)
+		atomic.AddInt64(&partitionCounts[p].Bytes, int64(bytes))
+	}
+}
+
+// partitionReport is what each partition was produced over one interval,
+// showing per-partition throughput ceilings when each client owns its
+// partitions.
+type partitionReport struct {
+	Interval   time.Duration   `json:"interval_ns"`
+	Partitions []partitionRate `json:"partitions"`
+}
+
+func swapPartitionReport(interval time.Duration) *partitionReport {
+	r := &partitionReport{Interval: interval, Partitions: make([]partitionRate, len(partitionCounts))}
+	for p := range partitionCounts {
+		r.Partitions[p] = partitionRate{
+			Partition: int32(p),
+			Records:   atomic.SwapInt64(&partitionCounts[p].Records, 0),
+			Bytes:     atomic.SwapInt64(&partitionCounts[p].Bytes, 0),
+		}
+	}
+	return r
+}
+
+func (r *partitionReport) String() string {
+	lo, hi := int64(math.MaxInt64), int64(0)
+	for _, p := range r.Partitions {
+		lo, hi = min(lo, p.Bytes), max(hi, p.Bytes)
+	}
+	if len(r.Partitions) == 0 {
+		lo = 0
+	}
+	secs := r.Interval.Seconds()
+	return fmt.Sprintf("per partition min %0.2f MiB/s, max %0.2f MiB/s", float64(lo)/secs/(1024*1024), float64(hi)/secs/(1024*1024))
+}
+
+func (r *partitionReport) metrics() []metric {
+	var ms []metric
+	for _, p := range r.Partitions {
+		labels := []string{"partition", strconv.Itoa(int(p.Partition))}
+		ms = append(ms,
+			metric{name: "partition_records", labels: labels, value: float64(p.Records), counter: true},
+			metric{name: "partition_bytes", labels: labels, value: float64(p.Bytes), counter: true},
+		)
+	}
+	return ms
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+var (
+	partitionPauses int64 // pause cycles started since the last report
+	pausedNow       int64 // partitions paused right now, across clients
+)
+
+// pauseChaos periodically pauses fetching a random -pause-fraction of the
+// partitions a consumer has fetched from, resuming them -pause-for later,
+// to simulate slow downstream processing on part of the assignment. How
+// fetch sessions cope shows in fetch request sizes: an incremental fetch
+// lists only the partitions that changed, so pausing and resuming grows
+// requests a little, while a session the broker evicts or resets falls
+// back to full requests listing every partition. Memory shows as the heap
+// in use, as fetches keep buffering for the partitions still fetching.
+type pauseChaos struct {
+	mu   sync.Mutex
+	seen map[topicPartition]bool
+}
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// fetchRequests counts fetch requests written, for -pause-every.
+type fetchRequests struct {
+	requests int64 // since the last report
+	bytes    int64
+}
+
+var pauseFetches fetchRequests
+
+func (f *fetchRequests) OnBrokerWrite(_ kgo.BrokerMetadata, key int16, bytesWritten int, _, _ time.Duration, err error) {
+	if key == kmsg.Fetch.Int16() && err == nil {
+		atomic.AddInt64(&f.requests, 1)
+		atomic.AddInt64(&f.bytes, int64(bytesWritten))
+	}
+}
+
+func newPauseChaos() *pauseChaos {
+	return &pauseChaos{seen: make(map[topicPartition]bool)}
+}
+
+// fetched notes the partitions in fetches as candidates for pausing.
+func (c *pauseChaos) fetched(fetches kgo.Fetches) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fetches.EachPartition(func(p kgo.FetchTopicPartition) {
+		c.seen[topicPartition{p.Topic, p.Partition}] = true
+	})
+}
+
+func (c *pauseChaos) run(client *kgo.Client, rng *rand.Rand, stop <-chan struct{}) {
+	tick := time.NewTicker(*pauseEvery)
+	defer tick.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-tick.C:
+		}
+
+		c.mu.Lock()
+		var candidates []topicPartition
+		for tp := range c.seen {
+			candidates = append(candidates, tp)
+		}
+		c.mu.Unlock()
+		sort.Slice(candidates, func(i, j int) bool {
+			l, r := candidates[i], candidates[j]
+			return l.topic < r.topic || l.topic == r.topic && l.partition < r.partition
+		})
+		rng.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+		n := int(float64(len(candidates))**pauseFraction + 0.5)
+		if n == 0 {
+			continue
+		}
+		chosen := make(map[string][]int32)
+		for _, tp := range candidates[:n] {
+			chosen[tp.topic] = append(chosen[tp.topic], tp.partition)
+		}
+
+		client.PauseFetchPartitions(chosen)
+		atomic.AddInt64(&partitionPauses, 1)
+		atomic.AddInt64(&pausedNow, int64(n))
+		select {
+		case <-stop:
+		case <-time.After(*pauseFor):
+		}
+		client.ResumeFetchPartitions(chosen)
+		atomic.AddInt64(&pausedNow, -int64(n))
+	}
+}
+
+// pauseReport is the partition pausing done over one interval, and how
+// fetching fared.
+type pauseReport struct {
+	Pauses        int64  `json:"pauses"`
+	Paused        int64  `json:"paused_partitions"`
+	FetchRequests int64  `json:"fetch_requests"`
+	FetchBytes    int64  `json:"fetch_request_bytes"`
+	HeapInuse     uint64 `json:"heap_inuse_bytes"` // as of the report
+}
+
+func swapPauseReport() *pauseReport {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return &pauseReport{
+		Pauses:        atomic.SwapInt64(&partitionPauses, 0),
+		Paused:        atomic.LoadInt64(&pausedNow),
+		FetchRequests: atomic.SwapInt64(&pauseFetches.requests, 0),
+		FetchBytes:    atomic.SwapInt64(&pauseFetches.bytes, 0),
+		HeapInuse:     ms.HeapInuse,
+	}
+}
+
+func (r *pauseReport) String() string {
+	var mean int64
+	if r.FetchRequests > 0 {
+		mean = r.FetchBytes / r.FetchRequests
+	}
+	return fmt.Sprintf("%d partition pauses, %d partitions paused; %d fetch requests of %d bytes on average, %0.1f MiB heap in use",
+		r.Pauses, r.Paused, r.FetchRequests, mean, float64(r.HeapInuse)/(1<<20))
+}
+
+func (r *pauseReport) metrics() []metric {
+	return []metric{
+		{name: "partition_pauses", value: float64(r.Pauses), counter: true},
+		{name: "paused_partitions", value: float64(r.Paused)},
+		{name: "fetch_requests", value: float64(r.FetchRequests), counter: true},
+		{name: "fetch_request_bytes", value: float64(r.FetchBytes), counter: true},
+		{name: "heap_inuse_bytes", value: float64(r.HeapInuse)},
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// payloadTemplate renders JSON record values from a template such as
+//
+//	{"user_id": {{int:1-1000}}, "seq": {{seq}}, "name": "{{str:8}}"}
+//
+// with each placeholder replaced per record:
+//
+//	{{seq}}         the client's record number
+//	{{int:MIN-MAX}} a uniformly random integer in [MIN, MAX]
+//	{{str:N}}       N random lowercase letters
+//	{{choice:a|b}}  one of the |-delimited options
+//	{{now}}         the current unix time in milliseconds
+//
+// Placeholders render bare; quote them in the template to produce strings.
+type payloadTemplate struct {
+	segs []tmplSeg
+
+	// If keying by a field, the field's value is either the output of
+	// one placeholder (keySeg) or a constant in the template (constKey).
+	keySeg   int
+	constKey []byte
+}
+
+type tmplSeg struct {
+	lit []byte
+	gen func(dst []byte, seq int64, rng *rand.Rand) []byte // nil for literals
+}
+
+// parsePayloadTemplate parses spec, or the file it names if spec starts with
+// '@', and if keyField is non-empty resolves which part of the template the
+// (dot separated) field's value comes from.
+func parsePayloadTemplate(spec, keyField string) *payloadTemplate {
+	if strings.HasPrefix(spec, "@") {
+		raw, err := os.ReadFile(spec[1:])
+		chk(err, "unable to read value template %s: %v", spec[1:], err)
+		spec = strings.TrimSpace(string(raw))
+	}
+
+	t := &payloadTemplate{keySeg: -1}
+	for rem := spec; len(rem) > 0; {
+		start := strings.Index(rem, "{{")
+		if start < 0 {
+			t.segs = append(t.segs, tmplSeg{lit: []byte(rem)})
+			break
+		}
+		end := strings.Index(rem[start:], "}}")
+		if end < 0 {
+			die("value template has an unterminated placeholder at %q", rem[start:])
+		}
+		if start > 0 {
+			t.segs = append(t.segs, tmplSeg{lit: []byte(rem[:start])})
+		}
+		t.segs = append(t.segs, tmplSeg{gen: parsePlaceholder(rem[start+2 : start+end])})
+		rem = rem[start+end+2:]
+	}
+
+	// Render once with every placeholder replaced by a unique sentinel
+	// number: this validates the template is JSON, and whichever sentinel
+	// lands in the key field tells us which placeholder renders the key.
+	const sentinelBase = 987654321000
+	var probe []byte
+	for i, seg := range t.segs {
+		if seg.gen == nil {
+			probe = append(probe, seg.lit...)
+		} else {
+			probe = strconv.AppendInt(probe, int64(sentinelBase+i), 10)
+		}
+	}
+	var doc interface{}
+	dec := json.NewDecoder(bytes.NewReader(probe))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		die("value template is not valid JSON (%v): %s", err, probe)
+	}
+	if keyField == "" {
+		return t
+	}
+
+	v := doc
+	for _, name := range strings.Split(keyField, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			die("key field %q is not within a JSON object in the value template", keyField)
+		}
+		if v, ok = m[name]; !ok {
+			die("key field %q is not in the value template", keyField)
+		}
+	}
+	switch v := v.(type) {
+	case json.Number:
+		for i, seg := range t.segs {
+			if seg.gen != nil && string(v) == strconv.Itoa(sentinelBase+i) {
+				t.keySeg = i
+				return t
+			}
+		}
+		t.constKey = []byte(v)
+		return t
+	case string:
+		for i, seg := range t.segs {
+			if seg.gen == nil || !strings.Contains(v, strconv.Itoa(sentinelBase+i)) {
+				continue
+			}
+			if v != strconv.Itoa(sentinelBase+i) {
+				die("key field %q must be a constant or exactly one placeholder", keyField)
+			}
+			t.keySeg = i
+			return t
+		}
+		t.constKey = []byte(v)
+		return t
+	case bool:
+		t.constKey = []byte(strconv.FormatBool(v))
+		return t
+	default:
+		die("key field %q must be a string, number, or bool", keyField)
+		return nil
+	}
+}
+
+func parsePlaceholder(p string) func([]byte, int64, *rand.Rand) []byte {
+	name, arg := p, ""
+	if i := strings.IndexByte(p, ':'); i >= 0 {
+		name, arg = p[:i], p[i+1:]
+	}
+	switch name {
+	case "seq":
+		return func(dst []byte, seq int64, _ *rand.Rand) []byte {
+			return strconv.AppendInt(dst, seq, 10)
+		}
+	case "now":
+		return func(dst []byte, _ int64, _ *rand.Rand) []byte {
+			return strconv.AppendInt(dst, time.Now().UnixNano()/1e6, 10)
+		}
+	case "int":
+		bounds := strings.SplitN(arg, "-", 2)
+		if len(bounds) != 2 {
+			die("invalid placeholder {{%s}}, expected {{int:MIN-MAX}}", p)
+		}
+		min, err1 := strconv.ParseInt(bounds[0], 10, 64)
+		max, err2 := strconv.ParseInt(bounds[1], 10, 64)
+		if err1 != nil || err2 != nil || max < min {
+			die("invalid placeholder {{%s}}, expected {{int:MIN-MAX}}", p)
+		}
+		return func(dst []byte, _ int64, rng *rand.Rand) []byte {
+			return strconv.AppendInt(dst, min+rng.Int63n(max-min+1), 10)
+		}
+	case "str":
+		n, err := strconv.Atoi(arg)
+		if err != nil || n <= 0 {
+			die("invalid placeholder {{%s}}, expected {{str:N}}", p)
+		}
+		return func(dst []byte, _ int64, rng *rand.Rand) []byte {
+			for i := 0; i < n; i++ {
+				dst = append(dst, byte('a'+rng.Intn(26)))
+			}
+			return dst
+		}
+	case "choice":
+		opts := strings.Split(arg, "|")
+		if arg == "" {
+			die("invalid placeholder {{%s}}, expected {{choice:a|b|...}}", p)
+		}
+		return func(dst []byte, _ int64, rng *rand.Rand) []byte {
+			return append(dst, opts[rng.Intn(len(opts))]...)
+		}
+	default:
+		die("unknown value template placeholder {{%s}}", p)
+		return nil
+	}
+}
+
+// render returns the value for record number seq and, if keying by a field,
+// the key. The key aliases the value.
+func (t *payloadTemplate) render(seq int64, rng *rand.Rand) (value, key []byte) {
+	keyStart, keyEnd := -1, -1
+	for i, seg := range t.segs {
+		if seg.gen == nil {
+			value = append(value, seg.lit...)
+			continue
+		}
+		start := len(value)
+		value = seg.gen(value, seq, rng)
+		if i == t.keySeg {
+			keyStart, keyEnd = start, len(value)
+		}
+	}
+	if keyStart >= 0 {
+		key = value[keyStart:keyEnd:keyEnd]
+	} else if t.constKey != nil {
+		key = t.constKey
+	}
+	return value, key
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// recordPool is where -pool-records producers take records from and their
+// promises return them to, value buffers and all, so that producing
+// generated records allocates nothing of its own per record. kgo is done
+// with a record once its promise is called.
+var recordPool sync.Pool
+
+// Pool use since the last report: records taken, records the pool had none
+// to reuse for, and reused records whose value had to grow.
+var (
+	poolGets  int64
+	poolNews  int64
+	poolGrows int64
+)
+
+// pooledRecord returns producer's num'th record, reusing a pooled one.
+func pooledRecord(num int64, rng *rand.Rand) *kgo.Record {
+	atomic.AddInt64(&poolGets, 1)
+	r, _ := recordPool.Get().(*kgo.Record)
+	if r == nil {
+		atomic.AddInt64(&poolNews, 1)
+		r = new(kgo.Record)
+	}
+
+	// Templates and schemas render their own values.
+	if payloadTmpl != nil || schemaVals != nil {
+		value, key := newValue(num, rng)
+		*r = kgo.Record{Key: key, Value: value}
+		return r
+	}
+	size := valueSizer.next(rng)
+	value := r.Value[:0]
+	if cap(value) < size {
+		if cap(value) > 0 {
+			atomic.AddInt64(&poolGrows, 1)
+		}
+		value = make([]byte, size)
+	}
+	*r = kgo.Record{Value: value[:size]}
+	formatValue(num, r.Value)
+	return r
+}
+
+// producedPooled is the promise for pooled records.
+func producedPooled(r *kgo.Record, err error) {
+	produced(r, err)
+	recordPool.Put(r)
+}
+
+// poolReport is how well records were reused over one interval.
+type poolReport struct {
+	Gets  int64 `json:"gets"`
+	New   int64 `json:"new"`
+	Grown int64 `json:"grown"`
+}
+
+func swapPoolReport() *poolReport {
+	return &poolReport{
+		Gets:  atomic.SwapInt64(&poolGets, 0),
+		New:   atomic.SwapInt64(&poolNews, 0),
+		Grown: atomic.SwapInt64(&poolGrows, 0),
+	}
+}
+
+func (r *poolReport) String() string {
+	reused := 0.0
+	if r.Gets > 0 {
+		reused = float64(r.Gets-r.New) / float64(r.Gets) * 100
+	}
+	return fmt.Sprintf("pool %0.1f%% of records reused, %d new, %d grown", reused, r.New, r.Grown)
+}
+
+func (r *poolReport) metrics() []metric {
+	return []metric{
+		{name: "pool_gets", value: float64(r.Gets), counter: true},
+		{name: "pool_new", value: float64(r.New), counter: true},
+		{name: "pool_grown", value: float64(r.Grown), counter: true},
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// preload writes total bytes of values into the topic, unpaced, before the
+// measured workload starts, so that read benchmarks have data to read. It
+// uses -num-clients producers and prints progress every second; none of it
+// counts toward the run's rates or summary.
+func preload(opts []kgo.Opt, total int64) {
+	markPhase("preload")
+	var (
+		written  int64 // bytes acknowledged
+		claimed  int64 // bytes handed to producers
+		wg       sync.WaitGroup
+		start    = time.Now()
+		doneProg = make(chan struct{})
+	)
+	go func() {
+		last := int64(0)
+		for {
+			select {
+			case <-doneProg:
+				return
+			case <-time.After(time.Second):
+			}
+			now := atomic.LoadInt64(&written)
+			fmt.Fprintf(os.Stderr, "preload: %0.2f of %0.2f GiB (%0.1f%%), %0.2f MiB/s\n",
+				float64(now)/(1<<30), float64(total)/(1<<30), 100*float64(now)/float64(total), float64(now-last)/(1<<20))
+			last = now
+		}
+	}()
+
+	for i := 0; i < *clients; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			clientOpts := opts
+			if id := clientID(i); id != "" {
+				clientOpts = append(opts[:len(opts):len(opts)], kgo.ClientID(id))
+			}
+			client, err := kgo.NewClient(clientOpts...)
+			chk(err, "unable to initialize preload client: %v", err)
+			defer client.Close()
+
+			rng := seededRand("preload", i)
+			for num := int64(0); ; num++ {
+				value, key := newValue(num, rng)
+				n := int64(len(value))
+				if atomic.AddInt64(&claimed, n)-n >= total {
+					break
+				}
+				r := kgo.SliceRecord(value)
+				r.Key = key
+				client.Produce(context.Background(), r, func(r *kgo.Record, err error) {
+					chk(err, "preload produce error: %v", err)
+					atomic.AddInt64(&written, int64(len(r.Value)))
+				})
+			}
+			client.Flush(context.Background())
+		}()
+	}
+	wg.Wait()
+	close(doneProg)
+
+	elapsed := time.Since(start)
+	fmt.Fprintf(os.Stderr, "preload: wrote %0.2f GiB in %v (%0.2f MiB/s)\n",
+		float64(written)/(1<<30), elapsed.Round(time.Millisecond), float64(written)/(1<<20)/elapsed.Seconds())
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// processBusy is the simulated processing time spent by all consumers since
+// the last report, in nanoseconds.
+var processBusy int64
+
+// processTime is a parsed -process-time: how long each consumed record takes
+// to process.
+type processTime struct {
+	lo, hi time.Duration // uniform bounds; equal if fixed
+	dist   *lognormal    // in ns
+	limit  time.Duration // clamping draws from dist
+}
+
+// maxProcessTimes clamps lognormal processing times to this many times
+// the mean, so that one draw from the far tail cannot stall a consumer for
+// minutes and get it kicked from its group.
+const maxProcessTimes = 100
+
+// parseProcessTime parses -process-time:
+//
+//	DURATION               every record takes this long, e.g. 200us
+//	uniform:MIN-MAX        uniformly random within [MIN, MAX]
+//	lognormal:MEAN,STDDEV  log-normal with this mean and standard deviation,
+//	                       clamped to maxProcessTimes the mean
+func parseProcessTime(spec string) *processTime {
+	kind, arg, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "uniform":
+		bounds := strings.SplitN(arg, "-", 2)
+		if len(bounds) != 2 {
+			die("invalid uniform -process-time %q, expected uniform:MIN-MAX", spec)
+		}
+		lo, err1 := time.ParseDuration(bounds[0])
+		hi, err2 := time.ParseDuration(bounds[1])
+		if err1 != nil || err2 != nil || lo < 0 || hi < lo {
+			die("invalid uniform -process-time bounds %q", arg)
+		}
+		return &processTime{lo: lo, hi: hi}
+	case "lognormal":
+		l, mean, ok := parseLognormal(arg, func(v string) (float64, bool) {
+			d, err := time.ParseDuration(v)
+			return float64(d), err == nil
+		})
+		if !ok {
+			die("invalid lognormal -process-time %q, expected lognormal:MEAN,STDDEV with a positive mean", spec)
+		}
+		return &processTime{dist: &l, limit: time.Duration(maxProcessTimes * mean)}
+	default:
+		d, err := time.ParseDuration(spec)
+		if err != nil || d < 0 {
+			die("invalid -process-time %q, expected a duration, uniform:MIN-MAX, or lognormal:MEAN,STDDEV", spec)
+		}
+		return &processTime{lo: d, hi: d}
+	}
+}
+
+func (p *processTime) next(rng *rand.Rand) time.Duration {
+	switch {
+	case p.dist != nil:
+		return min(time.Duration(p.dist.draw(rng)), p.limit)
+	case p.hi > p.lo:
+		return p.lo + time.Duration(rng.Int63n(int64(p.hi-p.lo)+1))
+	default:
+		return p.lo
+	}
+}
+
+// process simulates processing n consumed records before the next poll, by
+// sleeping or, with -process-cpu, spinning for their total processing time.
+// Records are processed in one go per poll, as sleeping per record would
+// oversleep sub-millisecond times.
+func (p *processTime) process(n int64, rng *rand.Rand) {
+	var total time.Duration
+	for i := int64(0); i < n; i++ {
+		total += p.next(rng)
+	}
+	if total <= 0 {
+		return
+	}
+	atomic.AddInt64(&processBusy, int64(total))
+	if !*processCPU {
+		time.Sleep(total)
+		return
+	}
+	for end := time.Now().Add(total); time.Now().Before(end); {
+	}
+}
+
+// processReport is the simulated processing over one interval. Utilization
+// near 1 means consumers are bound by processing rather than fetching.
+type processReport struct {
+	Busy        time.Duration `json:"busy_ns"`
+	Utilization float64       `json:"utilization"` // busy time per consumer per interval
+}
+
+func swapProcessReport(interval time.Duration) *processReport {
+	r := &processReport{Busy: time.Duration(atomic.SwapInt64(&processBusy, 0))}
+	if n := atomic.LoadInt64(&live.clients); n > 0 {
+		r.Utilization = float64(r.Busy) / float64(interval) / float64(n)
+	}
+	return r
+}
+
+func (r *processReport) String() string {
+	return fmt.Sprintf("processing %0.1f%% busy", 100*r.Utilization)
+}
+
+func (r *processReport) metrics() []metric {
+	return []metric{
+		{name: "process_busy_seconds", value: r.Busy.Seconds(), counter: true},
+		{name: "process_utilization", value: r.Utilization},
+	}
+}
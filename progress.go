@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// progressReport is where the run stands as of a rate report: its totals so
+// far and, when it stops on its own after -duration or -num-records, how
+// long until it does.
+type progressReport struct {
+	Elapsed time.Duration  `json:"elapsed_ns"`
+	Records int64          `json:"records"`
+	Bytes   int64          `json:"bytes"`
+	Errors  int64          `json:"errors"`
+	ETA     *time.Duration `json:"eta_ns,omitempty"`
+}
+
+// progress reports the totals as of now. It runs once the latest interval
+// is added to them.
+func progress() *progressReport {
+	p := &progressReport{
+		Elapsed: rates.elapsed(),
+		Records: atomic.LoadInt64(&totalRecs),
+		Bytes:   atomic.LoadInt64(&totalBytes),
+		Errors:  atomic.LoadInt64(&totalErrs) + atomic.LoadInt64(&produceErrors),
+	}
+	var eta time.Duration = -1
+	if *runFor > 0 {
+		eta = max(*runFor-p.Elapsed, 0)
+	}
+	// The records left at the average rate so far; until anything is
+	// counted there is no rate to go by.
+	if *numRecords > 0 && p.Records > 0 {
+		left := time.Duration(float64(max(*numRecords-p.Records, 0)) / float64(p.Records) * float64(p.Elapsed))
+		if eta < 0 || left < eta {
+			eta = left
+		}
+	}
+	if eta >= 0 {
+		p.ETA = &eta
+	}
+	return p
+}
+
+// stopAtNumRecords stops the run once -num-records are counted, checking
+// often enough that a fast run does not overshoot by much.
+func stopAtNumRecords() {
+	for range time.Tick(100 * time.Millisecond) {
+		if atomic.LoadInt64(&totalRecs)+atomic.LoadInt64(&rateRecs) >= *numRecords {
+			stopRun()
+			return
+		}
+	}
+}
+
+func (p *progressReport) String() string {
+	line := fmt.Sprintf("total %d records, %0.2f MiB, %d errors in %v",
+		p.Records, float64(p.Bytes)/(1024*1024), p.Errors, p.Elapsed.Round(time.Second))
+	if p.ETA != nil {
+		line += fmt.Sprintf(", ETA %v", p.ETA.Round(time.Second))
+	}
+	return line
+}
+
+func (p *progressReport) metrics() []metric {
+	ms := []metric{
+		{name: "elapsed_seconds", value: p.Elapsed.Seconds()},
+		{name: "total_records", value: float64(p.Records)},
+		{name: "total_bytes", value: float64(p.Bytes)},
+		{name: "total_errors", value: float64(p.Errors)},
+	}
+	if p.ETA != nil {
+		ms = append(ms, metric{name: "eta_seconds", value: p.ETA.Seconds()})
+	}
+	return ms
+}
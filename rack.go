@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// replicaReads is which replica served each partition's fetches since the
+// last report, for -rack: with follower fetching (KIP-392) brokers point
+// consumers at an in-rack follower, and the reads show how much traffic
+// actually stayed in the rack rather than crossing to the leader's.
+var replicaReads = struct {
+	mu    sync.Mutex
+	parts map[topicPartition]*replicaRead
+}{parts: make(map[topicPartition]*replicaRead)}
+
+type replicaRead struct {
+	broker   int32
+	rack     string // empty if the broker has none
+	follower bool
+	bytes    int64
+}
+
+// replicaTracker is one consumer's fetch hook, comparing the broker that
+// served each batch with the partition's leader in the client's metadata.
+type replicaTracker struct {
+	client atomic.Pointer[kgo.Client] // set once the client exists
+}
+
+func (t *replicaTracker) OnFetchBatchRead(meta kgo.BrokerMetadata, topic string, partition int32, m kgo.FetchBatchMetrics) {
+	leader := int32(-1)
+	if client := t.client.Load(); client != nil {
+		leader, _, _ = client.PartitionLeader(topic, partition)
+	}
+	var rack string
+	if meta.Rack != nil {
+		rack = *meta.Rack
+	}
+	tp := topicPartition{topic, partition}
+	replicaReads.mu.Lock()
+	defer replicaReads.mu.Unlock()
+	r := replicaReads.parts[tp]
+	if r == nil {
+		r = new(replicaRead)
+		replicaReads.parts[tp] = r
+	}
+	r.broker, r.rack = meta.NodeID, rack
+	r.follower = leader >= 0 && meta.NodeID != leader
+	r.bytes += int64(m.CompressedBytes)
+}
+
+// replicaReport is which replicas served fetches over one interval. A
+// partition read from several replicas in the interval, as when its
+// preferred replica moves, counts under the last.
+type replicaReport struct {
+	Rack          string             `json:"rack"`
+	LeaderBytes   int64              `json:"leader_bytes"`
+	FollowerBytes int64              `json:"follower_bytes"`
+	InRackBytes   int64              `json:"in_rack_bytes"`
+	Partitions    []replicaPartition `json:"partitions"`
+}
+
+type replicaPartition struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Broker    int32  `json:"broker"`
+	Rack      string `json:"rack,omitempty"`
+	Follower  bool   `json:"follower"`
+	Bytes     int64  `json:"bytes"`
+}
+
+func swapReplicaReport(rack string) *replicaReport {
+	replicaReads.mu.Lock()
+	parts := replicaReads.parts
+	replicaReads.parts = make(map[topicPartition]*replicaRead)
+	replicaReads.mu.Unlock()
+
+	r := &replicaReport{Rack: rack, Partitions: make([]replicaPartition, 0, len(parts))}
+	for tp, read := range parts {
+		if read.follower {
+			r.FollowerBytes += read.bytes
+		} else {
+			r.LeaderBytes += read.bytes
+		}
+		if read.rack == rack {
+			r.InRackBytes += read.bytes
+		}
+		r.Partitions = append(r.Partitions, replicaPartition{
+			Topic:     tp.topic,
+			Partition: tp.partition,
+			Broker:    read.broker,
+			Rack:      read.rack,
+			Follower:  read.follower,
+			Bytes:     read.bytes,
+		})
+	}
+	sort.Slice(r.Partitions, func(i, j int) bool {
+		a, b := r.Partitions[i], r.Partitions[j]
+		return a.Topic < b.Topic || a.Topic == b.Topic && a.Partition < b.Partition
+	})
+	return r
+}
+
+func (r *replicaReport) String() string {
+	var followers int
+	for _, p := range r.Partitions {
+		if p.Follower {
+			followers++
+		}
+	}
+	total := r.LeaderBytes + r.FollowerBytes
+	var followerPct, inRackPct float64
+	if total > 0 {
+		followerPct = 100 * float64(r.FollowerBytes) / float64(total)
+		inRackPct = 100 * float64(r.InRackBytes) / float64(total)
+	}
+	return fmt.Sprintf("replicas %d of %d partitions read from followers, %0.1f%% of bytes from followers, %0.1f%% from rack %s",
+		followers, len(r.Partitions), followerPct, inRackPct, r.Rack)
+}
+
+func (r *replicaReport) metrics() []metric {
+	ms := []metric{
+		{name: "fetch_bytes", labels: []string{"replica", "leader"}, value: float64(r.LeaderBytes), counter: true},
+		{name: "fetch_bytes", labels: []string{"replica", "follower"}, value: float64(r.FollowerBytes), counter: true},
+		{name: "fetch_in_rack_bytes", value: float64(r.InRackBytes), counter: true},
+	}
+	for _, p := range r.Partitions {
+		replica := "leader"
+		if p.Follower {
+			replica = "follower"
+		}
+		ms = append(ms, metric{
+			name:    "fetch_partition_bytes",
+			labels:  []string{"topic", p.Topic, "partition", strconv.Itoa(int(p.Partition)), "broker", brokerName(p.Broker), "replica", replica},
+			value:   float64(p.Bytes),
+			counter: true,
+		})
+	}
+	return ms
+}
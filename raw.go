@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kbin"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// rawMangles are the ways -raw-mangle can break the batches rawProduce builds,
+// to see how brokers handle (and report) protocol edge cases.
+var rawMangles = map[string]string{
+	"crc":          "flip a bit of the batch CRC",
+	"length":       "claim one byte more than the batch length",
+	"count":        "claim one record more than the batch holds",
+	"offset-delta": "give every record offset delta 0",
+	"magic":        "use magic 1 with the v2 batch layout",
+	"timestamp":    "use an invalid (-2) timestamp",
+	"empty":        "send a batch with no records",
+}
+
+var (
+	mangle = make(map[string]bool)
+
+	rawRequests int64
+	rawLat      histogram
+
+	rawErrsMu sync.Mutex
+	rawErrs   = make(map[string]int64) // error name => count
+)
+
+func parseRawMangles(spec string) {
+	if spec == "" {
+		return
+	}
+	for _, m := range strings.Split(spec, ",") {
+		if _, ok := rawMangles[m]; !ok {
+			var names []string
+			for name, desc := range rawMangles {
+				names = append(names, fmt.Sprintf("%s (%s)", name, desc))
+			}
+			sort.Strings(names)
+			die("unknown raw mangle %q, expected one of: %s", m, strings.Join(names, ", "))
+		}
+		mangle[m] = true
+	}
+}
+
+// rawProduce produces by building every record batch and Produce request
+// itself and sending it straight to the partition leader, bypassing kgo's
+// producer entirely. Requests are issued one at a time, round robin across
+// partitions. Rejections are counted rather than fatal, since provoking them
+// is usually the point.
+func rawProduce(client *kgo.Client, rng *rand.Rand, stop <-chan struct{}) {
+	var (
+		ctx     = stopContext(stop)
+		leaders = rawLeaders(ctx, client)
+		num     int64
+		p       pacer
+	)
+	for next := 0; waitUnpaused(stop) && !stopped(stop); next++ {
+		for i := 0; i < *rawBatchRecords; i++ {
+			p.wait()
+		}
+
+		partition := int32(next % len(leaders))
+		batch, recs, bytes := rawBatch(&num, rng)
+
+		req := kmsg.NewPtrProduceRequest()
+		req.Acks = -1
+		req.TimeoutMillis = 30000
+		if *produceTimeout != 0 {
+			req.TimeoutMillis = int32(produceTimeout.Milliseconds())
+		}
+		rt := kmsg.NewProduceRequestTopic()
+		rt.Topic = *topic
+		rp := kmsg.NewProduceRequestTopicPartition()
+		rp.Partition = partition
+		rp.Records = batch
+		rt.Partitions = append(rt.Partitions, rp)
+		req.Topics = append(req.Topics, rt)
+
+		start := time.Now()
+		kresp, err := client.Broker(int(leaders[partition])).Request(ctx, req)
+		if ctx.Err() != nil {
+			return
+		}
+		lat := time.Since(start)
+		rawLat.observe(lat)
+		if samples != nil {
+			samples.request(start, lat, leaders[partition], partition, bytes)
+		}
+		atomic.AddInt64(&rawRequests, 1)
+		if err != nil {
+			// Brokers often just close the connection on batches
+			// they cannot parse.
+			countRawErr("TRANSPORT_ERROR")
+			continue
+		}
+
+		resp := kresp.(*kmsg.ProduceResponse)
+		if len(resp.Topics) != 1 || len(resp.Topics[0].Partitions) != 1 {
+			countRawErr("MALFORMED_RESPONSE")
+			continue
+		}
+		if err := kerr.ErrorForCode(resp.Topics[0].Partitions[0].ErrorCode); err != nil {
+			var ke *kerr.Error
+			errors.As(err, &ke)
+			countRawErr(ke.Message)
+			if errors.Is(err, kerr.NotLeaderForPartition) {
+				leaders = rawLeaders(ctx, client)
+			}
+			continue
+		}
+		atomic.AddInt64(&rateRecs, recs)
+		atomic.AddInt64(&rateBytes, bytes)
+	}
+}
+
+func countRawErr(name string) {
+	rawErrsMu.Lock()
+	defer rawErrsMu.Unlock()
+	rawErrs[name]++
+}
+
+// rawLeaders returns the leader of every partition of -topic, indexed by
+// partition, waiting out any partitions that are mid election.
+func rawLeaders(ctx context.Context, client *kgo.Client) []int32 {
+	for {
+		req := kmsg.NewPtrMetadataRequest()
+		rt := kmsg.NewMetadataRequestTopic()
+		rt.Topic = kmsg.StringPtr(*topic)
+		req.Topics = append(req.Topics, rt)
+
+		resp, err := req.RequestWith(ctx, client)
+		chk(err, "unable to request metadata: %v", err)
+		if len(resp.Topics) != 1 {
+			die("metadata response has %d topics, expected 1", len(resp.Topics))
+		}
+		t := resp.Topics[0]
+		err = kerr.ErrorForCode(t.ErrorCode)
+		chk(err, "unable to load metadata for %s: %v", *topic, err)
+
+		leaders := make([]int32, len(t.Partitions))
+		ready := true
+		for _, p := range t.Partitions {
+			if int(p.Partition) >= len(leaders) {
+				die("metadata for %s has partition %d of %d", *topic, p.Partition, len(leaders))
+			}
+			leaders[p.Partition] = p.Leader
+			ready = ready && p.Leader >= 0
+		}
+		if ready && len(leaders) > 0 {
+			return leaders
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// rawBatch builds a v2 record batch of -raw-batch-records records, numbered
+// from num, with -raw-mangle applied. It returns the encoded batch and the
+// record count and value bytes it carries.
+func rawBatch(num *int64, rng *rand.Rand) (batch []byte, recs, bytes int64) {
+	var records []byte
+	n := int32(*rawBatchRecords)
+	if mangle["empty"] {
+		n = 0
+	}
+	for i := int32(0); i < n; i++ {
+		value, key := newValue(*num, rng)
+		*num++
+
+		r := kmsg.Record{OffsetDelta: i, Key: key, Value: value}
+		if mangle["offset-delta"] {
+			r.OffsetDelta = 0
+		}
+		// Record lengths are varints of the rest of the record. A zero
+		// length encodes as one byte, so encode with zero and replace it.
+		body := r.AppendTo(nil)[1:]
+		records = kbin.AppendVarint(records, int32(len(body)))
+		records = append(records, body...)
+		bytes += int64(len(value))
+	}
+	return encodeRawBatch(records, n), int64(n), bytes
+}
+
+// encodeRawBatch frames n encoded records as a v2 record batch, with
+// -raw-mangle applied.
+func encodeRawBatch(records []byte, n int32) []byte {
+	now := time.Now().UnixNano() / 1e6
+	b := kmsg.RecordBatch{
+		PartitionLeaderEpoch: -1,
+		Magic:                2,
+		LastOffsetDelta:      n - 1,
+		FirstTimestamp:       now,
+		MaxTimestamp:         now,
+		ProducerID:           -1,
+		ProducerEpoch:        -1,
+		FirstSequence:        -1,
+		NumRecords:           n,
+		Records:              records,
+	}
+	if mangle["magic"] {
+		b.Magic = 1
+	}
+	if mangle["count"] {
+		b.NumRecords++
+	}
+	if mangle["timestamp"] {
+		b.FirstTimestamp, b.MaxTimestamp = -2, -2
+	}
+
+	// The length covers everything after itself (offset 12); the CRC
+	// covers everything after itself (offset 21).
+	batch := b.AppendTo(nil)
+	length := uint32(len(batch) - 12)
+	if mangle["length"] {
+		length++
+	}
+	binary.BigEndian.PutUint32(batch[8:], length)
+	crc := crc32.Checksum(batch[21:], crc32c)
+	if mangle["crc"] {
+		crc ^= 1
+	}
+	binary.BigEndian.PutUint32(batch[17:], crc)
+	return batch
+}
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// rawReport is the raw Produce requests issued over one interval in
+// -raw-produce mode, and how brokers rejected them.
+type rawReport struct {
+	Requests int64            `json:"requests"`
+	Errors   map[string]int64 `json:"errors,omitempty"`
+	Latency  *latencySummary  `json:"latency"`
+}
+
+func swapRawReport() *rawReport {
+	rawErrsMu.Lock()
+	errs := rawErrs
+	rawErrs = make(map[string]int64)
+	rawErrsMu.Unlock()
+	return &rawReport{
+		Requests: atomic.SwapInt64(&rawRequests, 0),
+		Errors:   errs,
+		Latency:  rawLat.interval().summary(),
+	}
+}
+
+func (r *rawReport) String() string {
+	line := fmt.Sprintf("%d raw requests, request %s", r.Requests, r.Latency)
+	names := make([]string, 0, len(r.Errors))
+	for name := range r.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		line += fmt.Sprintf(", %d %s", r.Errors[name], name)
+	}
+	return line
+}
+
+func (r *rawReport) metrics() []metric {
+	ms := []metric{{name: "raw_requests", value: float64(r.Requests), counter: true}}
+	for name, n := range r.Errors {
+		ms = append(ms, metric{name: "raw_errors", labels: []string{"error", name}, value: float64(n), counter: true})
+	}
+	return append(ms, r.Latency.metrics("raw_request_latency")...)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// Reads split by -historical-lag into historical reads, of partitions far
+// behind their high watermark (which tiered storage serves from remote
+// storage), and tail reads of recent data.
+var (
+	historical, tail readStats
+)
+
+type readStats struct {
+	recs  int64
+	bytes int64
+	lat   histogram // fetch request latency
+}
+
+// readTracker classifies one consumer's reads. Records are classified
+// exactly, by how far behind their partition's high watermark each fetch
+// was. A fetch request covers many partitions, so its latency counts as
+// historical while any partition the consumer last fetched was historical,
+// and as tail otherwise. Tail fetches include waiting out -fetch-max-wait
+// for new data.
+type readTracker struct {
+	mu         sync.Mutex
+	behind     map[topicPartition]bool
+	historical int64 // partitions in behind that are true
+}
+
+func newReadTracker() *readTracker {
+	return &readTracker{behind: make(map[topicPartition]bool)}
+}
+
+func (t *readTracker) OnBrokerE2E(_ kgo.BrokerMetadata, key int16, e2e kgo.BrokerE2E) {
+	if key != kmsg.Fetch.Int16() || e2e.Err() != nil {
+		return
+	}
+	if atomic.LoadInt64(&t.historical) > 0 {
+		historical.lat.observe(e2e.DurationE2E())
+	} else {
+		tail.lat.observe(e2e.DurationE2E())
+	}
+}
+
+func (t *readTracker) fetched(fetches kgo.Fetches) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fetches.EachPartition(func(p kgo.FetchTopicPartition) {
+		if len(p.Records) == 0 {
+			return
+		}
+		last := p.Records[len(p.Records)-1]
+		behind := p.HighWatermark-(last.Offset+1) > *historicalLag
+
+		var bytes int64
+		for _, r := range p.Records {
+			bytes += int64(len(r.Value))
+		}
+		s := &tail
+		if behind {
+			s = &historical
+		}
+		atomic.AddInt64(&s.recs, int64(len(p.Records)))
+		atomic.AddInt64(&s.bytes, bytes)
+
+		tp := topicPartition{p.Topic, p.Partition}
+		if was := t.behind[tp]; was != behind {
+			t.behind[tp] = behind
+			if behind {
+				atomic.AddInt64(&t.historical, 1)
+			} else {
+				atomic.AddInt64(&t.historical, -1)
+			}
+		}
+	})
+}
+
+// gaveUp forgets partitions revoked or lost, so that a partition the
+// consumer no longer fetches cannot keep its fetches counting as
+// historical.
+func (t *readTracker) gaveUp(m map[string][]int32) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for topic, ps := range m {
+		for _, p := range ps {
+			tp := topicPartition{topic, p}
+			if t.behind[tp] {
+				atomic.AddInt64(&t.historical, -1)
+			}
+			delete(t.behind, tp)
+		}
+	}
+}
+
+// readReport is one kind of read over one interval.
+type readReport struct {
+	Records int64           `json:"records"`
+	Bytes   int64           `json:"bytes"`
+	Latency *latencySummary `json:"fetch_latency"`
+}
+
+// readPathReport is historical and tail reads over one interval.
+type readPathReport struct {
+	Interval   time.Duration `json:"interval_ns"`
+	Historical *readReport   `json:"historical"`
+	Tail       *readReport   `json:"tail"`
+}
+
+func (s *readStats) swap() *readReport {
+	return &readReport{
+		Records: atomic.SwapInt64(&s.recs, 0),
+		Bytes:   atomic.SwapInt64(&s.bytes, 0),
+		Latency: s.lat.interval().summary(),
+	}
+}
+
+func swapReadPathReport(interval time.Duration) *readPathReport {
+	return &readPathReport{
+		Interval:   interval,
+		Historical: historical.swap(),
+		Tail:       tail.swap(),
+	}
+}
+
+func (r *readPathReport) String() string {
+	secs := r.Interval.Seconds()
+	return fmt.Sprintf("historical %0.2f MiB/s, fetch %s; tail %0.2f MiB/s, fetch %s",
+		float64(r.Historical.Bytes)/secs/(1024*1024), r.Historical.Latency,
+		float64(r.Tail.Bytes)/secs/(1024*1024), r.Tail.Latency)
+}
+
+func (r *readPathReport) metrics() []metric {
+	var ms []metric
+	for _, k := range []struct {
+		path string
+		r    *readReport
+	}{{"historical", r.Historical}, {"tail", r.Tail}} {
+		labels := []string{"path", k.path}
+		ms = append(ms,
+			metric{name: "read_records", labels: labels, value: float64(k.r.Records), counter: true},
+			metric{name: "read_bytes", labels: labels, value: float64(k.r.Bytes), counter: true},
+		)
+		ms = append(ms, k.r.Latency.metrics("fetch_latency", labels...)...)
+	}
+	return ms
+}
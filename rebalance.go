@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// groupBalancer is one -balancers entry: the balancer, and the group its
+// clients join. With several balancers, each gets its own group (-group with
+// the balancer name appended) and clients take turns joining each, so eager
+// and cooperative rebalancing can be compared under the same workload.
+type groupBalancer struct {
+	name     string
+	group    string
+	balancer kgo.GroupBalancer
+	stats    rebalanceStats
+}
+
+func parseBalancers(spec, group string) []*groupBalancer {
+	var bs []*groupBalancer
+	names := strings.Split(spec, ",")
+	for _, name := range names {
+		b := &groupBalancer{name: name, group: group, stats: rebalanceStats{revoked: make(map[int32]time.Time)}}
+		if len(names) > 1 {
+			b.group = group + "-" + name
+		}
+		switch name {
+		case "range":
+			b.balancer = kgo.RangeBalancer()
+		case "roundrobin":
+			b.balancer = kgo.RoundRobinBalancer()
+		case "sticky":
+			b.balancer = kgo.StickyBalancer()
+		case "cooperative-sticky":
+			b.balancer = kgo.CooperativeStickyBalancer()
+		default:
+			die("unrecognized balancer %s", name)
+		}
+		bs = append(bs, b)
+	}
+	return bs
+}
+
+// rebalanceStats measures how long partitions pause across rebalances in
+// one group: from when any member gives a partition up (revoked or lost) to
+// when any member is assigned it again. Every member runs in this process, so
+// this is the real gap in consumption. Eager balancers pause every partition
+// for the whole rebalance; cooperative ones pause only the partitions that
+// move.
+type rebalanceStats struct {
+	mu      sync.Mutex
+	revoked map[int32]time.Time
+
+	moved  int64
+	paused int64 // total partition pause time, ns
+	lat    histogram
+}
+
+func (s *rebalanceStats) giveUp(m map[string][]int32) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range m[*topic] {
+		s.revoked[p] = now
+	}
+}
+
+func (s *rebalanceStats) assigned(m map[string][]int32) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range m[*topic] {
+		at, ok := s.revoked[p]
+		if !ok {
+			continue
+		}
+		delete(s.revoked, p)
+		pause := now.Sub(at)
+		atomic.AddInt64(&s.moved, 1)
+		atomic.AddInt64(&s.paused, int64(pause))
+		s.lat.observe(pause)
+	}
+}
+
+// opts returns the options for one client joining b's group, also calling
+// giveUp with partitions the client gives up.
+func (b *groupBalancer) opts(giveUp ...func(map[string][]int32)) []kgo.Opt {
+	return append(givingUpOpts(append([]func(map[string][]int32){b.stats.giveUp}, giveUp...)...),
+		kgo.ConsumerGroup(b.group),
+		kgo.Balancers(b.balancer),
+		kgo.OnPartitionsAssigned(func(_ context.Context, _ *kgo.Client, m map[string][]int32) {
+			b.stats.assigned(m)
+		}),
+	)
+}
+
+// givingUpOpts calls every giveUp with partitions revoked or lost. kgo
+// takes one callback of each, so everything tracking partitions shares
+// these.
+func givingUpOpts(giveUp ...func(map[string][]int32)) []kgo.Opt {
+	return []kgo.Opt{
+		kgo.OnPartitionsRevoked(func(ctx context.Context, cl *kgo.Client, m map[string][]int32) {
+			for _, fn := range giveUp {
+				fn(m)
+			}
+			// Setting our own callback replaces kgo's default, which
+			// commits before giving partitions up when autocommitting.
+			if *commitMode == "auto" {
+				cl.CommitUncommittedOffsets(ctx)
+			}
+		}),
+		kgo.OnPartitionsLost(func(_ context.Context, _ *kgo.Client, m map[string][]int32) {
+			for _, fn := range giveUp {
+				fn(m)
+			}
+		}),
+	}
+}
+
+// churnClients restarts the highest indexed clients every interval, per at
+// a time, down for down, so that their groups rebalance twice (leave, then
+// rejoin). around, if non-nil, is called with the lowest index about to go
+// down, and the func it returns, if any, once they are back.
+func churnClients(every, down time.Duration, per int, around func(first int) func()) {
+	for range time.Tick(every) {
+		n := int(atomic.LoadInt64(&live.clients))
+		if n <= per {
+			continue
+		}
+		var back func()
+		if around != nil {
+			back = around(n - per)
+		}
+		setClients(n - per)
+		time.Sleep(down)
+		// Unless something else changed the clients meanwhile, such as
+		// stopping the run.
+		if atomic.LoadInt64(&live.clients) == int64(n-per) {
+			setClients(n)
+			if back != nil {
+				back()
+			}
+		}
+	}
+}
+
+// rebalanceReport is one balancer's partition pauses over one interval.
+type rebalanceReport struct {
+	Balancer string          `json:"balancer"`
+	Group    string          `json:"group"`
+	Moved    int64           `json:"partitions_moved"`
+	Paused   time.Duration   `json:"paused_ns"`
+	Latency  *latencySummary `json:"pause"`
+}
+
+type rebalanceReports []*rebalanceReport
+
+func swapRebalanceReports(bs []*groupBalancer) rebalanceReports {
+	var rs rebalanceReports
+	for _, b := range bs {
+		rs = append(rs, &rebalanceReport{
+			Balancer: b.name,
+			Group:    b.group,
+			Moved:    atomic.SwapInt64(&b.stats.moved, 0),
+			Paused:   time.Duration(atomic.SwapInt64(&b.stats.paused, 0)),
+			Latency:  b.stats.lat.interval().summary(),
+		})
+	}
+	return rs
+}
+
+func (r *rebalanceReport) String() string {
+	if r.Moved == 0 {
+		return fmt.Sprintf("%s no pauses", r.Balancer)
+	}
+	return fmt.Sprintf("%s %d partitions paused for %v total, pause %s", r.Balancer, r.Moved, r.Paused.Round(time.Millisecond), r.Latency)
+}
+
+func (r *rebalanceReport) metrics() []metric {
+	labels := []string{"balancer", r.Balancer}
+	return append([]metric{
+		{name: "rebalance_partitions_moved", labels: labels, value: float64(r.Moved), counter: true},
+		{name: "rebalance_paused_seconds", labels: labels, value: r.Paused.Seconds(), counter: true},
+	}, r.Latency.metrics("rebalance_pause", labels...)...)
+}
+
+func (rs rebalanceReports) String() string {
+	parts := make([]string, 0, len(rs))
+	for _, r := range rs {
+		parts = append(parts, r.String())
+	}
+	return "rebalance " + strings.Join(parts, ", ")
+}
+
+func (rs rebalanceReports) metrics() []metric {
+	var ms []metric
+	for _, r := range rs {
+		ms = append(ms, r.metrics()...)
+	}
+	return ms
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// Records are replayed from (-replay), and captured to (-capture), one of two
+// formats. Both carry the same fields: key, value, headers, timestamp, and
+// the partition and offset the record was consumed from (informational when
+// replaying).
+//
+// JSON is one object per line, with keys, values, and header values as
+// strings; a missing key is a null key:
+//
+//	{"key":"k","value":"v","headers":[{"key":"h","value":"x"}],"timestamp":"2024-01-02T15:04:05.999Z","partition":3,"offset":42}
+//
+// The capture format preserves arbitrary bytes. After the 8 byte magic
+// "BKCCAP1\n", records follow back to back, all integers big endian:
+//
+//	int64  timestamp, unix milliseconds
+//	int32  partition
+//	int64  offset
+//	int32  key length (-1 for a null key), then the key
+//	int32  value length (-1 for a null value), then the value
+//	int32  header count, then per header:
+//	       int32 key length, key, int32 value length, value
+//
+// Readers tell the formats apart by the magic.
+const captureMagic = "BKCCAP1\n"
+
+// maxCaptureBytes is the longest key, value, or header a capture file may
+// hold, well over any record a broker accepts, so that a corrupt length is
+// an error rather than an enormous allocation.
+const maxCaptureBytes = 256 << 20
+
+type jsonRecord struct {
+	Key       *string      `json:"key,omitempty"`
+	Value     string       `json:"value"`
+	Headers   []jsonHeader `json:"headers,omitempty"`
+	Timestamp time.Time    `json:"timestamp"`
+	Partition int32        `json:"partition"`
+	Offset    int64        `json:"offset"`
+}
+
+type jsonHeader struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// recordReader reads records in either format. next returns io.EOF at a
+// clean end of input.
+type recordReader interface {
+	next() (*kgo.Record, error)
+}
+
+func newRecordReader(r io.Reader) (recordReader, error) {
+	br := bufio.NewReaderSize(r, 1<<20)
+	magic, err := br.Peek(len(captureMagic))
+	if err == nil && string(magic) == captureMagic {
+		br.Discard(len(captureMagic))
+		return &captureReader{r: br}, nil
+	}
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return &jsonReader{r: br}, nil
+}
+
+type jsonReader struct {
+	r    *bufio.Reader
+	line int
+}
+
+func (j *jsonReader) next() (*kgo.Record, error) {
+	for {
+		line, err := j.r.ReadBytes('\n')
+		if len(line) == 0 && err != nil {
+			return nil, err
+		}
+		j.line++
+		if line = bytes.TrimSpace(line); len(line) == 0 {
+			continue
+		}
+		var jr jsonRecord
+		if err := json.Unmarshal(line, &jr); err != nil {
+			return nil, fmt.Errorf("line %d: %v", j.line, err)
+		}
+		r := &kgo.Record{
+			Value:     []byte(jr.Value),
+			Timestamp: jr.Timestamp,
+			Partition: jr.Partition,
+			Offset:    jr.Offset,
+		}
+		if jr.Key != nil {
+			r.Key = []byte(*jr.Key)
+		}
+		for _, h := range jr.Headers {
+			r.Headers = append(r.Headers, kgo.RecordHeader{Key: h.Key, Value: []byte(h.Value)})
+		}
+		return r, nil
+	}
+}
+
+type captureReader struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (c *captureReader) int32() int32 {
+	var b [4]byte
+	if c.err == nil {
+		_, c.err = io.ReadFull(c.r, b[:])
+	}
+	return int32(binary.BigEndian.Uint32(b[:]))
+}
+
+func (c *captureReader) int64() int64 {
+	var b [8]byte
+	if c.err == nil {
+		_, c.err = io.ReadFull(c.r, b[:])
+	}
+	return int64(binary.BigEndian.Uint64(b[:]))
+}
+
+func (c *captureReader) bytes() []byte {
+	n := c.int32()
+	if c.err != nil || n < 0 {
+		return nil
+	}
+	if n > maxCaptureBytes {
+		c.err = fmt.Errorf("field of %d bytes is over the %d byte limit, the capture is likely corrupt", n, maxCaptureBytes)
+		return nil
+	}
+	b := make([]byte, n)
+	_, c.err = io.ReadFull(c.r, b)
+	return b
+}
+
+func (c *captureReader) next() (*kgo.Record, error) {
+	if _, err := c.r.Peek(1); err != nil {
+		return nil, err
+	}
+	r := &kgo.Record{
+		Timestamp: time.UnixMilli(c.int64()),
+		Partition: c.int32(),
+		Offset:    c.int64(),
+		Key:       c.bytes(),
+		Value:     c.bytes(),
+	}
+	for n := c.int32(); c.err == nil && n > 0; n-- {
+		key := c.bytes()
+		r.Headers = append(r.Headers, kgo.RecordHeader{Key: string(key), Value: c.bytes()})
+	}
+	if c.err == io.EOF {
+		c.err = io.ErrUnexpectedEOF
+	}
+	return r, c.err
+}
+
+// recordWriter writes consumed records in either format, shared by every
+// consuming client.
+type recordWriter struct {
+	mu   sync.Mutex
+	f    *os.File
+	w    *bufio.Writer
+	json bool
+	buf  []byte
+}
+
+func newRecordWriter(path, format string) *recordWriter {
+	var asJSON bool
+	switch format {
+	case "capture":
+	case "json":
+		asJSON = true
+	default:
+		die("unrecognized capture format %s", format)
+	}
+	f, err := os.Create(path)
+	chk(err, "unable to create capture file %s: %v", path, err)
+	w := &recordWriter{f: f, w: bufio.NewWriterSize(f, 1<<20), json: asJSON}
+	if !asJSON {
+		w.w.WriteString(captureMagic)
+	}
+	return w
+}
+
+func (w *recordWriter) write(r *kgo.Record) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var err error
+	if w.json {
+		jr := jsonRecord{
+			Value:     string(r.Value),
+			Timestamp: r.Timestamp,
+			Partition: r.Partition,
+			Offset:    r.Offset,
+		}
+		if r.Key != nil {
+			key := string(r.Key)
+			jr.Key = &key
+		}
+		for _, h := range r.Headers {
+			jr.Headers = append(jr.Headers, jsonHeader{Key: h.Key, Value: string(h.Value)})
+		}
+		w.buf, err = json.Marshal(jr)
+		chk(err, "unable to encode captured record: %v", err)
+		w.buf = append(w.buf, '\n')
+	} else {
+		b := w.buf[:0]
+		b = binary.BigEndian.AppendUint64(b, uint64(r.Timestamp.UnixMilli()))
+		b = binary.BigEndian.AppendUint32(b, uint32(r.Partition))
+		b = binary.BigEndian.AppendUint64(b, uint64(r.Offset))
+		b = appendCaptureBytes(b, r.Key)
+		b = appendCaptureBytes(b, r.Value)
+		b = binary.BigEndian.AppendUint32(b, uint32(len(r.Headers)))
+		for _, h := range r.Headers {
+			b = appendCaptureBytes(b, []byte(h.Key))
+			b = appendCaptureBytes(b, h.Value)
+		}
+		w.buf = b
+	}
+	_, err = w.w.Write(w.buf)
+	chk(err, "unable to write capture file %s: %v", w.f.Name(), err)
+}
+
+func appendCaptureBytes(b, v []byte) []byte {
+	if v == nil {
+		return binary.BigEndian.AppendUint32(b, uint32(0xffffffff)) // -1
+	}
+	b = binary.BigEndian.AppendUint32(b, uint32(len(v)))
+	return append(b, v...)
+}
+
+// flush writes out everything buffered so far, for when a client stops.
+func (w *recordWriter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	err := w.w.Flush()
+	chk(err, "unable to write capture file %s: %v", w.f.Name(), err)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// roundTrip writes recs in format and reads them back.
+func roundTrip(t *testing.T, format string, recs []*kgo.Record) []*kgo.Record {
+	path := filepath.Join(t.TempDir(), "records")
+	w := newRecordWriter(path, format)
+	for _, r := range recs {
+		w.write(r)
+	}
+	w.flush()
+	w.f.Close()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rr, err := newRecordReader(f)
+	if err != nil {
+		t.Fatalf("%s: unable to open: %v", format, err)
+	}
+	var read []*kgo.Record
+	for {
+		r, err := rr.next()
+		if err == io.EOF {
+			return read
+		}
+		if err != nil {
+			t.Fatalf("%s: record %d: %v", format, len(read), err)
+		}
+		read = append(read, r)
+	}
+}
+
+func TestRecordsRoundTrip(t *testing.T) {
+	for _, test := range []struct {
+		format string
+		recs   []*kgo.Record
+	}{
+		{"capture", []*kgo.Record{
+			{Value: []byte("v"), Timestamp: time.UnixMilli(1700000000123), Partition: 3, Offset: 42},
+			{Key: []byte{}, Value: []byte{0, 0xff, '\n'}, Timestamp: time.UnixMilli(0), Offset: -1},
+			{Key: []byte("k"), Timestamp: time.UnixMilli(5), Headers: []kgo.RecordHeader{
+				{Key: "h", Value: []byte("x")},
+				{Key: "", Value: nil},
+			}},
+		}},
+		// JSON strings cannot hold arbitrary bytes, nor tell a null
+		// value from an empty one, so only text round trips.
+		{"json", []*kgo.Record{
+			{Value: []byte("v"), Timestamp: time.UnixMilli(1700000000123), Partition: 3, Offset: 42},
+			{Key: []byte{}, Value: []byte("line\nbreak"), Timestamp: time.UnixMilli(0), Offset: -1},
+			{Key: []byte("k"), Value: []byte{}, Timestamp: time.UnixMilli(5), Headers: []kgo.RecordHeader{
+				{Key: "h", Value: []byte("x")},
+			}},
+		}},
+	} {
+		read := roundTrip(t, test.format, test.recs)
+		if len(read) != len(test.recs) {
+			t.Errorf("%s: read %d records, expected %d", test.format, len(read), len(test.recs))
+			continue
+		}
+		for i, exp := range test.recs {
+			got := read[i]
+			if !got.Timestamp.Equal(exp.Timestamp) || !reflect.DeepEqual(
+				[]any{got.Key, got.Value, got.Headers, got.Partition, got.Offset},
+				[]any{exp.Key, exp.Value, exp.Headers, exp.Partition, exp.Offset},
+			) {
+				t.Errorf("%s: record %d: got %+v, expected %+v", test.format, i, got, exp)
+			}
+		}
+	}
+}
+
+func TestCaptureReaderErrors(t *testing.T) {
+	var good bytes.Buffer
+	good.WriteString(captureMagic)
+	good.Write(binary.BigEndian.AppendUint64(nil, 1))  // timestamp
+	good.Write(binary.BigEndian.AppendUint32(nil, 0))  // partition
+	good.Write(binary.BigEndian.AppendUint64(nil, 0))  // offset
+	good.Write(appendCaptureBytes(nil, nil))           // key
+	good.Write(appendCaptureBytes(nil, []byte("val"))) // value
+	good.Write(binary.BigEndian.AppendUint32(nil, 0))  // headers
+
+	oversize := append([]byte(nil), good.Bytes()...)
+	valueAt := len(captureMagic) + 8 + 4 + 8 + 4
+	binary.BigEndian.PutUint32(oversize[valueAt:], maxCaptureBytes+1)
+
+	for _, test := range []struct {
+		name string
+		in   []byte
+		err  string
+	}{
+		{"truncated", good.Bytes()[:good.Len()-2], io.ErrUnexpectedEOF.Error()},
+		{"oversize", oversize, "over the"},
+	} {
+		rr, err := newRecordReader(bytes.NewReader(test.in))
+		if err != nil {
+			t.Fatalf("%s: unable to open: %v", test.name, err)
+		}
+		if _, err := rr.next(); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got %v, expected an error containing %q", test.name, err, test.err)
+		}
+	}
+}
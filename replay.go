@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// replayFiles returns path itself, or the files within the directory path in
+// name order.
+func replayFiles(path string) []string {
+	info, err := os.Stat(path)
+	chk(err, "unable to stat replay path %s: %v", path, err)
+	if !info.IsDir() {
+		return []string{path}
+	}
+	entries, err := os.ReadDir(path)
+	chk(err, "unable to read replay directory %s: %v", path, err)
+	var files []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			files = append(files, filepath.Join(path, e.Name()))
+		}
+	}
+	sort.Strings(files)
+	if len(files) == 0 {
+		die("replay directory %s has no files", path)
+	}
+	return files
+}
+
+// replaySource reads every record in files, in order, into the returned
+// channel that all replaying clients share, closing it at the end. With
+// timing, records are released with the same gaps between them as their
+// original timestamps; a paused run catches up once resumed.
+func replaySource(files []string, timing bool) <-chan *kgo.Record {
+	recs := make(chan *kgo.Record, 1024)
+	go func() {
+		defer close(recs)
+		var first time.Time
+		start := time.Now()
+		for _, path := range files {
+			f, err := os.Open(path)
+			chk(err, "unable to open replay file %s: %v", path, err)
+			rr, err := newRecordReader(f)
+			chk(err, "unable to read replay file %s: %v", path, err)
+			for {
+				r, err := rr.next()
+				if err == io.EOF {
+					break
+				}
+				chk(err, "unable to read replay file %s: %v", path, err)
+
+				if timing {
+					if first.IsZero() {
+						first = r.Timestamp
+					}
+					if wait := time.Until(start.Add(r.Timestamp.Sub(first))); wait > 0 {
+						time.Sleep(wait)
+					}
+				}
+				recs <- &kgo.Record{Key: r.Key, Value: r.Value, Headers: r.Headers}
+			}
+			f.Close()
+		}
+	}()
+	return recs
+}
+
+// replayProduce produces records from the shared replay source until it is
+// exhausted or the client is stopped.
+func replayProduce(client *kgo.Client, recs <-chan *kgo.Record, stop <-chan struct{}) {
+	var p pacer
+	defer client.Flush(context.Background())
+	for waitUnpaused(stop) {
+		select {
+		case r, ok := <-recs:
+			if !ok {
+				return
+			}
+			p.wait()
+			produceRecord(client, r)
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+const (
+	resetEarliest = -2
+	resetLatest   = -1
+)
+
+// parseResetOffsets checks -reset-offsets, returning resetEarliest,
+// resetLatest, or the unix millis to reset to.
+func parseResetOffsets(spec string) int64 {
+	if !*consumeMode || *group == "" || *topic == "" || *clientLib != "franz-go" {
+		die("-reset-offsets only applies to consuming -topic in a -group with franz-go")
+	}
+	switch {
+	case spec == "earliest":
+		return resetEarliest
+	case spec == "latest":
+		return resetLatest
+	case strings.HasPrefix(spec, "timestamp:"):
+		at, err := time.Parse(time.RFC3339Nano, strings.TrimPrefix(spec, "timestamp:"))
+		chk(err, "invalid -reset-offsets timestamp %q: %v", spec, err)
+		return at.UnixMilli()
+	}
+	die("unrecognized -reset-offsets %q, expected earliest, latest, or timestamp:RFC3339", spec)
+	return 0
+}
+
+// resetOffsets commits -group's offsets for every partition of -topic to
+// -reset-offsets before the run, so that repeated consumer benchmarks start
+// from the same place: earliest, latest, or the first record at or after
+// timestamp:RFC3339. The group must have no members, as Kafka only accepts
+// commits from outside an empty group.
+func resetOffsets(adminOpts []kgo.Opt, spec string, at int64) {
+	adm, err := kgo.NewClient(adminOpts...)
+	chk(err, "unable to initialize admin client: %v", err)
+	defer adm.Close()
+	cl := kadm.NewClient(adm)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var listed kadm.ListedOffsets
+	switch at {
+	case resetEarliest:
+		listed, err = cl.ListStartOffsets(ctx, *topic)
+	case resetLatest:
+		listed, err = cl.ListEndOffsets(ctx, *topic)
+	default:
+		listed, err = cl.ListOffsetsAfterMilli(ctx, at, *topic)
+	}
+	if err == nil {
+		err = listed.Error()
+	}
+	chk(err, "unable to list offsets of %s to reset to: %v", *topic, err)
+
+	offsets := listed.Offsets()
+	if len(offsets[*topic]) == 0 {
+		die("topic %s has no partitions", *topic)
+	}
+	err = cl.CommitAllOffsets(ctx, *group, offsets)
+	chk(err, "unable to reset offsets of group %s (it must have no members): %v", *group, err)
+	fmt.Fprintf(os.Stderr, "reset offsets of group %s to %s for %d partitions of %s\n", *group, spec, len(offsets[*topic]), *topic)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// retryStats counts what kgo retries while producing, for -report-retries.
+// kgo has no retry hook: failed requests come from the E2E hook, and batches
+// failed within otherwise successful responses from its logs (retryLogger).
+type retryStats struct {
+	failedReqs     int64 // produce requests that failed and were retried
+	ambiguousReqs  int64 // of those, written but not answered: they may have been appended
+	retriedBatches int64 // batches a broker failed with a retryable error
+	dupSeqs        int64 // batches a broker rejected as duplicate sequence numbers
+
+	total retryReport // everything over the run
+}
+
+var retries retryStats
+
+func (s *retryStats) OnBrokerE2E(_ kgo.BrokerMetadata, key int16, e2e kgo.BrokerE2E) {
+	if key != kmsg.Produce.Int16() || e2e.Err() == nil {
+		return
+	}
+	atomic.AddInt64(&s.failedReqs, 1)
+	if e2e.WriteErr == nil {
+		atomic.AddInt64(&s.ambiguousReqs, 1)
+	}
+}
+
+// retryLogger counts the batch failures kgo logs, passing everything at the
+// wrapped logger's level (if any) through to it.
+type retryLogger struct{ inner kgo.Logger }
+
+func (l retryLogger) Level() kgo.LogLevel {
+	if l.inner != nil && l.inner.Level() > kgo.LogLevelInfo {
+		return l.inner.Level()
+	}
+	return kgo.LogLevelInfo
+}
+
+func (l retryLogger) Log(level kgo.LogLevel, msg string, keyvals ...interface{}) {
+	switch {
+	case strings.HasPrefix(msg, "batch in a produce request failed"):
+		for i := 0; i+1 < len(keyvals); i += 2 {
+			if keyvals[i] == "err_is_retryable" && keyvals[i+1] == true {
+				atomic.AddInt64(&retries.retriedBatches, 1)
+			}
+		}
+	case strings.HasPrefix(msg, "received unexpected duplicate sequence number"):
+		atomic.AddInt64(&retries.dupSeqs, 1)
+	}
+	if l.inner != nil && level <= l.inner.Level() {
+		l.inner.Log(level, msg, keyvals...)
+	}
+}
+
+// retryReport is the produce retries over one interval, or the whole run.
+type retryReport struct {
+	FailedRequests    int64 `json:"failed_requests"`
+	AmbiguousRequests int64 `json:"ambiguous_requests"`
+	RetriedBatches    int64 `json:"retried_batches"`
+	DuplicateSeqs     int64 `json:"duplicate_sequences"`
+}
+
+func (s *retryStats) swap() *retryReport {
+	r := &retryReport{
+		FailedRequests:    atomic.SwapInt64(&s.failedReqs, 0),
+		AmbiguousRequests: atomic.SwapInt64(&s.ambiguousReqs, 0),
+		RetriedBatches:    atomic.SwapInt64(&s.retriedBatches, 0),
+		DuplicateSeqs:     atomic.SwapInt64(&s.dupSeqs, 0),
+	}
+	atomic.AddInt64(&s.total.FailedRequests, r.FailedRequests)
+	atomic.AddInt64(&s.total.AmbiguousRequests, r.AmbiguousRequests)
+	atomic.AddInt64(&s.total.RetriedBatches, r.RetriedBatches)
+	atomic.AddInt64(&s.total.DuplicateSeqs, r.DuplicateSeqs)
+	return r
+}
+
+func (s *retryStats) totals() *retryReport {
+	return &retryReport{
+		FailedRequests:    atomic.LoadInt64(&s.total.FailedRequests),
+		AmbiguousRequests: atomic.LoadInt64(&s.total.AmbiguousRequests),
+		RetriedBatches:    atomic.LoadInt64(&s.total.RetriedBatches),
+		DuplicateSeqs:     atomic.LoadInt64(&s.total.DuplicateSeqs),
+	}
+}
+
+func (r *retryReport) String() string {
+	return fmt.Sprintf("retries %d failed requests (%d ambiguous), %d retried batches, %d duplicate sequences",
+		r.FailedRequests, r.AmbiguousRequests, r.RetriedBatches, r.DuplicateSeqs)
+}
+
+func (r *retryReport) metrics() []metric {
+	return []metric{
+		{name: "produce_failed_requests", value: float64(r.FailedRequests), counter: true},
+		{name: "produce_ambiguous_requests", value: float64(r.AmbiguousRequests), counter: true},
+		{name: "produce_retried_batches", value: float64(r.RetriedBatches), counter: true},
+		{name: "produce_duplicate_sequences", value: float64(r.DuplicateSeqs), counter: true},
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// produceRouting tracks, for -report-routing, which broker every produce
+// batch was written to, and notices partition leadership moving as a
+// partition's batches start going to another broker. Each move is its own
+// report, emitted as it is seen, so that throughput dips can be lined up
+// with leader elections. Every client watches for moves in its own batches,
+// as clients learn of a new leader at different times, and two clients
+// alternating between an old and new leader are not a move each batch.
+type produceRouting struct {
+	mu      sync.Mutex
+	brokers map[int32]*routedCounts
+
+	moves   int64 // since the last report
+	changes chan *leaderChange
+}
+
+type routedCounts struct {
+	batches int64
+	records int64
+	bytes   int64
+}
+
+var routing = produceRouting{
+	brokers: make(map[int32]*routedCounts),
+	changes: make(chan *leaderChange, 1024),
+}
+
+// emitChanges emits moves as they are seen. Hooks run in kgo's produce
+// path, so they queue moves here rather than wait on sinks; a move seen
+// with the queue full is counted but not emitted.
+func (p *produceRouting) emitChanges() {
+	for e := range p.changes {
+		emit(e)
+	}
+}
+
+// client is the hook for one client's batches.
+func (p *produceRouting) client() *routedClient {
+	return &routedClient{p: p, leaders: newLeaderTracker()}
+}
+
+type routedClient struct {
+	p       *produceRouting
+	leaders *leaderTracker
+}
+
+func (c *routedClient) OnProduceBatchWritten(meta kgo.BrokerMetadata, topic string, partition int32, m kgo.ProduceBatchMetrics) {
+	p := c.p
+	p.mu.Lock()
+	counts := p.brokers[meta.NodeID]
+	if counts == nil {
+		counts = new(routedCounts)
+		p.brokers[meta.NodeID] = counts
+	}
+	p.mu.Unlock()
+
+	atomic.AddInt64(&counts.batches, 1)
+	atomic.AddInt64(&counts.records, int64(m.NumRecords))
+	atomic.AddInt64(&counts.bytes, int64(m.CompressedBytes))
+	if from, moved := c.leaders.wrote(topicPartition{topic, partition}, meta.NodeID); moved {
+		atomic.AddInt64(&p.moves, 1)
+		select {
+		case p.changes <- &leaderChange{At: time.Now(), Topic: topic, Partition: partition, From: from, To: meta.NodeID}:
+		default:
+		}
+	}
+}
+
+// leaderChange is one partition's leadership moving, as produce saw it: the
+// first batch written to the new leader.
+type leaderChange struct {
+	At        time.Time `json:"at"`
+	Topic     string    `json:"topic"`
+	Partition int32     `json:"partition"`
+	From      int32     `json:"from"`
+	To        int32     `json:"to"`
+}
+
+func (*leaderChange) kind() string { return "leader_change" }
+
+func (e *leaderChange) String() string {
+	return fmt.Sprintf("%s leader of %s/%d moved from broker %s to %s",
+		e.At.Format(time.RFC3339Nano), e.Topic, e.Partition, brokerName(e.From), brokerName(e.To))
+}
+
+// metrics is empty: moves are counted by the rate report, which sees all
+// of them.
+func (*leaderChange) metrics() []metric { return nil }
+
+// routingReport is where produce batches went over one interval.
+type routingReport struct {
+	Brokers []routedBroker `json:"brokers"`
+	Moves   int64          `json:"leader_moves"`
+}
+
+type routedBroker struct {
+	Node       int32 `json:"node"`
+	Partitions int   `json:"partitions"` // led, as of the report
+	Batches    int64 `json:"batches"`
+	Records    int64 `json:"records"`
+	Bytes      int64 `json:"bytes"`
+}
+
+func (p *produceRouting) swap() *routingReport {
+	led := produceLeaders.led()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	r := &routingReport{Moves: atomic.SwapInt64(&p.moves, 0)}
+	for node, c := range p.brokers {
+		r.Brokers = append(r.Brokers, routedBroker{
+			Node:       node,
+			Partitions: led[node],
+			Batches:    atomic.SwapInt64(&c.batches, 0),
+			Records:    atomic.SwapInt64(&c.records, 0),
+			Bytes:      atomic.SwapInt64(&c.bytes, 0),
+		})
+	}
+	sort.Slice(r.Brokers, func(i, j int) bool { return r.Brokers[i].Node < r.Brokers[j].Node })
+	return r
+}
+
+func (r *routingReport) String() string {
+	var total int64
+	for _, b := range r.Brokers {
+		total += b.Records
+	}
+	parts := make([]string, 0, len(r.Brokers))
+	for _, b := range r.Brokers {
+		var pct float64
+		if total > 0 {
+			pct = 100 * float64(b.Records) / float64(total)
+		}
+		parts = append(parts, fmt.Sprintf("broker %s %0.1f%% (%d partitions)", brokerName(b.Node), pct, b.Partitions))
+	}
+	return fmt.Sprintf("routed to %s; %d leader moves", strings.Join(parts, ", "), r.Moves)
+}
+
+func (r *routingReport) metrics() []metric {
+	ms := []metric{{name: "produce_leader_moves", value: float64(r.Moves), counter: true}}
+	for _, b := range r.Brokers {
+		labels := []string{"broker", brokerName(b.Node)}
+		ms = append(ms,
+			metric{name: "produce_routed_partitions", labels: labels, value: float64(b.Partitions)},
+			metric{name: "produce_routed_batches", labels: labels, value: float64(b.Batches), counter: true},
+			metric{name: "produce_routed_records", labels: labels, value: float64(b.Records), counter: true},
+			metric{name: "produce_routed_bytes", labels: labels, value: float64(b.Bytes), counter: true},
+		)
+	}
+	return ms
+}
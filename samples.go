@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// latencySamples streams raw latency samples to -latency-samples-file, for
+// analysis the reports cannot do: each produced record (or with -raw-produce
+// each request), when it was sent, its latency, the broker it went to, its
+// partition, and its size. -latency-samples-rate keeps an evenly spaced
+// fraction of them.
+//
+// CSV has a header line and then one sample per line:
+//
+//	sent_unix_ns,latency_ns,broker,partition,bytes
+//
+// The binary format is the 8 byte magic "BKCLAT1\n" and then 32 byte
+// samples back to back, all integers big endian:
+//
+//	int64  sent, unix nanoseconds
+//	int64  latency, nanoseconds
+//	int32  broker node id, -1 if not yet known
+//	int32  partition
+//	int32  bytes
+//	       4 bytes of padding
+//
+// kgo does not say which broker acknowledged a record, so a record's broker
+// is its partition's leader as of the latest batch written to it.
+type latencySamples struct {
+	every float64 // keep one sample in every
+	seen  int64
+
+	mu  sync.Mutex
+	f   *os.File
+	w   *bufio.Writer
+	csv bool
+	buf []byte
+}
+
+const latencySamplesMagic = "BKCLAT1\n"
+
+var samples *latencySamples
+
+func newLatencySamples(path, format string, rate float64) *latencySamples {
+	if rate <= 0 || rate > 1 {
+		die("-latency-samples-rate must be within (0, 1]")
+	}
+	var csv bool
+	switch format {
+	case "csv":
+		csv = true
+	case "binary":
+	default:
+		die("unrecognized -latency-samples-format %s, expected csv or binary", format)
+	}
+	f, err := os.Create(path)
+	chk(err, "unable to create latency samples file %s: %v", path, err)
+	s := &latencySamples{
+		every: 1 / rate,
+		f:     f,
+		w:     bufio.NewWriterSize(f, 1<<20),
+		csv:   csv,
+	}
+	if csv {
+		s.w.WriteString("sent_unix_ns,latency_ns,broker,partition,bytes\n")
+	} else {
+		s.w.WriteString(latencySamplesMagic)
+	}
+	return s
+}
+
+// keep is whether the n'th sample (from 1) is among those kept: those where
+// the count of kept samples ticks over.
+func (s *latencySamples) keep() bool {
+	n := atomic.AddInt64(&s.seen, 1)
+	return int64(float64(n)/s.every) != int64(float64(n-1)/s.every)
+}
+
+// produced samples a produced record.
+func (s *latencySamples) produced(r *kgo.Record, sent time.Time, lat time.Duration) {
+	if !s.keep() {
+		return
+	}
+	broker, ok := produceLeaders.leader(topicPartition{r.Topic, r.Partition})
+	if !ok {
+		broker = -1
+	}
+	s.write(sent, lat, broker, r.Partition, len(r.Value))
+}
+
+// request samples a -raw-produce request.
+func (s *latencySamples) request(sent time.Time, lat time.Duration, broker, partition int32, bytes int64) {
+	if s.keep() {
+		s.write(sent, lat, broker, partition, int(bytes))
+	}
+}
+
+func (s *latencySamples) write(sent time.Time, lat time.Duration, broker, partition int32, bytes int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := s.buf[:0]
+	if s.csv {
+		b = strconv.AppendInt(b, sent.UnixNano(), 10)
+		b = append(b, ',')
+		b = strconv.AppendInt(b, int64(lat), 10)
+		b = append(b, ',')
+		b = strconv.AppendInt(b, int64(broker), 10)
+		b = append(b, ',')
+		b = strconv.AppendInt(b, int64(partition), 10)
+		b = append(b, ',')
+		b = strconv.AppendInt(b, int64(bytes), 10)
+		b = append(b, '\n')
+	} else {
+		b = binary.BigEndian.AppendUint64(b, uint64(sent.UnixNano()))
+		b = binary.BigEndian.AppendUint64(b, uint64(lat))
+		b = binary.BigEndian.AppendUint32(b, uint32(broker))
+		b = binary.BigEndian.AppendUint32(b, uint32(partition))
+		b = binary.BigEndian.AppendUint32(b, uint32(bytes))
+		b = append(b, 0, 0, 0, 0)
+	}
+	s.buf = b
+	_, err := s.w.Write(b)
+	chk(err, "unable to write latency samples file %s: %v", s.f.Name(), err)
+}
+
+// close writes out the rest of the samples once the run is done.
+func (s *latencySamples) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.w.Flush()
+	if err == nil {
+		err = s.f.Close()
+	}
+	chk(err, "unable to write latency samples file %s: %v", s.f.Name(), err)
+}
@@ -0,0 +1,249 @@
+//go:build sarama
+
+package main
+
+import (
+	"log"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+func init() { clientLibs["sarama"] = saramaSetup }
+
+// saramaSetup maps the workload flags onto one sarama config that every
+// client shares, matching franz-go's behavior wherever sarama allows.
+func saramaSetup() func(int, <-chan struct{}) {
+	rejectFlags("sarama",
+		"eos-topic", "txn-id", "otlp-endpoint",
+		"fetch-max-bytes", "max-poll-records", "poll-interval",
+		"commit-mode", "commit-every", "max-produce-inflight-per-broker",
+		"conn-idle-timeout", "broker-max-write-bytes", "broker-max-read-bytes",
+		"socket-send-buffer", "socket-recv-buffer", "rack", "reset-offsets", "latency-samples-file",
+	)
+	if *topic == "" {
+		die("a topic is required with -client-lib sarama")
+	}
+	if strings.Contains(*compression, ",") {
+		die("-client-lib sarama cannot split clients between codecs")
+	}
+
+	cfg := sarama.NewConfig()
+	cfg.ClientID = "big-kafka-conn"
+	cfg.Version = sarama.V2_1_0_0 // for zstd and idempotence
+	if *logLevel != "" {
+		sarama.Logger = log.New(os.Stderr, "[sarama] ", log.LstdFlags)
+	}
+	cfg.Net.DialTimeout = *dialTimeout
+	if *useTLS {
+		cfg.Net.TLS.Enable = true
+		cfg.Net.TLS.Config = newTLSConfig()
+	}
+
+	// franz-go produces idempotently with acks=all by default. sarama only
+	// allows idempotence with one request in flight per broker, which is
+	// part of what a comparison shows.
+	cfg.Producer.RequiredAcks = sarama.WaitForAll
+	cfg.Producer.Idempotent = true
+	cfg.Net.MaxOpenRequests = 1
+	cfg.Producer.Return.Successes = true
+	cfg.Producer.MaxMessageBytes = *maxBatchSize
+	cfg.Producer.Flush.Frequency = *linger
+	codec, level, leveled := splitCompressionLevel(strings.ToLower(*compression))
+	if leveled {
+		if codec != "gzip" && codec != "zstd" {
+			die("-client-lib sarama only supports gzip and zstd compression levels")
+		}
+		cfg.Producer.CompressionLevel = level
+	}
+	switch codec {
+	case "gzip":
+		cfg.Producer.Compression = sarama.CompressionGZIP
+	case "snappy":
+		cfg.Producer.Compression = sarama.CompressionSnappy
+	case "lz4":
+		cfg.Producer.Compression = sarama.CompressionLZ4
+	case "zstd":
+		cfg.Producer.Compression = sarama.CompressionZSTD
+	}
+
+	// franz-go consumes from the start of partitions without committed
+	// offsets, unless told otherwise.
+	switch *consumeFrom {
+	case "earliest":
+		cfg.Consumer.Offsets.Initial = sarama.OffsetOldest
+	case "latest":
+		cfg.Consumer.Offsets.Initial = sarama.OffsetNewest
+	default:
+		die("-client-lib sarama only supports -consume-from earliest or latest")
+	}
+	if *commitInterval != 0 {
+		cfg.Consumer.Offsets.AutoCommit.Interval = *commitInterval
+	}
+	if *fetchMaxPartitionBytes != 0 {
+		cfg.Consumer.Fetch.Default = int32(*fetchMaxPartitionBytes)
+		cfg.Consumer.Fetch.Max = int32(*fetchMaxPartitionBytes)
+	}
+	if *fetchMinBytes != 0 {
+		cfg.Consumer.Fetch.Min = int32(*fetchMinBytes)
+	}
+	if *fetchMaxWait != 0 {
+		cfg.Consumer.MaxWaitTime = *fetchMaxWait
+	}
+	if *requestTimeout != 0 {
+		cfg.Net.ReadTimeout = *requestTimeout
+		cfg.Net.WriteTimeout = *requestTimeout
+	}
+	if *produceTimeout != 0 {
+		cfg.Producer.Timeout = *produceTimeout
+	}
+	if *retryBackoff != 0 {
+		cfg.Metadata.Retry.Backoff = *retryBackoff
+		cfg.Producer.Retry.Backoff = *retryBackoff
+		cfg.Consumer.Retry.Backoff = *retryBackoff
+	}
+	err := cfg.Validate()
+	chk(err, "invalid sarama config: %v", err)
+
+	addrs := strings.Split(*brokers, ",")
+	return func(idx int, stop <-chan struct{}) {
+		cfg := cfg
+		if id := clientID(idx); id != "" {
+			c := *cfg
+			c.ClientID = id
+			cfg = &c
+		}
+		switch {
+		case !*consumeMode:
+			saramaProduce(addrs, cfg, seededRand("client", idx), stop)
+		case *group != "":
+			saramaGroupConsume(addrs, cfg, stop)
+		default:
+			saramaConsume(addrs, cfg, stop)
+		}
+	}
+}
+
+func saramaProduce(addrs []string, cfg *sarama.Config, rng *rand.Rand, stop <-chan struct{}) {
+	producer, err := sarama.NewAsyncProducer(addrs, cfg)
+	chk(err, "unable to initialize sarama producer: %v", err)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for m := range producer.Successes() {
+			produceLat.observe(time.Since(m.Metadata.(time.Time)))
+			atomic.AddInt64(&rateRecs, 1)
+			atomic.AddInt64(&rateBytes, int64(m.Value.Length()))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for err := range producer.Errors() {
+			die("produce error: %v", err.Err)
+		}
+	}()
+
+	var (
+		num int64
+		p   pacer
+	)
+	for waitUnpaused(stop) && !stopped(stop) {
+		p.wait()
+
+		value, key := newValue(num, rng)
+		key = skewKey(key, rng)
+		// Metadata carries when the record was produced through to its
+		// success, for its latency.
+		m := &sarama.ProducerMessage{Topic: *topic, Value: sarama.ByteEncoder(value), Metadata: time.Now()}
+		if key != nil {
+			m.Key = sarama.ByteEncoder(key)
+		}
+		if timestamps != nil {
+			m.Timestamp = timestamps.at(num)
+		}
+		producer.Input() <- m
+		num++
+	}
+
+	// AsyncClose flushes anything buffered before closing Successes and
+	// Errors, so waiting on both lets every record finish.
+	producer.AsyncClose()
+	wg.Wait()
+}
+
+func saramaCount(m *sarama.ConsumerMessage) {
+	atomic.AddInt64(&rateRecs, 1)
+	atomic.AddInt64(&rateBytes, int64(len(m.Value)))
+}
+
+func saramaGroupConsume(addrs []string, cfg *sarama.Config, stop <-chan struct{}) {
+	cg, err := sarama.NewConsumerGroup(addrs, *group, cfg)
+	chk(err, "unable to initialize sarama consumer group: %v", err)
+	defer cg.Close()
+
+	ctx := stopContext(stop)
+	for ctx.Err() == nil {
+		err := cg.Consume(ctx, []string{*topic}, saramaHandler{})
+		if ctx.Err() != nil {
+			return
+		}
+		chk(err, "sarama group consume error: %v", err)
+	}
+}
+
+// saramaHandler counts and marks every record; sarama autocommits marks.
+type saramaHandler struct{}
+
+func (saramaHandler) Setup(sarama.ConsumerGroupSession) error   { return nil }
+func (saramaHandler) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+
+func (saramaHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for m := range claim.Messages() {
+		// The session ends on rebalance or stop; either must not wait
+		// out a pause.
+		if !waitUnpaused(sess.Context().Done()) {
+			return nil
+		}
+		saramaCount(m)
+		sess.MarkMessage(m, "")
+	}
+	return nil
+}
+
+// saramaConsume consumes every partition directly, as franz-go does with
+// ConsumeTopics and no group.
+func saramaConsume(addrs []string, cfg *sarama.Config, stop <-chan struct{}) {
+	consumer, err := sarama.NewConsumer(addrs, cfg)
+	chk(err, "unable to initialize sarama consumer: %v", err)
+	defer consumer.Close()
+
+	partitions, err := consumer.Partitions(*topic)
+	chk(err, "unable to load partitions of %s: %v", *topic, err)
+
+	var wg sync.WaitGroup
+	for _, partition := range partitions {
+		pc, err := consumer.ConsumePartition(*topic, partition, cfg.Consumer.Offsets.Initial)
+		chk(err, "unable to consume partition %d: %v", partition, err)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer pc.AsyncClose()
+			for waitUnpaused(stop) {
+				select {
+				case m := <-pc.Messages():
+					saramaCount(m)
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
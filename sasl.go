@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/sasl"
+	"github.com/twmb/franz-go/pkg/sasl/aws"
+	"github.com/twmb/franz-go/pkg/sasl/oauth"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+)
+
+// saslPassEnv is the environment variable -sasl-pass defaults to, which is
+// also how -scenario passes it to stages.
+const saslPassEnv = "BKC_SASL_PASS"
+
+// newSASLMechanism returns the -sasl-mechanism to authenticate with:
+//
+//	plain, scram-sha-256, scram-sha-512  -sasl-user and -sasl-pass
+//	aws-msk-iam                          AWS credentials from -sasl-token-command,
+//	                                     else -sasl-user and -sasl-pass as the access
+//	                                     and secret key, else the AWS_ACCESS_KEY_ID,
+//	                                     AWS_SECRET_ACCESS_KEY, and AWS_SESSION_TOKEN
+//	                                     environment variables
+//	oauthbearer                          the token -sasl-token-command prints
+//
+// With thousands of clients, every connection authenticates, so whatever
+// -sasl-token-command prints is reused until it expires: AWS credentials
+// carry their expiration, and anything else is reused for a minute.
+func newSASLMechanism(mechanism string) sasl.Mechanism {
+	switch strings.ToLower(mechanism) {
+	case "plain", "scram-sha-256", "scram-sha-512":
+		if *saslTokenCommand != "" {
+			die("-sasl-token-command applies to aws-msk-iam and oauthbearer")
+		}
+		if *saslUser == "" || *saslPass == "" {
+			die("-sasl-mechanism %s requires -sasl-user and -sasl-pass", mechanism)
+		}
+		switch strings.ToLower(mechanism) {
+		case "plain":
+			return plain.Auth{User: *saslUser, Pass: *saslPass}.AsMechanism()
+		case "scram-sha-256":
+			return scram.Auth{User: *saslUser, Pass: *saslPass}.AsSha256Mechanism()
+		default:
+			return scram.Auth{User: *saslUser, Pass: *saslPass}.AsSha512Mechanism()
+		}
+
+	case "aws-msk-iam":
+		if *saslTokenCommand != "" {
+			tokens := &tokenCommand{command: *saslTokenCommand}
+			return aws.ManagedStreamingIAM(func(ctx context.Context) (aws.Auth, error) {
+				out, err := tokens.get(ctx, awsExpiration)
+				if err != nil {
+					return aws.Auth{}, err
+				}
+				return parseAWSCredentials(out)
+			})
+		}
+		auth := aws.Auth{
+			AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		}
+		if *saslUser != "" || *saslPass != "" {
+			auth = aws.Auth{AccessKey: *saslUser, SecretKey: *saslPass}
+		}
+		if auth.AccessKey == "" || auth.SecretKey == "" {
+			die("-sasl-mechanism aws-msk-iam requires -sasl-token-command, -sasl-user and -sasl-pass, or AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+		}
+		return auth.AsManagedStreamingIAMMechanism()
+
+	case "oauthbearer":
+		if *saslTokenCommand == "" {
+			die("-sasl-mechanism oauthbearer requires -sasl-token-command")
+		}
+		tokens := &tokenCommand{command: *saslTokenCommand}
+		return oauth.Oauth(func(ctx context.Context) (oauth.Auth, error) {
+			out, err := tokens.get(ctx, nil)
+			if err != nil {
+				return oauth.Auth{}, err
+			}
+			return oauth.Auth{Token: string(bytes.TrimSpace(out))}, nil
+		})
+	}
+	die("unrecognized -sasl-mechanism %s, expected plain, scram-sha-256, scram-sha-512, aws-msk-iam, or oauthbearer", mechanism)
+	return nil
+}
+
+// tokenCommand runs -sasl-token-command through the shell, caching its
+// output until it expires.
+type tokenCommand struct {
+	command string
+
+	mu      sync.Mutex
+	out     []byte
+	expires time.Time
+}
+
+func (t *tokenCommand) get(ctx context.Context, expiration func([]byte) time.Time) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.out != nil && time.Now().Before(t.expires) {
+		return t.out, nil
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", t.command)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("sasl token command failed: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	t.out, t.expires = out, time.Now().Add(time.Minute)
+	if expiration != nil {
+		// Refresh a little early, so that connections opened just before
+		// expiry do not authenticate with credentials about to lapse.
+		if at := expiration(out); !at.IsZero() {
+			t.expires = at.Add(-time.Minute)
+		}
+	}
+	return out, nil
+}
+
+// awsCredentials is what AWS credential_process commands print, e.g.
+// "aws configure export-credentials --format process".
+type awsCredentials struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	SessionToken    string `json:"SessionToken"`
+	Expiration      string `json:"Expiration"`
+}
+
+func parseAWSCredentials(out []byte) (aws.Auth, error) {
+	var c awsCredentials
+	if err := json.Unmarshal(out, &c); err != nil {
+		return aws.Auth{}, fmt.Errorf("sasl token command did not print AWS credentials as JSON: %v", err)
+	}
+	if c.AccessKeyID == "" || c.SecretAccessKey == "" {
+		return aws.Auth{}, fmt.Errorf("sasl token command printed no AccessKeyId or SecretAccessKey")
+	}
+	return aws.Auth{AccessKey: c.AccessKeyID, SecretKey: c.SecretAccessKey, SessionToken: c.SessionToken}, nil
+}
+
+func awsExpiration(out []byte) time.Time {
+	var c awsCredentials
+	if json.Unmarshal(out, &c) != nil {
+		return time.Time{}
+	}
+	at, _ := time.Parse(time.RFC3339, c.Expiration)
+	return at
+}
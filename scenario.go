@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// stage is one line of a -scenario file:
+//
+//	<name> <duration> [flags...]
+//
+// for example
+//
+//	# warm up, then push harder with compression, then drain
+//	warmup 5m -rate 100000
+//	push   10m -rate 300000 -compression zstd
+//	drain  5m -consume -group drain
+//
+// Blank lines and lines starting with # are skipped. Flags are split on
+// whitespace, so values cannot contain spaces.
+type stage struct {
+	name     string
+	duration time.Duration
+	args     []string
+}
+
+func parseScenario(path string) []stage {
+	f, err := os.Open(path)
+	chk(err, "unable to open scenario %s: %v", path, err)
+	defer f.Close()
+
+	var stages []stage
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 2 {
+			die("scenario %s line %d: expected a stage name and duration", path, lineNo)
+		}
+		d, err := time.ParseDuration(fields[1])
+		if err != nil || d <= 0 {
+			die("scenario %s line %d: invalid stage duration %q", path, lineNo, fields[1])
+		}
+		stages = append(stages, stage{name: fields[0], duration: d, args: fields[2:]})
+	}
+	chk(scanner.Err(), "unable to read scenario %s: %v", path, scanner.Err())
+	if len(stages) == 0 {
+		die("scenario %s has no stages", path)
+	}
+	return stages
+}
+
+// runScenario runs each stage of a -scenario file in turn, as this binary
+// with the flags given on the command line, then the stage's flags (which
+// override them), for the stage's duration. Every stage is a fresh process
+// and so gets fresh clients: stages can change anything, from -rate to
+// -compression to consuming instead of producing. {stage} in any flag
+// value is replaced by the stage name, e.g. -sinks json:/tmp/run-{stage}.json
+// keeps each stage's stats apart.
+//
+// A stage violating an -assert flag still lets the rest run, but the
+// scenario then exits non-zero. A stage that fails outright ends it.
+// Interrupting reaches the running stage through the terminal, which stops
+// it as usual, and the scenario stops after it; SIGTERM is passed along.
+func runScenario(path string) {
+	stages := parseScenario(path)
+
+	// The password goes to stages in their environment, not on their
+	// command lines, which any user can list.
+	var base []string
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name != "scenario" && f.Name != "duration" && f.Name != "sasl-pass" {
+			base = append(base, "-"+f.Name+"="+f.Value.String())
+		}
+	})
+	env := os.Environ()
+	if *saslPass != "" {
+		env = append(env, saslPassEnv+"="+*saslPass)
+	}
+	self, err := os.Executable()
+	chk(err, "unable to find this executable to run scenario stages with: %v", err)
+
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt, syscall.SIGTERM)
+
+	var (
+		names     []string
+		summaries []*summaryReport
+		violated  bool
+	)
+	for i, s := range stages {
+		summary := summaryPath(i)
+		args := append(append(base[:len(base):len(base)], s.args...), "-duration="+s.duration.String(), "-summary-file="+summary)
+		for j := range args {
+			args[j] = strings.ReplaceAll(args[j], "{stage}", s.name)
+		}
+
+		fmt.Printf("scenario stage %d/%d %s: %s for %v\n", i+1, len(stages), s.name, strings.Join(s.args, " "), s.duration)
+		cmd := exec.Command(self, args...)
+		cmd.Stdout, cmd.Stderr, cmd.Env = os.Stdout, os.Stderr, env
+		err := cmd.Start()
+		chk(err, "unable to start scenario stage %s: %v", s.name, err)
+
+		exited := make(chan error, 1)
+		go func() { exited <- cmd.Wait() }()
+		stop := false
+	wait:
+		for {
+			select {
+			case err = <-exited:
+				break wait
+			case sig := <-interrupted:
+				stop = true
+				if sig == syscall.SIGTERM {
+					cmd.Process.Signal(sig)
+				}
+			}
+		}
+
+		r := readStageSummary(summary)
+		os.Remove(summary)
+		if r == nil {
+			die("scenario stage %s failed: %v", s.name, err)
+		}
+		names, summaries = append(names, s.name), append(summaries, r)
+		violated = violated || len(r.Violations) > 0
+		if stop {
+			fmt.Printf("scenario interrupted, skipping %d remaining stages\n", len(stages)-i-1)
+			break
+		}
+	}
+
+	fmt.Println("scenario summary:")
+	for i, r := range summaries {
+		fmt.Printf("  %s: %s\n", names[i], r)
+	}
+	if violated {
+		os.Exit(1)
+	}
+}
+
+func summaryPath(i int) string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("bkc-scenario-%d-%d.json", os.Getpid(), i))
+}
+
+func readStageSummary(path string) *summaryReport {
+	b, err := os.ReadFile(path)
+	if err != nil || len(b) == 0 {
+		return nil
+	}
+	r := new(summaryReport)
+	if json.Unmarshal(b, r) != nil {
+		return nil
+	}
+	return r
+}
+
+// writeSummaryFile writes the final summary for -summary-file.
+func writeSummaryFile(path string, r *summaryReport) {
+	b, err := json.Marshal(r)
+	chk(err, "unable to encode summary: %v", err)
+	err = os.WriteFile(path, b, 0o644)
+	chk(err, "unable to write summary file %s: %v", path, err)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// schemaValues generates record values from -value-schema, registered with
+// -schema-registry-url, in the Confluent wire format every Schema Registry
+// aware serializer uses: a zero magic byte, the big endian schema id, and
+// (for Protobuf) the index of the message within the schema, then the
+// encoded value.
+type schemaValues struct {
+	prefix []byte
+	avro   *avroType
+	proto  []protoField
+}
+
+// newSchemaValues reads the schema at path, registers it under subject, and
+// parses it to generate values from. The schema type is protobuf for .proto
+// files and avro otherwise.
+func newSchemaValues(registry, subject, path string) *schemaValues {
+	raw, err := os.ReadFile(path)
+	chk(err, "unable to read value schema %s: %v", path, err)
+	schema := string(raw)
+
+	s := new(schemaValues)
+	typ := "AVRO"
+	if filepath.Ext(path) == ".proto" {
+		typ = "PROTOBUF"
+		s.proto = parseProtoSchema(schema)
+	} else {
+		s.avro = parseAvroSchema(schema)
+	}
+
+	id := registerSchema(registry, subject, typ, schema)
+	s.prefix = binary.BigEndian.AppendUint32([]byte{0}, uint32(id))
+	if s.proto != nil {
+		s.prefix = append(s.prefix, 0) // the first message, as an empty index list
+	}
+	return s
+}
+
+// registerSchema registers schema under subject, returning its id. Schema
+// Registry returns the existing id if the schema is already registered.
+func registerSchema(registry, subject, typ, schema string) int {
+	body, _ := json.Marshal(struct {
+		Schema     string `json:"schema"`
+		SchemaType string `json:"schemaType"`
+	}{schema, typ})
+
+	u := strings.TrimSuffix(registry, "/") + "/subjects/" + url.PathEscape(subject) + "/versions"
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(u, "application/vnd.schemaregistry.v1+json", bytes.NewReader(body))
+	chk(err, "unable to register value schema with %s: %v", registry, err)
+	defer resp.Body.Close()
+
+	var registered struct {
+		ID      int    `json:"id"`
+		Message string `json:"message"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&registered)
+	if resp.StatusCode != http.StatusOK {
+		die("schema registry %s rejected the value schema for %s: %s %s", registry, subject, resp.Status, registered.Message)
+	}
+	chk(err, "invalid schema registry response: %v", err)
+	fmt.Fprintf(os.Stderr, "registered %s value schema for %s as id %d\n", strings.ToLower(typ), subject, registered.ID)
+	return registered.ID
+}
+
+func (s *schemaValues) render(rng *rand.Rand) []byte {
+	v := append(make([]byte, 0, 64), s.prefix...)
+	if s.avro != nil {
+		return s.avro.append(v, rng)
+	}
+	for _, f := range s.proto {
+		n := 1
+		if f.repeated {
+			n = 1 + rng.Intn(3)
+		}
+		for i := 0; i < n; i++ {
+			v = f.append(v, rng)
+		}
+	}
+	return v
+}
+
+// protoField is one scalar field of the first message in a .proto schema.
+type protoField struct {
+	num      protowire.Number
+	typ      string
+	repeated bool
+}
+
+var (
+	protoMessage = regexp.MustCompile(`(?s)\bmessage\s+\w+\s*\{(.*)`)
+	protoLine    = regexp.MustCompile(`^(repeated\s+|optional\s+)?(\w+)\s+\w+\s*=\s*(\d+)\s*(\[.*\])?$`)
+)
+
+// parseProtoSchema parses the fields of the first message in a proto3
+// schema. Only scalar fields are supported: nested messages, enums, maps,
+// and oneofs are not.
+func parseProtoSchema(schema string) []protoField {
+	m := protoMessage.FindStringSubmatch(schema)
+	if m == nil {
+		die("protobuf value schema has no message")
+	}
+	body := m[1]
+	if end := strings.IndexByte(body, '}'); end >= 0 {
+		body = body[:end]
+	}
+
+	var fields []protoField
+	for _, stmt := range strings.Split(body, ";") {
+		var lines []string
+		for _, line := range strings.Split(stmt, "\n") {
+			if i := strings.Index(line, "//"); i >= 0 {
+				line = line[:i]
+			}
+			lines = append(lines, line)
+		}
+		stmt = strings.Join(strings.Fields(strings.Join(lines, " ")), " ")
+		if stmt == "" || strings.HasPrefix(stmt, "option ") || strings.HasPrefix(stmt, "reserved ") {
+			continue
+		}
+		fm := protoLine.FindStringSubmatch(stmt)
+		if fm == nil {
+			die("unsupported protobuf value schema field %q: only scalar fields are supported", stmt)
+		}
+		num, _ := strconv.Atoi(fm[3])
+		f := protoField{num: protowire.Number(num), typ: fm[2], repeated: strings.HasPrefix(fm[1], "repeated")}
+		switch f.typ {
+		case "double", "float", "int32", "int64", "uint32", "uint64", "sint32", "sint64",
+			"fixed32", "fixed64", "sfixed32", "sfixed64", "bool", "string", "bytes":
+		default:
+			die("unsupported protobuf value schema field type %s: only scalar fields are supported", f.typ)
+		}
+		fields = append(fields, f)
+	}
+	if len(fields) == 0 {
+		die("protobuf value schema message has no fields")
+	}
+	return fields
+}
+
+// append appends one random value of f, with its tag. Repeated scalars are
+// appended unpacked, which parsers accept for packed fields too.
+func (f protoField) append(dst []byte, rng *rand.Rand) []byte {
+	switch f.typ {
+	case "double":
+		dst = protowire.AppendTag(dst, f.num, protowire.Fixed64Type)
+		return protowire.AppendFixed64(dst, math.Float64bits(rng.Float64()*1000))
+	case "float":
+		dst = protowire.AppendTag(dst, f.num, protowire.Fixed32Type)
+		return protowire.AppendFixed32(dst, math.Float32bits(rng.Float32()*1000))
+	case "fixed64", "sfixed64":
+		dst = protowire.AppendTag(dst, f.num, protowire.Fixed64Type)
+		return protowire.AppendFixed64(dst, uint64(rng.Int63n(1000000)))
+	case "fixed32", "sfixed32":
+		dst = protowire.AppendTag(dst, f.num, protowire.Fixed32Type)
+		return protowire.AppendFixed32(dst, uint32(rng.Int63n(1000000)))
+	case "sint32", "sint64":
+		dst = protowire.AppendTag(dst, f.num, protowire.VarintType)
+		return protowire.AppendVarint(dst, protowire.EncodeZigZag(rng.Int63n(2000000)-1000000))
+	case "bool":
+		dst = protowire.AppendTag(dst, f.num, protowire.VarintType)
+		return protowire.AppendVarint(dst, uint64(rng.Intn(2)))
+	case "string", "bytes":
+		dst = protowire.AppendTag(dst, f.num, protowire.BytesType)
+		dst = protowire.AppendVarint(dst, 8)
+		return appendLetters(dst, 8, rng)
+	default: // int32, int64, uint32, uint64
+		dst = protowire.AppendTag(dst, f.num, protowire.VarintType)
+		return protowire.AppendVarint(dst, uint64(rng.Int63n(1000000)))
+	}
+}
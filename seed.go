@@ -0,0 +1,44 @@
+package main
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+// runSeed seeds every random choice the workload makes: record sizes, keys
+// and -hot-partition-pct skew, -payload-template and -schema contents,
+// -process-time, and -pause-every. It is -seed, or if unset one picked from
+// the clock, and is in the summary so that any run can be repeated.
+var runSeed int64
+
+// seedWorker is this -worker-of process's worker index, or -1.
+var seedWorker = -1
+
+func initSeed() {
+	runSeed = *seed
+	if runSeed == 0 {
+		runSeed = time.Now().UnixNano()
+	}
+}
+
+// seededRand returns the random source for the i'th client (or preload
+// client) of stream. Each client gets its own sequence, the same every run
+// with the same seed regardless of the order clients start in, and workers
+// of a coordinator each get their own.
+func seededRand(stream string, i int) *rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(stream))
+	if seedWorker >= 0 {
+		h.Write([]byte("/" + strconv.Itoa(seedWorker)))
+	}
+	x := uint64(runSeed) ^ h.Sum64() ^ uint64(i)*0x9e3779b97f4a7c15
+
+	// splitmix64's finalizer, so that nearby seeds and clients get
+	// unrelated sequences.
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	x ^= x >> 31
+	return rand.New(rand.NewSource(int64(x)))
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A report is one set of numbers the run produces: the per-interval rate,
+// a lag query result, and so on. Every report goes to every configured sink.
+type report interface {
+	// kind names the report in structured sinks, e.g. "rate" or "lag".
+	kind() string
+	// String is the human readable line for stdout.
+	String() string
+	// metrics flattens the report for metric sinks (Prometheus, StatsD).
+	metrics() []metric
+}
+
+// metric is a single named value from a report. Counters are deltas since
+// the previous report of the same kind; gauges are point-in-time values.
+type metric struct {
+	name    string
+	labels  []string // alternating key, value
+	value   float64
+	counter bool
+}
+
+type sink interface {
+	write(at time.Time, r report)
+}
+
+var (
+	sinksMu sync.Mutex
+	sinks   []sink
+)
+
+// emit delivers r to every sink. Reports come from several goroutines (rate,
+// lag, ...), so sinks are serialized here and need no locking of their own.
+func emit(r report) {
+	now := time.Now()
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+	for _, s := range sinks {
+		s.write(now, r)
+	}
+}
+
+// parseSinks parses a comma delimited list of kind[:arg] sinks:
+//
+//	stdout             human readable lines (the default)
+//	json:<path>        one JSON object per report, per line
+//	prom:<addr>        Prometheus text exposition on http://<addr>/metrics
+//	statsd:<host:port> StatsD over UDP
+func parseSinks(spec string) []sink {
+	var ss []sink
+	for _, s := range strings.Split(spec, ",") {
+		kind, arg := s, ""
+		if i := strings.IndexByte(s, ':'); i >= 0 {
+			kind, arg = s[:i], s[i+1:]
+		}
+		switch kind {
+		case "stdout":
+			ss = append(ss, stdoutSink{})
+		case "json":
+			if arg == "" {
+				die("json sink requires a path, e.g. json:/tmp/run.json")
+			}
+			f, err := os.Create(arg)
+			chk(err, "unable to create json sink file %s: %v", arg, err)
+			ss = append(ss, &jsonSink{enc: json.NewEncoder(f)})
+		case "prom":
+			if arg == "" {
+				die("prom sink requires a listen address, e.g. prom::9100")
+			}
+			ss = append(ss, newPromSink(arg))
+		case "statsd":
+			if arg == "" {
+				die("statsd sink requires an address, e.g. statsd:localhost:8125")
+			}
+			conn, err := net.Dial("udp", arg)
+			chk(err, "unable to dial statsd at %s: %v", arg, err)
+			ss = append(ss, &statsdSink{conn: conn})
+		default:
+			die("unrecognized sink %q", s)
+		}
+	}
+	return ss
+}
+
+type stdoutSink struct{}
+
+func (stdoutSink) write(_ time.Time, r report) {
+	if *quiet && r.kind() != "summary" {
+		return
+	}
+	fmt.Println(r.String())
+}
+
+type jsonSink struct{ enc *json.Encoder }
+
+func (s *jsonSink) write(at time.Time, r report) {
+	err := s.enc.Encode(struct {
+		Type   string            `json:"type"`
+		Time   time.Time         `json:"time"`
+		Labels map[string]string `json:"labels,omitempty"`
+		Report report            `json:"report"`
+	}{r.kind(), at, runLabels.labelMap(), r})
+	chk(err, "unable to write json report: %v", err)
+}
+
+// promSink accumulates counters and tracks the latest gauges, serving both
+// in the Prometheus text format.
+type promSink struct {
+	mu       sync.Mutex
+	families map[string]*promFamily
+}
+
+type promFamily struct {
+	counter bool
+	series  map[string]float64 // rendered labels => value
+}
+
+func newPromSink(addr string) *promSink {
+	s := &promSink{families: make(map[string]*promFamily)}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", s)
+	go func() {
+		die("prom sink on %s failed: %v", addr, http.ListenAndServe(addr, mux))
+	}()
+	return s
+}
+
+func (s *promSink) write(_ time.Time, r report) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range labeled(r.metrics()) {
+		name := "bkc_" + m.name
+		if m.counter {
+			name += "_total"
+		}
+		f := s.families[name]
+		if f == nil {
+			f = &promFamily{counter: m.counter, series: make(map[string]float64)}
+			s.families[name] = f
+		}
+
+		var labels string
+		if len(m.labels) > 0 {
+			var kvs []string
+			for i := 0; i+1 < len(m.labels); i += 2 {
+				kvs = append(kvs, fmt.Sprintf("%s=%q", m.labels[i], m.labels[i+1]))
+			}
+			labels = "{" + strings.Join(kvs, ",") + "}"
+		}
+
+		if m.counter {
+			f.series[labels] += m.value
+		} else {
+			f.series[labels] = m.value
+		}
+	}
+}
+
+func (s *promSink) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.families))
+	for name := range s.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, name := range names {
+		f := s.families[name]
+		typ := "gauge"
+		if f.counter {
+			typ = "counter"
+		}
+		fmt.Fprintf(w, "# TYPE %s %s\n", name, typ)
+
+		series := make([]string, 0, len(f.series))
+		for labels := range f.series {
+			series = append(series, labels)
+		}
+		sort.Strings(series)
+		for _, labels := range series {
+			fmt.Fprintf(w, "%s%s %s\n", name, labels, strconv.FormatFloat(f.series[labels], 'f', -1, 64))
+		}
+	}
+}
+
+// statsdSink writes plain StatsD, which has no tags: label values are folded
+// into the metric name, e.g. bkc.group_lag.mygroup.mytopic.3.
+type statsdSink struct{ conn net.Conn }
+
+func (s *statsdSink) write(_ time.Time, r report) {
+	for _, m := range labeled(r.metrics()) {
+		var b strings.Builder
+		b.WriteString("bkc.")
+		b.WriteString(m.name)
+		for i := 1; i < len(m.labels); i += 2 {
+			b.WriteByte('.')
+			b.WriteString(statsdReplacer.Replace(m.labels[i]))
+		}
+		typ := "g"
+		if m.counter {
+			typ = "c"
+		}
+		fmt.Fprintf(&b, ":%s|%s", strconv.FormatFloat(m.value, 'f', -1, 64), typ)
+
+		// StatsD is best effort; a dropped datagram is not worth failing
+		// the run over.
+		s.conn.Write([]byte(b.String()))
+	}
+}
+
+var statsdReplacer = strings.NewReplacer(".", "_", ":", "_", "|", "_", "@", "_")
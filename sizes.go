@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// recordSizer picks the value size of each produced record.
+type recordSizer interface {
+	next(rng *rand.Rand) int
+	// mean sizes how many records to allow buffering; max validates
+	// against the batch size.
+	mean() float64
+	max() int
+}
+
+// fixedSize sizes every record by -record-size, or whatever the control API
+// last set it to.
+type fixedSize struct{}
+
+func (fixedSize) next(*rand.Rand) int { return int(atomic.LoadInt64(&live.recordSize)) }
+func (fixedSize) mean() float64       { return float64(atomic.LoadInt64(&live.recordSize)) }
+func (fixedSize) max() int            { return int(atomic.LoadInt64(&live.recordSize)) }
+
+// sizeMix interleaves a few distinct sizes by weight within one producer,
+// e.g. mostly small records with the occasional very large outlier.
+type sizeMix struct {
+	cum   []float64 // cumulative weights, normalized so the last is 1
+	sizes []int
+}
+
+// parseSizeMix parses weight:size pairs such as "95:200,5:500k".
+func parseSizeMix(spec string) *sizeMix {
+	m := new(sizeMix)
+	for _, pair := range strings.Split(spec, ",") {
+		kv := strings.SplitN(pair, ":", 2)
+		if len(kv) != 2 {
+			die("invalid record size mix entry %q, expected weight:size", pair)
+		}
+		m.add(kv[0], kv[1])
+	}
+	m.normalize()
+	return m
+}
+
+func (m *sizeMix) add(weight, size string) {
+	w, err := strconv.ParseFloat(weight, 64)
+	if err != nil || w <= 0 {
+		die("invalid record size weight %q", weight)
+	}
+	n := parseBytes(size)
+	if n <= 0 {
+		die("record sizes must be larger than zero")
+	}
+	var total float64
+	if len(m.cum) > 0 {
+		total = m.cum[len(m.cum)-1]
+	}
+	m.cum = append(m.cum, total+w)
+	m.sizes = append(m.sizes, n)
+}
+
+func (m *sizeMix) normalize() {
+	total := m.cum[len(m.cum)-1]
+	for i := range m.cum {
+		m.cum[i] /= total
+	}
+}
+
+func (m *sizeMix) next(rng *rand.Rand) int {
+	i := sort.SearchFloat64s(m.cum, rng.Float64())
+	if i == len(m.sizes) {
+		i--
+	}
+	return m.sizes[i]
+}
+
+func (m *sizeMix) mean() float64 {
+	var mean, prev float64
+	for i, c := range m.cum {
+		mean += (c - prev) * float64(m.sizes[i])
+		prev = c
+	}
+	return mean
+}
+
+func (m *sizeMix) max() int {
+	var max int
+	for _, s := range m.sizes {
+		if s > max {
+			max = s
+		}
+	}
+	return max
+}
+
+// parseSizeDist parses a -record-size-dist spec:
+//
+//	fixed                   every record is -record-size
+//	uniform:MIN-MAX         uniformly random within [MIN, MAX]
+//	lognormal:MEAN,STDDEV   log-normal with this mean and standard deviation
+//	histogram:FILE          weighted sizes, one "bytes weight" pair per line
+//
+// Sizes accept the same suffixes as parseBytes.
+func parseSizeDist(spec string) recordSizer {
+	kind, arg := spec, ""
+	if i := strings.IndexByte(spec, ':'); i >= 0 {
+		kind, arg = spec[:i], spec[i+1:]
+	}
+	switch kind {
+	case "fixed":
+		return fixedSize{}
+	case "uniform":
+		bounds := strings.SplitN(arg, "-", 2)
+		if len(bounds) != 2 {
+			die("invalid uniform record size distribution %q, expected uniform:MIN-MAX", spec)
+		}
+		min, max := parseBytes(bounds[0]), parseBytes(bounds[1])
+		if min <= 0 || max < min {
+			die("invalid uniform record size bounds %q", arg)
+		}
+		return uniformSize{min, max}
+	case "lognormal":
+		l, mean, ok := parseLognormal(arg, func(v string) (float64, bool) {
+			n := parseBytes(v)
+			return float64(n), n >= 0
+		})
+		if !ok {
+			die("invalid lognormal record size distribution %q, expected lognormal:MEAN,STDDEV with a positive mean", spec)
+		}
+		return lognormalSize{lognormal: l, avg: mean, limit: *maxBatchSize}
+	case "histogram":
+		return parseSizeHistogram(arg)
+	default:
+		die("unrecognized record size distribution %q", spec)
+		return nil
+	}
+}
+
+type uniformSize struct{ lo, hi int }
+
+func (u uniformSize) next(rng *rand.Rand) int { return u.lo + rng.Intn(u.hi-u.lo+1) }
+func (u uniformSize) mean() float64           { return float64(u.lo+u.hi) / 2 }
+func (u uniformSize) max() int                { return u.hi }
+
+// lognormal is a log-normal distribution, the usual shape of real payload
+// sizes and processing times: most draws near the median with a long tail.
+type lognormal struct {
+	mu, sigma float64 // of the underlying normal distribution
+}
+
+// parseLognormal parses MEAN,STDDEV, each with parse, into the
+// distribution with that mean and standard deviation. The mean must be
+// positive and the deviation not negative.
+func parseLognormal(arg string, parse func(string) (float64, bool)) (l lognormal, mean float64, ok bool) {
+	params := strings.SplitN(arg, ",", 2)
+	if len(params) != 2 {
+		return l, 0, false
+	}
+	mean, ok1 := parse(params[0])
+	stddev, ok2 := parse(params[1])
+	if !ok1 || !ok2 || mean <= 0 || stddev < 0 {
+		return l, 0, false
+	}
+	sigma2 := math.Log(1 + stddev*stddev/(mean*mean))
+	return lognormal{mu: math.Log(mean) - sigma2/2, sigma: math.Sqrt(sigma2)}, mean, true
+}
+
+func (l lognormal) draw(rng *rand.Rand) float64 {
+	return math.Exp(l.mu + l.sigma*rng.NormFloat64())
+}
+
+// lognormalSize draws record sizes from a lognormal. Draws are clamped to
+// [1, -max-batch-size] so the tail cannot produce a record that does not
+// fit in a batch.
+type lognormalSize struct {
+	lognormal
+	avg   float64
+	limit int
+}
+
+func (l lognormalSize) next(rng *rand.Rand) int {
+	n := int(l.draw(rng))
+	switch {
+	case n < 1:
+		return 1
+	case n > l.limit:
+		return l.limit
+	}
+	return n
+}
+
+func (l lognormalSize) mean() float64 { return l.avg }
+func (l lognormalSize) max() int      { return l.limit }
+
+// parseSizeHistogram reads weighted sizes from a file, e.g. one exported
+// from a production topic, into a sizeMix. Blank lines and lines starting
+// with # are skipped.
+func parseSizeHistogram(path string) *sizeMix {
+	f, err := os.Open(path)
+	chk(err, "unable to open record size histogram %s: %v", path, err)
+	defer f.Close()
+
+	m := new(sizeMix)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			die("invalid record size histogram line %q in %s, expected \"bytes weight\"", line, path)
+		}
+		m.add(fields[1], fields[0])
+	}
+	chk(scanner.Err(), "unable to read record size histogram %s: %v", path, scanner.Err())
+	if len(m.sizes) == 0 {
+		die("record size histogram %s is empty", path)
+	}
+	m.normalize()
+	return m
+}
+
+// parseBytes parses a byte count with an optional binary suffix: k/kb/kib,
+// m/mb/mib, or g/gb/gib (case insensitive). It returns -1 if s is invalid.
+func parseBytes(s string) int {
+	s = strings.ToLower(strings.TrimSpace(s))
+	mul := 1
+	for _, u := range []struct {
+		suffix string
+		mul    int
+	}{
+		{"kib", 1 << 10}, {"kb", 1 << 10}, {"k", 1 << 10},
+		{"mib", 1 << 20}, {"mb", 1 << 20}, {"m", 1 << 20},
+		{"gib", 1 << 30}, {"gb", 1 << 30}, {"g", 1 << 30},
+	} {
+		if strings.HasSuffix(s, u.suffix) {
+			s, mul = strings.TrimSuffix(s, u.suffix), u.mul
+			break
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return -1
+	}
+	return n * mul
+}
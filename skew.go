@@ -0,0 +1,14 @@
+package main
+
+import "math/rand"
+
+// skewKey returns the key to produce a record with: -hot-key for a random
+// -hot-partition-pct of records, and key otherwise. Every hot record hashes
+// to the same partition, so that partition's leader takes that share of the
+// load on top of its even share of the rest.
+func skewKey(key []byte, rng *rand.Rand) []byte {
+	if *hotPartitionPct > 0 && rng.Float64()*100 < *hotPartitionPct {
+		return hotKeyBytes
+	}
+	return key
+}
@@ -0,0 +1,12 @@
+//go:build !unix
+
+package main
+
+// socketBuffersSupported is whether setSocketBuffer can set buffer sizes.
+const socketBuffersSupported = false
+
+// setSocketBuffer is unreachable: newNetDialer rejects socket buffer sizes
+// where they are unsupported.
+func setSocketBuffer(uintptr, string, int) error {
+	panic("unreachable")
+}
@@ -0,0 +1,35 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+)
+
+// socketBuffersSupported is whether setSocketBuffer can set buffer sizes.
+const socketBuffersSupported = true
+
+// setSocketBuffer sets fd's SO_SNDBUF or SO_RCVBUF, warning if the kernel
+// clamps it. Linux reports double what was set, for its own bookkeeping.
+func setSocketBuffer(fd uintptr, which string, bytes int) error {
+	opt := syscall.SO_SNDBUF
+	if which == "recv" {
+		opt = syscall.SO_RCVBUF
+	}
+	if err := syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, opt, bytes); err != nil {
+		return fmt.Errorf("unable to set socket %s buffer to %d bytes: %w", which, bytes, err)
+	}
+	got, err := syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, opt)
+	if err != nil {
+		return nil
+	}
+	if runtime.GOOS == "linux" {
+		got /= 2
+	}
+	if got < bytes {
+		warnShortBuffer(which, bytes, got)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// bouncer restarts a group member every -bounce-every, down for
+// -bounce-for, and checks whether its group rebalanced by comparing the
+// generations of the group's other members from before the bounce with
+// once the bounced member is back. Members are bounced by churnClients, as
+// with -rebalance-every, so the highest indexed client is the one bounced.
+// With -group-instance-id the members are static, so as long as a member is
+// back within the session timeout the generation should not move; without
+// it, every bounce rebalances twice.
+type bouncer struct {
+	mu      sync.Mutex
+	members map[int]groupMember // running group members by client index
+
+	bounces    int64 // since the last report
+	rebalanced int64
+	total      bounceReport
+}
+
+type groupMember struct {
+	group  string
+	client *kgo.Client
+}
+
+var bounces = bouncer{members: make(map[int]groupMember)}
+
+// member tracks client i, in group, until the returned func is called.
+func (b *bouncer) member(i int, group string, client *kgo.Client) func() {
+	b.mu.Lock()
+	b.members[i] = groupMember{group, client}
+	b.mu.Unlock()
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.members[i].client == client {
+			delete(b.members, i)
+		}
+	}
+}
+
+// generation returns the highest generation among members of group other
+// than except, and the generation of except itself.
+func (b *bouncer) generation(group string, except int) (others, own int32) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	own = -1
+	for i, m := range b.members {
+		if m.group != group {
+			continue
+		}
+		_, gen := m.client.GroupMetadata()
+		if i == except {
+			own = gen
+		} else {
+			others = max(others, gen)
+		}
+	}
+	return others, own
+}
+
+// bounce notes client i's group's generation before churnClients stops i,
+// returning the check to run once i is started again.
+func (b *bouncer) bounce(i int) func() {
+	b.mu.Lock()
+	m, ok := b.members[i]
+	b.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	before, _ := b.generation(m.group, i)
+	return func() {
+		// Wait for the member to rejoin, then give any rebalance it
+		// caused time to reach the others.
+		deadline := time.Now().Add(time.Minute)
+		for time.Now().Before(deadline) {
+			if _, own := b.generation(m.group, i); own > 0 {
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		time.Sleep(time.Second)
+
+		after, _ := b.generation(m.group, i)
+		atomic.AddInt64(&b.bounces, 1)
+		if after != before {
+			atomic.AddInt64(&b.rebalanced, 1)
+			fmt.Fprintf(os.Stderr, "bouncing client %d rebalanced group %s (generation %d to %d)\n", i, m.group, before, after)
+		}
+	}
+}
+
+// bounceReport is the member bounces over one interval, or the whole run.
+type bounceReport struct {
+	Bounces    int64 `json:"bounces"`
+	Rebalanced int64 `json:"rebalanced"`
+}
+
+func (b *bouncer) swap() *bounceReport {
+	r := &bounceReport{
+		Bounces:    atomic.SwapInt64(&b.bounces, 0),
+		Rebalanced: atomic.SwapInt64(&b.rebalanced, 0),
+	}
+	atomic.AddInt64(&b.total.Bounces, r.Bounces)
+	atomic.AddInt64(&b.total.Rebalanced, r.Rebalanced)
+	return r
+}
+
+func (b *bouncer) totals() *bounceReport {
+	return &bounceReport{
+		Bounces:    atomic.LoadInt64(&b.total.Bounces),
+		Rebalanced: atomic.LoadInt64(&b.total.Rebalanced),
+	}
+}
+
+func (r *bounceReport) String() string {
+	return fmt.Sprintf("bounces %d members restarted, %d rebalanced the group, %d avoided rebalancing",
+		r.Bounces, r.Rebalanced, r.Bounces-r.Rebalanced)
+}
+
+func (r *bounceReport) metrics() []metric {
+	return []metric{
+		{name: "bounces", value: float64(r.Bounces), counter: true},
+		{name: "bounces_rebalanced", value: float64(r.Rebalanced), counter: true},
+	}
+}
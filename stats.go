@@ -0,0 +1,90 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// rateClock times rate reports on the monotonic clock, so that each report
+// covers the time that actually passed since the last one rather than the
+// ticker's nominal -report-interval, which drifts under load and is short
+// for the last report of a run.
+type rateClock struct {
+	mu    sync.Mutex
+	began time.Time
+	last  time.Time
+}
+
+var rates rateClock
+
+func (c *rateClock) start() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.began = time.Now()
+	c.last = c.began
+}
+
+// elapsed returns how long it has been since the first interval started.
+func (c *rateClock) elapsed() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.began.IsZero() {
+		return 0
+	}
+	return time.Since(c.began)
+}
+
+// next returns how long it has been since the previous report, starting the
+// next interval.
+func (c *rateClock) next() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	elapsed := now.Sub(c.last)
+	c.last = now
+	return elapsed
+}
+
+// cumulativePercentiles is whether rate reports' percentiles cover the whole
+// run (-percentiles cumulative) rather than each interval. It is only set
+// once the run starts, so that dropping -preload's stats still resets them.
+var cumulativePercentiles bool
+
+func parsePercentiles(mode string) bool {
+	switch mode {
+	case "window":
+		return false
+	case "cumulative":
+		return true
+	}
+	die("unrecognized -percentiles %q, expected window or cumulative", mode)
+	return false
+}
+
+// interval returns what a rate report's percentiles cover: everything
+// observed since the last report, resetting the histogram, or with
+// cumulative percentiles everything observed so far.
+func (h *histogram) interval() *histSnapshot {
+	if cumulativePercentiles {
+		return h.snapshot()
+	}
+	return h.swap()
+}
+
+// lastProduceLat is produce latency as of the previous rate report. Produce
+// latency is never swapped until the summary, which covers the whole run, so
+// windowed rate reports diff snapshots instead.
+var lastProduceLat = new(histSnapshot)
+
+func intervalProduceLatency() *latencySummary {
+	now := produceLat.snapshot()
+	lat := now
+	if !cumulativePercentiles {
+		lat = now.sub(lastProduceLat)
+	}
+	lastProduceLat = now
+	if lat.total == 0 {
+		return nil
+	}
+	return lat.summary()
+}
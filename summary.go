@@ -0,0 +1,374 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Run totals, accumulated from every rate report so that the final summary
+// (and per-record allocation reports) see the whole run.
+var (
+	totalRecs  int64
+	totalBytes int64
+	totalErrs  int64
+
+	// produceLat is the produce latency of every record over the whole
+	// run, from the record's timestamp to its promise.
+	produceLat histogram
+
+	// countProduceErrs makes produce errors counted in produceErrors
+	// rather than fatal, for -auto-backoff and -assert-max-errors.
+	countProduceErrs bool
+	produceErrors    int64
+)
+
+// errors is the failures within a rate report: failed commits, aborted
+// transactions, rejected raw requests, and corrupt records.
+func (r *rateReport) errors() int64 {
+	var n int64
+	if r.Commits != nil {
+		n += r.Commits.Errors
+	}
+	if r.Txn != nil {
+		n += r.Txn.Aborts
+	}
+	if r.Checksums != nil {
+		n += r.Checksums.Corrupt
+	}
+	if r.Raw != nil {
+		for _, errs := range r.Raw.Errors {
+			n += errs
+		}
+	}
+	return n
+}
+
+// minThroughput is a parsed -assert-min-throughput: either bytes or records
+// per second.
+type minThroughput struct {
+	perSec  float64
+	records bool
+}
+
+// parseThroughput parses flag name's rate, such as 200MiB/s, 500k/s
+// (bytes), or 50000records/s.
+func parseThroughput(name, spec string) minThroughput {
+	s := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(spec)), "/s")
+	if n := strings.TrimSuffix(s, "records"); n != s {
+		f, err := strconv.ParseFloat(n, 64)
+		if err != nil || f <= 0 {
+			die("invalid -%s %q", name, spec)
+		}
+		return minThroughput{perSec: f, records: true}
+	}
+	n := parseBytes(s)
+	if n <= 0 {
+		n = parseBytes(strings.TrimSuffix(s, "b")) // plain bytes, e.g. 1000b/s
+	}
+	if n <= 0 {
+		die("invalid -%s %q, expected e.g. 200MiB/s or 50000records/s", name, spec)
+	}
+	return minThroughput{perSec: float64(n)}
+}
+
+// runDone stops the run on interrupt, and a second interrupt exits
+// immediately.
+var (
+	runDone  = make(chan os.Signal, 2)
+	stopOnce sync.Once
+)
+
+// stopRun stops the run from within, after -duration or when a coordinator
+// says so; only the first call counts.
+func stopRun() {
+	stopOnce.Do(func() { runDone <- syscall.SIGTERM })
+}
+
+// measuringProduceLatency is whether producing records its latency, which
+// producing generated or replayed records does with any client library.
+func measuringProduceLatency() bool {
+	return !*consumeMode && !*rawProduceMode
+}
+
+// runWorkload runs the clients until -duration passes or the process is
+// interrupted, then emits the final summary, exiting non-zero if any
+// -assert flag is violated. A second interrupt exits immediately, for when
+// stopping hangs on an unreachable cluster.
+func runWorkload() {
+	var min *minThroughput
+	if *assertMinThroughput != "" {
+		t := parseThroughput("assert-min-throughput", *assertMinThroughput)
+		min = &t
+	}
+	measureLat := measuringProduceLatency()
+	if *assertP99 > 0 && !measureLat {
+		die("-assert-p99-latency only applies to producing, without -raw-produce")
+	}
+	if *assertNoLeaks && *leakEvery <= 0 {
+		die("-assert-no-leaks requires -leak-watch")
+	}
+	if *leakGrowth < 0 {
+		die("-leak-growth must be non-negative")
+	}
+	if *targetP99 > 0 || *targetThroughput != "" {
+		target = newTargetController(*targetAdjust, *targetP99, *targetThroughput)
+	}
+
+	if healthAdm != nil {
+		if healthBefore = snapshotHealth(healthAdm, "before"); healthBefore != nil {
+			emit(healthBefore)
+		}
+	}
+
+	markPhase("running")
+	start := time.Now()
+	if *leakEvery > 0 {
+		leaks = watchLeaks(*leakEvery, !*consumeMode && !*rawProduceMode && *clientLib == "franz-go")
+	}
+	setClients(*clients)
+	if target != nil {
+		go target.run()
+	}
+
+	signal.Notify(runDone, os.Interrupt, syscall.SIGTERM)
+	if *runFor > 0 {
+		time.AfterFunc(*runFor, stopRun)
+	}
+	if *numRecords > 0 {
+		go stopAtNumRecords()
+	}
+	go func() {
+		<-runDone
+		if leaks != nil {
+			leaks.stop()
+		}
+		if target != nil {
+			target.stop()
+		}
+		setClients(0)
+		<-runDone
+		die("interrupted while stopping")
+	}()
+	live.wg.Wait()
+	if verifying != nil {
+		verifying.drain()
+	}
+	if tailing != nil {
+		tailing.drain()
+	}
+	if samples != nil {
+		samples.close()
+	}
+	if chaos != nil {
+		chaos.close()
+	}
+
+	// Whatever was counted since the last rate line gets a last, short one.
+	stopRates()
+	emit(swapRateReport(rates.next()))
+
+	r := &summaryReport{
+		Duration: time.Since(start),
+		Records:  atomic.LoadInt64(&totalRecs),
+		Bytes:    atomic.LoadInt64(&totalBytes),
+		Errors:   atomic.LoadInt64(&totalErrs) + atomic.LoadInt64(&produceErrors),
+		Seed:     runSeed,
+		Labels:   runLabels.labelMap(),
+	}
+	if *produceDeadline > 0 {
+		r.Cancelled = atomic.LoadInt64(&totalCancelled)
+	}
+	if *reportFairness {
+		r.Fairness = memberFairness()
+	}
+	if *reportRetries {
+		r.Retries = retries.totals()
+	}
+	if *bounceEvery > 0 {
+		r.Bounces = bounces.totals()
+	}
+	if verifying != nil {
+		r.Verify = verifying.summary()
+		r.Verify.Retries = r.Retries
+	}
+	if healthAdm != nil {
+		if after := snapshotHealth(healthAdm, "after"); after != nil {
+			emit(after)
+			if healthBefore != nil {
+				r.Health = diffHealth(healthBefore, after)
+			}
+		}
+	}
+	if leaks != nil {
+		r.Leaks = leaks.report(*leakGrowth)
+	}
+	if target != nil {
+		r.Target = target.report()
+	}
+	if tailing != nil {
+		r.Tail = tailing.summary()
+	}
+	if measureLat {
+		r.latency = produceLat.swap()
+		r.Latency = r.latency.summary()
+	}
+
+	secs := r.Duration.Seconds()
+	if *assertP99 > 0 && r.Latency.P99 > *assertP99 {
+		r.Violations = append(r.Violations, fmt.Sprintf("p99 latency %v > %v", r.Latency.P99, *assertP99))
+	}
+	if min != nil {
+		if min.records && float64(r.Records)/secs < min.perSec {
+			r.Violations = append(r.Violations, fmt.Sprintf("%0.0f records/s < %0.0f records/s", float64(r.Records)/secs, min.perSec))
+		} else if !min.records && float64(r.Bytes)/secs < min.perSec {
+			r.Violations = append(r.Violations, fmt.Sprintf("%0.2f MiB/s < %0.2f MiB/s", float64(r.Bytes)/secs/(1024*1024), min.perSec/(1024*1024)))
+		}
+	}
+	if *assertNoLeaks && r.Leaks != nil {
+		if growing := r.Leaks.growing(); len(growing) > 0 {
+			r.Violations = append(r.Violations, "growing "+strings.Join(growing, ", "))
+		}
+	}
+	if *assertMaxErrors >= 0 && r.Errors > *assertMaxErrors {
+		r.Violations = append(r.Violations, fmt.Sprintf("%d errors > %d", r.Errors, *assertMaxErrors))
+	}
+	emit(r)
+	if *summaryFile != "" {
+		writeSummaryFile(*summaryFile, r)
+	}
+	// Workers leave pushing to the coordinator, whose summary is the fleet's.
+	if *pushResultsTo != "" && *workerOf == "" {
+		pushResults(*pushResultsTo, resultsAdminOpts, start, r)
+	}
+	if len(r.Violations) > 0 {
+		if diag != nil {
+			diag.dump("violated " + strings.Join(r.Violations, ", "))
+		}
+		stopTracing() // exiting skips main's deferred stop
+		os.Exit(1)
+	}
+}
+
+// summaryReport is the whole run, and which -assert flags it violated.
+type summaryReport struct {
+	Duration   time.Duration     `json:"duration_ns"`
+	Records    int64             `json:"records"`
+	Bytes      int64             `json:"bytes"`
+	Errors     int64             `json:"errors"`
+	Cancelled  int64             `json:"cancelled,omitempty"`
+	Latency    *latencySummary   `json:"produce_latency,omitempty"`
+	Fairness   fairnessReports   `json:"fairness,omitempty"`
+	Retries    *retryReport      `json:"retries,omitempty"`
+	Bounces    *bounceReport     `json:"bounces,omitempty"`
+	Verify     *verifySummary    `json:"verify,omitempty"`
+	Health     *healthDiff       `json:"health,omitempty"`
+	Leaks      *leakReport       `json:"leaks,omitempty"`
+	Target     *targetReport     `json:"target,omitempty"`
+	Tail       *tailSummary      `json:"tail,omitempty"`
+	Seed       int64             `json:"seed"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Violations []string          `json:"violations,omitempty"`
+
+	latency *histSnapshot // what Latency summarizes, for -worker-of
+}
+
+func (*summaryReport) kind() string { return "summary" }
+
+func (r *summaryReport) String() string {
+	secs := r.Duration.Seconds()
+	line := fmt.Sprintf("summary %v: %d records, %d bytes; %0.2f MiB/s; %0.2fk records/s; %d errors",
+		r.Duration.Round(time.Millisecond), r.Records, r.Bytes, float64(r.Bytes)/secs/(1024*1024), float64(r.Records)/secs/1000, r.Errors)
+	if r.Cancelled > 0 {
+		line += fmt.Sprintf("; %d cancelled at deadline", r.Cancelled)
+	}
+	if r.Latency != nil {
+		line += "; produce " + r.Latency.String()
+	}
+	if r.Fairness != nil {
+		line += "; " + r.Fairness.String()
+	}
+	if r.Bounces != nil {
+		line += "; " + r.Bounces.String()
+	}
+	if r.Verify != nil {
+		line += "; " + r.Verify.String()
+	} else if r.Retries != nil {
+		line += "; " + r.Retries.String()
+	}
+	if r.Health != nil {
+		line += "; " + r.Health.String()
+	}
+	if r.Leaks != nil {
+		line += "; " + r.Leaks.String()
+	}
+	if r.Target != nil {
+		line += "; " + r.Target.String()
+	}
+	if r.Tail != nil {
+		line += "; " + r.Tail.String()
+	}
+	line += fmt.Sprintf("; seed %d", r.Seed)
+	if r.Labels != nil {
+		line += "; labels " + labelsString(r.Labels)
+	}
+	if len(r.Violations) > 0 {
+		line += "; FAILED: " + strings.Join(r.Violations, ", ")
+	}
+	return line
+}
+
+func (r *summaryReport) metrics() []metric {
+	ms := []metric{
+		{name: "summary_duration_seconds", value: r.Duration.Seconds()},
+		{name: "summary_records", value: float64(r.Records)},
+		{name: "summary_bytes", value: float64(r.Bytes)},
+		{name: "summary_errors", value: float64(r.Errors)},
+		{name: "summary_cancelled", value: float64(r.Cancelled)},
+		{name: "summary_violations", value: float64(len(r.Violations))},
+	}
+	if r.Latency != nil {
+		ms = append(ms, r.Latency.metrics("summary_produce_latency")...)
+	}
+	if r.Fairness != nil {
+		ms = append(ms, r.Fairness.metrics()...)
+	}
+	if r.Retries != nil {
+		ms = append(ms,
+			metric{name: "summary_produce_failed_requests", value: float64(r.Retries.FailedRequests)},
+			metric{name: "summary_produce_ambiguous_requests", value: float64(r.Retries.AmbiguousRequests)},
+			metric{name: "summary_produce_retried_batches", value: float64(r.Retries.RetriedBatches)},
+		)
+	}
+	if r.Bounces != nil {
+		ms = append(ms,
+			metric{name: "summary_bounces", value: float64(r.Bounces.Bounces)},
+			metric{name: "summary_bounces_rebalanced", value: float64(r.Bounces.Rebalanced)},
+		)
+	}
+	if r.Verify != nil {
+		ms = append(ms, r.Verify.metrics()...)
+	}
+	if r.Health != nil {
+		ms = append(ms,
+			metric{name: "summary_leaders_moved", value: float64(r.Health.LeadersMoved)},
+			metric{name: "summary_under_replicated_change", value: float64(r.Health.UnderReplicated)},
+		)
+	}
+	if r.Leaks != nil {
+		ms = append(ms, r.Leaks.metrics()...)
+	}
+	if r.Target != nil {
+		ms = append(ms, metric{name: "summary_target_operating_point", labels: []string{"adjust", r.Target.Adjust}, value: float64(r.Target.Point)})
+	}
+	if r.Tail != nil {
+		ms = append(ms, r.Tail.metrics()...)
+	}
+	return ms
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// Closed loop produce calls since the last report, for -sync-produce.
+var (
+	syncCalls int64
+	syncLat   histogram // per ProduceSync call
+)
+
+// produceSync produces recs with ProduceSync, returning once every one is
+// acknowledged, so that each client has at most -sync-batch records in
+// flight: request-response producing, as many applications do it, rather
+// than keeping the pipeline full. Each record's latency is the whole call.
+func produceSync(client *kgo.Client, recs []*kgo.Record) {
+	if *checksums {
+		for _, r := range recs {
+			addChecksum(r)
+		}
+	}
+	start := time.Now()
+	results := client.ProduceSync(context.Background(), recs...)
+	syncLat.observe(time.Since(start))
+	atomic.AddInt64(&syncCalls, 1)
+	for _, res := range results {
+		producedSince(start, res.Record, res.Err)
+	}
+}
+
+// syncReport is the closed loop produce calls over one interval.
+type syncReport struct {
+	Calls   int64           `json:"calls"`
+	Latency *latencySummary `json:"call_latency"`
+	records int64
+}
+
+func swapSyncReport(records int64) *syncReport {
+	return &syncReport{
+		Calls:   atomic.SwapInt64(&syncCalls, 0),
+		Latency: syncLat.interval().summary(),
+		records: records,
+	}
+}
+
+func (r *syncReport) String() string {
+	var per float64
+	if r.Calls > 0 {
+		per = float64(r.records) / float64(r.Calls)
+	}
+	return fmt.Sprintf("sync %d calls of %0.1f records, call %s", r.Calls, per, r.Latency)
+}
+
+func (r *syncReport) metrics() []metric {
+	return append([]metric{
+		{name: "produce_sync_calls", value: float64(r.Calls), counter: true},
+	}, r.Latency.metrics("produce_sync_call_latency")...)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// tailHeader is the record header -tail-latency producers stamp every record
+// with: when it was produced, in unix nanoseconds, as record timestamps are
+// only milliseconds and may be the broker's append time.
+const tailHeader = "bkc-sent"
+
+// tailWatch is -tail-latency: an in-process consumer tails the topic while
+// a low -rate producer writes to it, and every record's delivery latency,
+// from being produced to being polled, is measured. At low throughput
+// fetches mostly wait out -fetch-max-wait for -fetch-min-bytes before
+// answering, so delivery latency is shaped by how the two interact rather
+// than by load, which saturation runs never show.
+type tailWatch struct {
+	client *kgo.Client
+	done   chan struct{}
+
+	lat       histogram     // never swapped, as the summary covers the run
+	last      *histSnapshot // lat as of the previous report
+	produced  int64         // over the run, acknowledged records stamped with tailHeader
+	delivered int64         // over the run
+	windowed  int64         // delivered since the last report
+}
+
+var tailing *tailWatch
+
+// startTail consumes topic with opts from now on, so that every record
+// produced from here is delivered however long the consumer takes to start.
+func startTail(opts []kgo.Opt, topic string) *tailWatch {
+	t := &tailWatch{done: make(chan struct{}), last: new(histSnapshot)}
+	copts := append(opts[:len(opts):len(opts)],
+		kgo.ConsumeTopics(topic),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AfterMilli(time.Now().UnixMilli())),
+	)
+	if *fetchMaxWait != 0 {
+		copts = append(copts, kgo.FetchMaxWait(*fetchMaxWait))
+	}
+	if *fetchMinBytes != 0 {
+		copts = append(copts, kgo.FetchMinBytes(int32(*fetchMinBytes)))
+	}
+	client, err := kgo.NewClient(copts...)
+	chk(err, "unable to initialize tail client: %v", err)
+	t.client = client
+	go func() {
+		defer close(t.done)
+		for {
+			fetches := client.PollFetches(context.Background())
+			if fetches.IsClientClosed() {
+				return
+			}
+			fetches.EachError(func(topic string, p int32, err error) {
+				die("tail fetch error on %s/%d: %v", topic, p, err)
+			})
+			now := time.Now()
+			fetches.EachRecord(func(r *kgo.Record) { t.delivered1(r, now) })
+		}
+	}()
+	return t
+}
+
+// stamp adds tailHeader to a record about to be produced.
+func (t *tailWatch) stamp(r *kgo.Record) {
+	sent := binary.BigEndian.AppendUint64(make([]byte, 0, 8), uint64(time.Now().UnixNano()))
+	r.Headers = append(r.Headers, kgo.RecordHeader{Key: tailHeader, Value: sent})
+}
+
+// delivered1 measures a record polled at now.
+func (t *tailWatch) delivered1(r *kgo.Record, now time.Time) {
+	for _, h := range r.Headers {
+		if h.Key == tailHeader && len(h.Value) == 8 {
+			sent := time.Unix(0, int64(binary.BigEndian.Uint64(h.Value)))
+			t.lat.observe(now.Sub(sent))
+			atomic.AddInt64(&t.delivered, 1)
+			atomic.AddInt64(&t.windowed, 1)
+			return
+		}
+	}
+}
+
+// drain waits for the consumer to deliver everything produced, giving up
+// once a fetch could have waited out -fetch-max-wait twice over.
+func (t *tailWatch) drain() {
+	wait := *fetchMaxWait
+	if wait == 0 {
+		wait = 5 * time.Second // kgo's default
+	}
+	for deadline := time.Now().Add(2*wait + time.Second); time.Now().Before(deadline); {
+		if atomic.LoadInt64(&t.delivered) >= atomic.LoadInt64(&t.produced) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.client.Close()
+	<-t.done
+}
+
+// tailReport is the records delivered to the tail consumer over one
+// interval.
+type tailReport struct {
+	Delivered int64           `json:"delivered"`
+	Latency   *latencySummary `json:"delivery_latency"`
+}
+
+func (t *tailWatch) swap() *tailReport {
+	now := t.lat.snapshot()
+	lat := now
+	if !cumulativePercentiles {
+		lat = now.sub(t.last)
+	}
+	t.last = now
+	return &tailReport{
+		Delivered: atomic.SwapInt64(&t.windowed, 0),
+		Latency:   lat.summary(),
+	}
+}
+
+func (r *tailReport) String() string {
+	return fmt.Sprintf("tail %d delivered, delivery %s", r.Delivered, r.Latency)
+}
+
+func (r *tailReport) metrics() []metric {
+	return append([]metric{
+		{name: "tail_delivered_records", value: float64(r.Delivered), counter: true},
+	}, r.Latency.metrics("tail_delivery_latency")...)
+}
+
+// tailSummary is delivery over the whole run, for the summary.
+type tailSummary struct {
+	Delivered   int64           `json:"delivered"`
+	Undelivered int64           `json:"undelivered"` // produced, but not delivered after draining
+	Latency     *latencySummary `json:"delivery_latency"`
+}
+
+func (t *tailWatch) summary() *tailSummary {
+	delivered := atomic.LoadInt64(&t.delivered)
+	return &tailSummary{
+		Delivered:   delivered,
+		Undelivered: max(atomic.LoadInt64(&t.produced)-delivered, 0),
+		Latency:     t.lat.snapshot().summary(),
+	}
+}
+
+func (s *tailSummary) String() string {
+	line := fmt.Sprintf("tail %d delivered, delivery %s", s.Delivered, s.Latency)
+	if s.Undelivered > 0 {
+		line += fmt.Sprintf(", %d undelivered", s.Undelivered)
+	}
+	return line
+}
+
+func (s *tailSummary) metrics() []metric {
+	return append([]metric{
+		{name: "summary_tail_delivered", value: float64(s.Delivered)},
+		{name: "summary_tail_undelivered", value: float64(s.Undelivered)},
+	}, s.Latency.metrics("summary_tail_delivery_latency")...)
+}
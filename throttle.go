@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// throttleStats records the throttle times brokers return, which for this
+// workload are almost entirely from produce and fetch quotas. Throttles that
+// zero in on one broker point at partition skew rather than the quota itself.
+type throttleStats struct {
+	throttled int64 // throttle time since the last report, ns
+	count     int64
+	total     int64 // throttle time since starting, ns
+
+	mu      sync.Mutex
+	brokers map[int32]*histogram
+}
+
+var throttles = throttleStats{brokers: make(map[int32]*histogram)}
+
+func (s *throttleStats) OnBrokerThrottle(meta kgo.BrokerMetadata, interval time.Duration, _ bool) {
+	if interval <= 0 {
+		return
+	}
+	atomic.AddInt64(&s.throttled, int64(interval))
+	atomic.AddInt64(&s.total, int64(interval))
+	atomic.AddInt64(&s.count, 1)
+
+	s.mu.Lock()
+	h := s.brokers[meta.NodeID]
+	if h == nil {
+		h = new(histogram)
+		s.brokers[meta.NodeID] = h
+	}
+	s.mu.Unlock()
+	h.observe(interval)
+}
+
+// throttleReport is the throttling brokers imposed over one interval.
+type throttleReport struct {
+	Throttles int64                     `json:"throttles"`
+	PerSecond time.Duration             `json:"throttled_per_second_ns"`
+	Brokers   map[int32]*latencySummary `json:"brokers"`
+}
+
+func (s *throttleStats) swap(interval time.Duration) *throttleReport {
+	throttled := atomic.SwapInt64(&s.throttled, 0)
+	r := &throttleReport{
+		Throttles: atomic.SwapInt64(&s.count, 0),
+		PerSecond: time.Duration(float64(throttled) / interval.Seconds()),
+		Brokers:   make(map[int32]*latencySummary),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for node, h := range s.brokers {
+		if snap := h.interval(); snap.total > 0 {
+			r.Brokers[node] = snap.summary()
+		}
+	}
+	return r
+}
+
+func (r *throttleReport) nodes() []int32 {
+	nodes := make([]int32, 0, len(r.Brokers))
+	for node := range r.Brokers {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i] < nodes[j] })
+	return nodes
+}
+
+func (r *throttleReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d throttles, throttled %v/s", r.Throttles, r.PerSecond.Round(time.Millisecond))
+	for _, node := range r.nodes() {
+		fmt.Fprintf(&b, "; broker %d throttle %s", node, r.Brokers[node])
+	}
+	return b.String()
+}
+
+func (r *throttleReport) metrics() []metric {
+	ms := []metric{
+		{name: "throttles", value: float64(r.Throttles), counter: true},
+		{name: "throttled_seconds_per_second", value: r.PerSecond.Seconds()},
+	}
+	for _, node := range r.nodes() {
+		ms = append(ms, r.Brokers[node].metrics("throttle", "broker", strconv.Itoa(int(node)))...)
+	}
+	return ms
+}
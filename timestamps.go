@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// timestampMode is a parsed -timestamp-mode, setting produced records'
+// (create time) timestamps instead of leaving kgo to stamp them now.
+type timestampMode struct {
+	fixed time.Time     // if non-zero, every record's timestamp
+	skew  time.Duration // otherwise, added to now, unless monotonic
+	step  time.Duration // if non-zero, the n'th record is at start + n*step
+	start time.Time
+}
+
+// parseTimestampMode parses -timestamp-mode, returning nil for now:
+//
+//	now               the time of producing (the default)
+//	fixed:RFC3339     every record at this time
+//	skew:DURATION     now shifted by DURATION, e.g. skew:-72h or skew:10m
+//	monotonic:STEP    each producer's n'th record at the run's start + n*STEP,
+//	                  regardless of when it is actually produced
+func parseTimestampMode(spec string) *timestampMode {
+	kind, arg, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "now":
+		return nil
+	case "fixed":
+		ts, err := time.Parse(time.RFC3339Nano, arg)
+		chk(err, "invalid -timestamp-mode fixed time %q: %v", arg, err)
+		return &timestampMode{fixed: ts}
+	case "skew":
+		d, err := time.ParseDuration(arg)
+		chk(err, "invalid -timestamp-mode skew %q: %v", arg, err)
+		return &timestampMode{skew: d}
+	case "monotonic":
+		d, err := time.ParseDuration(arg)
+		if err != nil || d <= 0 {
+			die("invalid -timestamp-mode monotonic step %q, expected a positive duration", arg)
+		}
+		return &timestampMode{step: d, start: time.Now()}
+	default:
+		die("unrecognized -timestamp-mode %q, expected now, fixed:RFC3339, skew:DURATION, or monotonic:STEP", spec)
+		return nil
+	}
+}
+
+// at returns the timestamp of a producer's num'th record.
+func (m *timestampMode) at(num int64) time.Time {
+	switch {
+	case !m.fixed.IsZero():
+		return m.fixed
+	case m.step > 0:
+		return m.start.Add(time.Duration(num) * m.step)
+	default:
+		return time.Now().Add(m.skew)
+	}
+}
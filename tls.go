@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// newTLSConfig builds the TLS config shared by every client. Sharing one
+// config means sharing one session cache, so a reconnect from any client can
+// resume a session that another client established.
+func newTLSConfig() *tls.Config {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: *tlsServerName,
+	}
+	if *tlsSessionCache > 0 {
+		cfg.ClientSessionCache = tls.NewLRUClientSessionCache(*tlsSessionCache)
+	} else {
+		cfg.SessionTicketsDisabled = true
+	}
+
+	if *tlsCA != "" {
+		ca, err := os.ReadFile(*tlsCA)
+		chk(err, "unable to read tls ca %s: %v", *tlsCA, err)
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(ca) {
+			die("no certificates found in tls ca %s", *tlsCA)
+		}
+	}
+
+	if *tlsCert != "" || *tlsKey != "" {
+		if *tlsCert == "" || *tlsKey == "" {
+			die("-tls-cert and -tls-key must be specified together")
+		}
+		cert, err := tls.LoadX509KeyPair(*tlsCert, *tlsKey)
+		chk(err, "unable to load tls cert/key pair: %v", err)
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg
+}
+
+// connStats counts broker connections across all clients, along with the
+// TLS handshakes performed on them and how many of those resumed a session.
+type connStats struct {
+	dials       int64
+	dialErrors  int64
+	disconnects int64
+	handshakes  int64
+	resumed     int64
+}
+
+var conns connStats
+
+func (s *connStats) OnBrokerConnect(_ kgo.BrokerMetadata, _ time.Duration, conn net.Conn, err error) {
+	if err != nil {
+		atomic.AddInt64(&s.dialErrors, 1)
+		return
+	}
+	atomic.AddInt64(&s.dials, 1)
+	// -blackhole-every wraps every connection to track it.
+	if fc, ok := conn.(*failoverConn); ok {
+		conn = fc.Conn
+	}
+	if tc, ok := conn.(*tls.Conn); ok {
+		atomic.AddInt64(&s.handshakes, 1)
+		if tc.ConnectionState().DidResume {
+			atomic.AddInt64(&s.resumed, 1)
+		}
+	}
+}
+
+func (s *connStats) OnBrokerDisconnect(kgo.BrokerMetadata, net.Conn) {
+	atomic.AddInt64(&s.disconnects, 1)
+}
+
+// tlsReport is the cumulative connection and handshake counts, attached to
+// each rate report when connecting over TLS. Every new connection costs a
+// handshake; the resumption rate shows how much of that cost session tickets
+// avoid on connection churn.
+type tlsReport struct {
+	Handshakes int64 `json:"handshakes"`
+	Resumed    int64 `json:"resumed"`
+	Open       int64 `json:"open_conns"`
+	Closed     int64 `json:"closed_conns"`
+	DialErrors int64 `json:"dial_errors"`
+}
+
+func (s *connStats) report() *tlsReport {
+	dials := atomic.LoadInt64(&s.dials)
+	disconnects := atomic.LoadInt64(&s.disconnects)
+	return &tlsReport{
+		Handshakes: atomic.LoadInt64(&s.handshakes),
+		Resumed:    atomic.LoadInt64(&s.resumed),
+		Open:       dials - disconnects,
+		Closed:     disconnects,
+		DialErrors: atomic.LoadInt64(&s.dialErrors),
+	}
+}
+
+func (r *tlsReport) String() string {
+	var pct float64
+	if r.Handshakes > 0 {
+		pct = 100 * float64(r.Resumed) / float64(r.Handshakes)
+	}
+	return fmt.Sprintf("tls %d handshakes, %d resumed (%0.1f%%); %d open conns, %d closed, %d dial errors",
+		r.Handshakes, r.Resumed, pct, r.Open, r.Closed, r.DialErrors)
+}
+
+func (r *tlsReport) metrics() []metric {
+	return []metric{
+		{name: "tls_handshakes", value: float64(r.Handshakes)},
+		{name: "tls_resumed", value: float64(r.Resumed)},
+		{name: "open_conns", value: float64(r.Open)},
+		{name: "closed_conns", value: float64(r.Closed)},
+		{name: "dial_errors", value: float64(r.DialErrors)},
+	}
+}
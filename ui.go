@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// uiHistory is how many rate reports of throughput the -ui sparklines show.
+const uiHistory = 60
+
+// uiSink is the -ui dashboard: it takes over the terminal (instead of the
+// stdout sink) and redraws every rate report with throughput sparklines,
+// produce latency over the last interval, error counts, and per-broker
+// connections. Other reports show their latest line below; the final summary
+// restores the terminal and prints normally.
+type uiSink struct {
+	start    time.Time
+	mibs     []float64
+	krecs    []float64
+	lastLat  *histSnapshot // produce latency as of the previous redraw
+	lastErrs int64
+	others   map[string]string // report kind => latest line
+}
+
+// uiActive is set while the dashboard owns the terminal, so that dying
+// gives it back.
+var uiActive int32
+
+func newUISink() *uiSink {
+	os.Stdout.WriteString("\x1b[?1049h\x1b[?25l") // alternate screen, hide cursor
+	atomic.StoreInt32(&uiActive, 1)
+	return &uiSink{
+		start:   time.Now(),
+		lastLat: new(histSnapshot),
+		others:  make(map[string]string),
+	}
+}
+
+func (s *uiSink) write(_ time.Time, r report) {
+	switch r := r.(type) {
+	case *rateReport:
+		s.draw(r)
+	case *summaryReport:
+		restoreTerminal()
+		fmt.Println(r.String())
+	default:
+		s.others[r.kind()] = r.String()
+	}
+}
+
+func (s *uiSink) draw(r *rateReport) {
+	secs := r.Interval.Seconds()
+	s.mibs = appendHistory(s.mibs, float64(r.Bytes)/secs/(1024*1024))
+	s.krecs = appendHistory(s.krecs, float64(r.Records)/secs/1000)
+
+	errs := atomic.LoadInt64(&totalErrs) + atomic.LoadInt64(&produceErrors)
+	intervalErrs := errs - s.lastErrs
+	s.lastErrs = errs
+
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+	fmt.Fprintf(&b, "big-kafka-conn  %v elapsed, %d clients", time.Since(s.start).Round(time.Second), atomic.LoadInt64(&live.clients))
+	if atomic.LoadInt32(&live.paused) == 1 {
+		b.WriteString(", PAUSED")
+	}
+	b.WriteString("\n\n")
+	fmt.Fprintf(&b, "MiB/s      %8.2f  %s\n", s.mibs[len(s.mibs)-1], sparkline(s.mibs))
+	fmt.Fprintf(&b, "k records/s%8.2f  %s\n\n", s.krecs[len(s.krecs)-1], sparkline(s.krecs))
+
+	now := produceLat.snapshot()
+	if lat := now.sub(s.lastLat); lat.total > 0 {
+		fmt.Fprintf(&b, "produce latency  %s\n", lat.summary())
+	}
+	s.lastLat = now
+	fmt.Fprintf(&b, "errors           %d this interval, %d total\n", intervalErrs, errs)
+
+	if len(r.Brokers) > 0 {
+		fmt.Fprintf(&b, "\n%-8s %7s %7s %7s %9s %8s %12s\n", "broker", "conns", "dials", "dialerr", "requests", "errors", "request p99")
+		for _, br := range r.Brokers {
+			fmt.Fprintf(&b, "%-8s %7d %7d %7d %9d %8d %12v\n",
+				brokerName(br.Node), br.Open, br.Dials, br.DialErrors, br.Requests, br.Errors, br.Latency.P99.Round(time.Microsecond))
+		}
+	}
+
+	// Everything else the rate line carries, then the latest other reports.
+	plain := *r
+	plain.Brokers = nil
+	plain.Latency = nil
+	if line := plain.String(); strings.Contains(line, "; ") {
+		b.WriteString("\n")
+		for _, part := range strings.Split(line, "; ")[2:] {
+			b.WriteString(part + "\n")
+		}
+	}
+	kinds := make([]string, 0, len(s.others))
+	for kind := range s.others {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		fmt.Fprintf(&b, "\n%s: %s\n", kind, s.others[kind])
+	}
+	os.Stdout.WriteString(b.String())
+}
+
+func appendHistory(h []float64, v float64) []float64 {
+	h = append(h, v)
+	if len(h) > uiHistory {
+		h = h[len(h)-uiHistory:]
+	}
+	return h
+}
+
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline draws vs scaled to their maximum.
+func sparkline(vs []float64) string {
+	var top float64
+	for _, v := range vs {
+		top = max(top, v)
+	}
+	out := make([]rune, len(vs))
+	for i, v := range vs {
+		idx := 0
+		if top > 0 {
+			idx = int(v / top * float64(len(sparks)-1))
+		}
+		out[i] = sparks[idx]
+	}
+	return string(out)
+}
+
+func restoreTerminal() {
+	if atomic.SwapInt32(&uiActive, 0) == 1 {
+		os.Stdout.WriteString("\x1b[?25h\x1b[?1049l")
+	}
+}
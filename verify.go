@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// verifyHeader is the record header -verify producers stamp every record
+// with: their producer id and the record's sequence number, eight bytes each.
+const verifyHeader = "bkc-verify"
+
+func verifyValue(producer uint64, seq int64) []byte {
+	v := make([]byte, 16)
+	binary.BigEndian.PutUint64(v, producer)
+	binary.BigEndian.PutUint64(v[8:], uint64(seq))
+	return v
+}
+
+// verifier checks consumed records for duplicates and gaps by their
+// verifyHeader. Producing with -verify runs one in process, consuming the
+// topic from its end, so that the summary puts the duplicates it saw next
+// to the retries producers made; consuming with -verify checks what every
+// client consumes instead.
+type verifier struct {
+	mu        sync.Mutex
+	producers map[uint64]*seqSet
+
+	dups       int64 // since the last report
+	unverified int64 // records without a verifyHeader, over the run
+	lastSeen   int64 // unix nanos of the newest record checked
+
+	client *kgo.Client // for producing, the in-process consumer
+	done   chan struct{}
+}
+
+// seqSet is the sequence numbers seen from one producer.
+type seqSet struct {
+	bits     []uint64
+	min, max int64
+	unique   int64
+	dups     int64
+}
+
+var verifying *verifier
+
+func newVerifier() *verifier {
+	return &verifier{producers: make(map[uint64]*seqSet)}
+}
+
+// startVerifier consumes topic from its end with opts until drained.
+func startVerifier(opts []kgo.Opt, topic string) *verifier {
+	v := newVerifier()
+	client, err := kgo.NewClient(append(opts,
+		kgo.ConsumeTopics(topic),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtEnd()),
+	)...)
+	chk(err, "unable to initialize verifying client: %v", err)
+	v.client = client
+	v.done = make(chan struct{})
+	go func() {
+		defer close(v.done)
+		for {
+			fetches := client.PollFetches(context.Background())
+			if fetches.IsClientClosed() {
+				return
+			}
+			fetches.EachError(func(t string, p int32, err error) {
+				die("verifying fetch error on %s/%d: %v", t, p, err)
+			})
+			fetches.EachRecord(v.check)
+		}
+	}()
+	return v
+}
+
+// drain waits for the in-process consumer to catch up with what was
+// produced, which is once it has seen nothing new for a few seconds.
+func (v *verifier) drain() {
+	if v.client == nil {
+		return
+	}
+	const quiet = 3 * time.Second
+	atomic.CompareAndSwapInt64(&v.lastSeen, 0, time.Now().UnixNano())
+	for time.Since(time.Unix(0, atomic.LoadInt64(&v.lastSeen))) < quiet {
+		time.Sleep(100 * time.Millisecond)
+	}
+	v.client.Close()
+	<-v.done
+}
+
+func (v *verifier) check(r *kgo.Record) {
+	atomic.StoreInt64(&v.lastSeen, time.Now().UnixNano())
+	var value []byte
+	for _, h := range r.Headers {
+		if h.Key == verifyHeader && len(h.Value) == 16 {
+			value = h.Value
+		}
+	}
+	if value == nil {
+		atomic.AddInt64(&v.unverified, 1)
+		return
+	}
+	producer := binary.BigEndian.Uint64(value)
+	seq := int64(binary.BigEndian.Uint64(value[8:]))
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s := v.producers[producer]
+	if s == nil {
+		s = &seqSet{min: seq, max: seq}
+		v.producers[producer] = s
+	}
+	if s.add(seq) {
+		v.dups++
+	}
+}
+
+// add records seq, returning whether it was already seen.
+func (s *seqSet) add(seq int64) bool {
+	word, bit := seq/64, uint64(1)<<(seq%64)
+	for int64(len(s.bits)) <= word {
+		s.bits = append(s.bits, 0)
+	}
+	if s.bits[word]&bit != 0 {
+		s.dups++
+		return true
+	}
+	s.bits[word] |= bit
+	s.unique++
+	s.min, s.max = min(s.min, seq), max(s.max, seq)
+	return false
+}
+
+// verifyReport is the duplicates consumed over one interval.
+type verifyReport struct {
+	Duplicates int64 `json:"duplicates"`
+}
+
+func (v *verifier) swap() *verifyReport {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	r := &verifyReport{Duplicates: v.dups}
+	v.dups = 0
+	return r
+}
+
+func (r *verifyReport) String() string {
+	return fmt.Sprintf("verify %d duplicates", r.Duplicates)
+}
+
+func (r *verifyReport) metrics() []metric {
+	return []metric{{name: "verify_duplicates", value: float64(r.Duplicates), counter: true}}
+}
+
+// verifySummary is everything the verifier saw over the run. Missing counts
+// the gaps between each producer's lowest and highest sequence numbers seen;
+// records produced before the verifier started consuming are not missing.
+// Producing idempotently, duplicates should be zero however many ambiguous
+// produce requests were retried.
+type verifySummary struct {
+	Producers  int          `json:"producers"`
+	Unique     int64        `json:"unique"`
+	Duplicates int64        `json:"duplicates"`
+	Missing    int64        `json:"missing"`
+	Unverified int64        `json:"unverified,omitempty"`
+	Retries    *retryReport `json:"retries,omitempty"`
+}
+
+func (v *verifier) summary() *verifySummary {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	r := &verifySummary{Producers: len(v.producers), Unverified: atomic.LoadInt64(&v.unverified)}
+	for _, s := range v.producers {
+		r.Unique += s.unique
+		r.Duplicates += s.dups
+		r.Missing += s.max - s.min + 1 - s.unique
+	}
+	return r
+}
+
+func (r *verifySummary) String() string {
+	line := fmt.Sprintf("verify %d producers, %d unique records, %d duplicates, %d missing",
+		r.Producers, r.Unique, r.Duplicates, r.Missing)
+	if r.Unverified > 0 {
+		line += fmt.Sprintf(", %d without a %s header", r.Unverified, verifyHeader)
+	}
+	if r.Retries != nil {
+		line += " against " + r.Retries.String()
+	}
+	return line
+}
+
+func (r *verifySummary) metrics() []metric {
+	return []metric{
+		{name: "summary_verify_unique", value: float64(r.Unique)},
+		{name: "summary_verify_duplicates", value: float64(r.Duplicates)},
+		{name: "summary_verify_missing", value: float64(r.Missing)},
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// live holds the workload knobs that can change while running (through the
+// control API). Everything else is fixed at startup from flags.
+var live struct {
+	rate       int64 // target produce records/s across all clients, 0 is unlimited
+	recordSize int64 // value size when sizing records by -record-size
+	clients    int64 // number of running clients
+	paused     int32
+
+	mu      sync.Mutex
+	resume  chan struct{}              // closed on resume; non-nil while paused
+	running map[int]chan struct{}      // client index => closed to stop it
+	wg      sync.WaitGroup             // running clients
+	start   func(int, <-chan struct{}) // runs one client until stopped
+}
+
+// setClients starts or stops clients until exactly n are running. Clients
+// keep their index for their lifetime, and stopping removes the highest
+// indices first.
+func setClients(n int) {
+	live.mu.Lock()
+	defer live.mu.Unlock()
+	if live.running == nil {
+		live.running = make(map[int]chan struct{})
+	}
+	for i, stop := range live.running {
+		if i >= n {
+			close(stop)
+			delete(live.running, i)
+		}
+	}
+	for i := 0; i < n; i++ {
+		if _, ok := live.running[i]; ok {
+			continue
+		}
+		startClient(i)
+	}
+	atomic.StoreInt64(&live.clients, int64(n))
+}
+
+// startClient starts client i; live.mu must be held.
+func startClient(i int) {
+	stop := make(chan struct{})
+	live.running[i] = stop
+	live.wg.Add(1)
+	go func() {
+		defer live.wg.Done()
+		live.start(i, stop)
+	}()
+}
+
+func setPaused(paused bool) {
+	live.mu.Lock()
+	defer live.mu.Unlock()
+	switch {
+	case paused && live.resume == nil:
+		live.resume = make(chan struct{})
+		atomic.StoreInt32(&live.paused, 1)
+		markPhase("paused")
+	case !paused && live.resume != nil:
+		atomic.StoreInt32(&live.paused, 0)
+		close(live.resume)
+		live.resume = nil
+		markPhase("running")
+	}
+}
+
+// waitUnpaused blocks while the workload is paused, returning false if
+// stopped in the meantime.
+func waitUnpaused(stop <-chan struct{}) bool {
+	if atomic.LoadInt32(&live.paused) == 0 {
+		return true
+	}
+	live.mu.Lock()
+	resume := live.resume
+	live.mu.Unlock()
+	if resume == nil {
+		return true
+	}
+	select {
+	case <-resume:
+		return true
+	case <-stop:
+		return false
+	}
+}
+
+func stopped(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// pacer spaces one producer's records to its share of the target rate. Each
+// client paces itself so that rate limiting adds no shared contention.
+type pacer struct{ next time.Time }
+
+func (p *pacer) wait() {
+	rate := atomic.LoadInt64(&live.rate)
+	if rate <= 0 {
+		return
+	}
+	n := atomic.LoadInt64(&live.clients)
+	every := time.Duration(float64(time.Second) * float64(n) / float64(rate))
+
+	now := time.Now()
+	// After a stall (pause, backpressure) we resume at the target rate
+	// rather than bursting to catch up.
+	if p.next.Before(now.Add(-time.Second)) {
+		p.next = now
+	}
+	p.next = p.next.Add(every)
+	if d := p.next.Sub(now); d > 0 {
+		time.Sleep(d)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// producerWorkload is one -workloads entry: producer settings that override
+// the global flags for the clients running it, so that traffic with
+// different needs (a low latency topic next to a bulk topic) runs at once.
+// Clients take turns running each workload.
+type producerWorkload struct {
+	name  string
+	topic string
+	opts  []kgo.Opt
+
+	recs  int64 // since the last report
+	bytes int64
+	lat   histogram
+}
+
+// parseWorkloads parses a semicolon delimited list of workloads, each
+// name:key=value,... with keys
+//
+//	topic        the topic to produce to (default -topic)
+//	linger       like -linger
+//	batch        like -max-batch-size, e.g. 1MiB
+//	compression  like -compression, one codec
+//
+// e.g. latency:topic=orders,linger=0;bulk:topic=logs,linger=50ms,batch=1MiB,compression=zstd
+func parseWorkloads(spec string) []*producerWorkload {
+	var ws []*producerWorkload
+	for _, entry := range strings.Split(spec, ";") {
+		name, settings, _ := strings.Cut(strings.TrimSpace(entry), ":")
+		if name == "" {
+			die("invalid -workloads entry %q, expected name:key=value,...", entry)
+		}
+		w := &producerWorkload{name: name, topic: *topic}
+		for _, kv := range strings.Split(settings, ",") {
+			if kv == "" {
+				continue
+			}
+			k, v, ok := strings.Cut(kv, "=")
+			if !ok {
+				die("invalid -workloads setting %q in %s, expected key=value", kv, name)
+			}
+			switch k {
+			case "topic":
+				w.topic = v
+			case "linger":
+				d, err := time.ParseDuration(v)
+				if err != nil || d < 0 {
+					die("invalid -workloads linger %q in %s", v, name)
+				}
+				w.opts = append(w.opts, kgo.ProducerLinger(d))
+			case "batch":
+				n := parseBytes(v)
+				if n <= 0 {
+					die("invalid -workloads batch %q in %s", v, name)
+				}
+				if valueSizer.max() > n {
+					die("records of up to %d bytes cannot fit in %s's batch size of %d", valueSizer.max(), name, n)
+				}
+				w.opts = append(w.opts, kgo.ProducerBatchMaxBytes(int32(n)))
+			case "compression":
+				codecs := parseCompression(v)
+				if len(codecs) != 1 {
+					die("-workloads compression in %s must be one codec", name)
+				}
+				if strings.ToLower(v) != "none" {
+					reportCompression = true
+				}
+				w.opts = append(w.opts, kgo.ProducerBatchCompression(codecs[0]))
+			default:
+				die("unrecognized -workloads setting %s in %s, expected topic, linger, batch, or compression", k, name)
+			}
+		}
+		if w.topic == "" {
+			die("workload %s needs a topic, or -topic", name)
+		}
+		w.opts = append(w.opts, kgo.DefaultProduceTopic(w.topic))
+		ws = append(ws, w)
+	}
+	for i, w := range ws {
+		for _, other := range ws[:i] {
+			if w.topic == other.topic {
+				die("workloads %s and %s produce to the same topic, %s", other.name, w.name, w.topic)
+			}
+		}
+	}
+	return ws
+}
+
+// workloads is every -workloads entry.
+var workloads []*producerWorkload
+
+// workloadOf returns the workload producing to topic, if any. Workloads each
+// have their own topic, and there are only a few.
+func workloadOf(topic string) *producerWorkload {
+	for _, w := range workloads {
+		if w.topic == topic {
+			return w
+		}
+	}
+	return nil
+}
+
+func (w *producerWorkload) produced(bytes int, lat time.Duration) {
+	atomic.AddInt64(&w.recs, 1)
+	atomic.AddInt64(&w.bytes, int64(bytes))
+	w.lat.observe(lat)
+}
+
+// workloadReport is what one workload produced over one interval.
+type workloadReport struct {
+	Name    string          `json:"name"`
+	Topic   string          `json:"topic"`
+	Records int64           `json:"records"`
+	Bytes   int64           `json:"bytes"`
+	Latency *latencySummary `json:"latency"`
+}
+
+type workloadReports []*workloadReport
+
+func swapWorkloadReports() workloadReports {
+	rs := make(workloadReports, 0, len(workloads))
+	for _, w := range workloads {
+		rs = append(rs, &workloadReport{
+			Name:    w.name,
+			Topic:   w.topic,
+			Records: atomic.SwapInt64(&w.recs, 0),
+			Bytes:   atomic.SwapInt64(&w.bytes, 0),
+			Latency: w.lat.interval().summary(),
+		})
+	}
+	return rs
+}
+
+func (rs workloadReports) String() string {
+	parts := make([]string, 0, len(rs))
+	for _, r := range rs {
+		parts = append(parts, fmt.Sprintf("%s %d records, %d bytes, p99 %v", r.Name, r.Records, r.Bytes, r.Latency.P99))
+	}
+	return "workloads " + strings.Join(parts, ", ")
+}
+
+func (rs workloadReports) metrics() []metric {
+	var ms []metric
+	for _, r := range rs {
+		labels := []string{"workload", r.Name, "topic", r.Topic}
+		ms = append(ms,
+			metric{name: "workload_records", labels: labels, value: float64(r.Records), counter: true},
+			metric{name: "workload_bytes", labels: labels, value: float64(r.Bytes), counter: true},
+		)
+		ms = append(ms, r.Latency.metrics("workload_produce_latency", labels...)...)
+	}
+	return ms
+}
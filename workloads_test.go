@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestParseWorkloads(t *testing.T) {
+	valueSizer = fixedSize{}
+	*topic = "default"
+	defer func() { *topic = "" }()
+
+	for _, test := range []struct {
+		spec   string
+		names  []string
+		topics []string
+		opts   []int // per workload, including the default produce topic
+	}{
+		{"a", []string{"a"}, []string{"default"}, []int{1}},
+		{"a:topic=x", []string{"a"}, []string{"x"}, []int{1}},
+		{
+			"latency:topic=orders,linger=0;bulk:topic=logs,linger=50ms,batch=1MiB,compression=zstd",
+			[]string{"latency", "bulk"},
+			[]string{"orders", "logs"},
+			[]int{2, 4},
+		},
+		{" a:topic=x ; b:topic=y,", []string{"a", "b"}, []string{"x", "y"}, []int{1, 1}},
+	} {
+		ws := parseWorkloads(test.spec)
+		if len(ws) != len(test.names) {
+			t.Errorf("%q: got %d workloads, expected %d", test.spec, len(ws), len(test.names))
+			continue
+		}
+		for i, w := range ws {
+			if w.name != test.names[i] || w.topic != test.topics[i] || len(w.opts) != test.opts[i] {
+				t.Errorf("%q #%d: got %s to %s with %d opts, expected %s to %s with %d",
+					test.spec, i, w.name, w.topic, len(w.opts), test.names[i], test.topics[i], test.opts[i])
+			}
+		}
+	}
+}